@@ -0,0 +1,174 @@
+package freeipa
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const defaultCertProfile = "caIPAserviceCert"
+
+// RequestCertificate выпускает сертификат IPA CA по CSR (PEM). principal - uid, host/fqdn или HTTP/fqdn,
+// CN в CSR должен совпадать с ним. Пустой профиль - caIPAserviceCert,
+// для пользователей нужен свой (напр. IECUserRoles).
+func (f *FreeIPA) RequestCertificate(
+	ctx context.Context,
+	principal string,
+	csrPEM []byte,
+	profile string,
+) (int, *Certificate, error) {
+	if profile == "" {
+		profile = defaultCertProfile
+	}
+
+	opts := map[string]any{
+		"principal":  principal,
+		"profile_id": profile,
+	}
+
+	return f.sendCertRPC(ctx, "cert_request", string(csrPEM), opts)
+}
+
+// GetCertificate сертификат, выпущенный IPA CA, со статусом отзыва
+func (f *FreeIPA) GetCertificate(ctx context.Context, serial *big.Int) (int, *Certificate, error) {
+	if serial == nil {
+		return 0, nil, errors.New("serial is nil")
+	}
+
+	return f.sendCertRPC(ctx, "cert_show", serial.String(), nil)
+}
+
+// RevokeCertificate отзывает сертификат, RevocationCertificateHold - временно
+func (f *FreeIPA) RevokeCertificate(ctx context.Context, serial *big.Int, reason RevocationReason) (int, error) {
+	if serial == nil {
+		return 0, errors.New("serial is nil")
+	}
+
+	opts := map[string]any{
+		"revocation_reason": int(reason),
+	}
+
+	statusCode, _, err := f.sendRPC(ctx, "cert_revoke", rpcArgs(serial.String()), opts)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// FindCertificates сертификаты IPA CA и добавленные в записи владельцев, по возрастанию серийного номера.
+// Выборка, обрезанная сервером (лимит LDAP), - ошибка ErrSizeLimitExceeded.
+func (f *FreeIPA) FindCertificates(ctx context.Context, filter CertificateFilter) (int, []Certificate, error) {
+	statusCode, resp, err := f.sendRPC(ctx, "cert_find", "", filter.toOpts())
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+	if resp.Result.Truncated {
+		return 0, nil, newTruncatedError("cert_find", resp.Result.Count)
+	}
+
+	certs := make([]Certificate, 0)
+
+	if resp.Result.Result != nil {
+		if certs, err = decodeList(resp.Result.Result, certificateCodec); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return statusCode, certs, nil
+}
+
+// PEM сертификат в PEM, например для файлов NewTLSConfigServer (pkg/tls). nil, если сертификат не разобран.
+func (c *Certificate) PEM() []byte {
+	if c == nil || c.X509 == nil {
+		return nil
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.X509.Raw})
+}
+
+// toOpts опции cert_find
+func (c CertificateFilter) toOpts() map[string]any {
+	opts := map[string]any{
+		"all":       true,
+		"sizelimit": 0, // без него IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	}
+
+	if c.Subject != "" {
+		opts["subject"] = c.Subject
+	}
+
+	for key, values := range map[string][]string{"user": c.Users, "host": c.Hosts, "service": c.Services} {
+		if len(values) > 0 {
+			putListOpt(opts, key, values)
+		}
+	}
+
+	if c.RevocationReason != nil {
+		opts["revocation_reason"] = int(*c.RevocationReason)
+	}
+	if c.ExpiresBefore != nil {
+		opts["validnotafter_to"] = datetimeOpt(*c.ExpiresBefore)
+	}
+
+	return opts
+}
+
+// afterDecode владельцы (owner_user, owner_host, owner_service - одним списком) и разобранный сертификат
+func (c *Certificate) afterDecode(m map[string]any) error {
+	for _, attr := range []string{"owner_user", "owner_host", "owner_service"} {
+		if m[attr] == nil {
+			continue
+		}
+
+		for _, v := range attrValues(m[attr]) {
+			owner, err := parseString(v)
+			if err != nil {
+				return fmt.Errorf("%w (%s)", err, attr)
+			}
+
+			c.Owners = append(c.Owners, owner)
+		}
+	}
+
+	if m["certificate"] == nil {
+		return nil
+	}
+
+	der, err := parseBase64(attrValues(m["certificate"])[0])
+	if err != nil {
+		return fmt.Errorf("%w (certificate)", err)
+	}
+
+	x509Cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+
+	c.X509 = x509Cert
+
+	return nil
+}
+
+func (f *FreeIPA) sendCertRPC(ctx context.Context, method, arg string, opts map[string]any) (int, *Certificate, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, arg, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	cert, err := decodeEntry(entry, certificateCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+	if cert.X509 == nil {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	return statusCode, &cert, nil
+}
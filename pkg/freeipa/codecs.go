@@ -0,0 +1,288 @@
+package freeipa
+
+import (
+	"encoding"
+	"math/big"
+	"time"
+)
+
+// разбор записей IPA в dto из models.go, см. entryCodec
+
+var roleCodec = entryCodec[Role]{
+	fields: []entryField[Role]{
+		scalarAttr("cn", func(r *Role) *string { return &r.CN }, parseString),
+		scalarAttr("dn", func(r *Role) *string { return &r.DN }, parseString),
+		scalarAttr("description", func(r *Role) *string { return &r.Description }, parseString),
+		listAttr("objectclass", func(r *Role) *[]string { return &r.ObjectClass }, parseString),
+		listAttr("member_user", func(r *Role) *[]string { return &r.MemberUser }, parseString),
+		listAttr("member_group", func(r *Role) *[]string { return &r.MemberGroup }, parseString),
+		listAttr("member_host", func(r *Role) *[]string { return &r.MemberHost }, parseString),
+		listAttr("member_hostgroup", func(r *Role) *[]string { return &r.MemberHostGroup }, parseString),
+		listAttr("member_service", func(r *Role) *[]string { return &r.MemberService }, parseString),
+		listAttr("memberof_privilege", func(r *Role) *[]string { return &r.Privileges }, parseString),
+	},
+}
+
+// userCodec имя, фамилия и ФИО в LDAP многозначные, как и в старом маппере берется первое значение
+var userCodec = entryCodec[User]{
+	fields: []entryField[User]{
+		scalarAttr("uid", func(u *User) *string { return &u.UID }, parseString),
+		firstAttr("givenname", func(u *User) *string { return &u.GivenName }, parseString),
+		firstAttr("sn", func(u *User) *string { return &u.SN }, parseString),
+		scalarAttr("dn", func(u *User) *string { return &u.DN }, parseString),
+		listAttr("memberof_group", func(u *User) *[]string { return &u.MemberOfGroup }, parseString),
+		listAttr("memberof_role", func(u *User) *[]string { return &u.MemberOfRole }, parseString),
+		listAttr("memberofindirect_group", func(u *User) *[]string { return &u.MemberOfIndirectGroup }, parseString),
+		listAttr("memberofindirect_role", func(u *User) *[]string { return &u.MemberOfIndirectRole }, parseString),
+		firstAttr("mail", func(u *User) *string { return &u.Mail }, parseString),
+		scalarAttr("nsaccountlock", func(u *User) *bool { return &u.NsAccountLock }, parseBool),
+		scalarAttr("krbpasswordexpiration", func(u *User) *time.Time { return &u.KRBPasswordExpiration }, parseTime),
+		firstAttr("cn", func(u *User) *string { return &u.CN }, parseString),
+		firstAttr("telephonenumber", func(u *User) *string { return &u.TelephoneNumber }, parseString),
+		firstAttr("mobile", func(u *User) *string { return &u.Mobile }, parseString),
+		firstAttr("title", func(u *User) *string { return &u.Title }, parseString),
+		firstAttr("o", func(u *User) *string { return &u.Organization }, parseString),
+		firstAttr("ou", func(u *User) *string { return &u.OrgUnit }, parseString),
+		scalarAttr("jpegphoto", func(u *User) *string { return &u.JPEGPhoto }, parseBase64String),
+		scalarAttr("preserved", func(u *User) *bool { return &u.Preserved }, parseBool),
+		listAttr("ipasshpubkey", func(u *User) *[]string { return &u.SSHPublicKeys }, parseString),
+		listAttr("sshpubkeyfp", func(u *User) *[]string { return &u.SSHKeyFingerprints }, parseString),
+		listAttr("usercertificate", func(u *User) *[][]byte { return &u.Certificates }, parseBase64),
+		listAttr("ipauserauthtype", func(u *User) *[]string { return &u.AuthTypes }, parseString),
+	},
+	remain: func(u *User) *map[string][]string { return &u.Attrs },
+	after:  (*User).afterDecode,
+}
+
+var groupCodec = entryCodec[Group]{
+	fields: []entryField[Group]{
+		scalarAttr("cn", func(g *Group) *string { return &g.CN }, parseString),
+		scalarAttr("dn", func(g *Group) *string { return &g.DN }, parseString),
+		scalarAttr("description", func(g *Group) *string { return &g.Description }, parseString),
+		scalarAttr("gidnumber", func(g *Group) *int { return &g.GIDNumber }, parseInt),
+		listAttr("objectclass", func(g *Group) *[]string { return &g.ObjectClass }, parseString),
+		listAttr("member_user", func(g *Group) *[]string { return &g.MemberUser }, parseString),
+		listAttr("member_group", func(g *Group) *[]string { return &g.MemberGroup }, parseString),
+		listAttr("memberof_group", func(g *Group) *[]string { return &g.MemberOfGroup }, parseString),
+		listAttr("memberindirect_user", func(g *Group) *[]string { return &g.MemberIndirectUser }, parseString),
+	},
+}
+
+var passwordPolicyCodec = entryCodec[PasswordPolicy]{
+	fields: []entryField[PasswordPolicy]{
+		scalarAttr("cn", func(p *PasswordPolicy) *string { return &p.Group }, parseString),
+		scalarAttr("krbmaxpwdlife", func(p *PasswordPolicy) *int { return &p.MaxLife }, parseInt),
+		scalarAttr("krbminpwdlife", func(p *PasswordPolicy) *int { return &p.MinLife }, parseInt),
+		scalarAttr("krbpwdminlength", func(p *PasswordPolicy) *int { return &p.MinLength }, parseInt),
+		scalarAttr("krbpwdmindiffchars", func(p *PasswordPolicy) *int { return &p.MinClasses }, parseInt),
+		scalarAttr("krbpwdhistorylength", func(p *PasswordPolicy) *int { return &p.History }, parseInt),
+		scalarAttr("krbpwdmaxfailure", func(p *PasswordPolicy) *int { return &p.MaxFail }, parseInt),
+		scalarAttr("krbpwdfailurecountinterval", func(p *PasswordPolicy) *int { return &p.FailureInterval }, parseInt),
+		scalarAttr("krbpwdlockoutduration", func(p *PasswordPolicy) *int { return &p.LockoutTime }, parseInt),
+		scalarAttr("cospriority", func(p *PasswordPolicy) **int { return &p.Priority }, parseIntPtr),
+	},
+}
+
+var hbacRuleCodec = entryCodec[HBACRule]{
+	fields: []entryField[HBACRule]{
+		scalarAttr("cn", func(r *HBACRule) *string { return &r.CN }, parseString),
+		scalarAttr("description", func(r *HBACRule) *string { return &r.Description }, parseString),
+		scalarAttr("ipaenabledflag", func(r *HBACRule) *bool { return &r.Enabled }, parseBool),
+		scalarAttr("usercategory", func(r *HBACRule) *string { return &r.UserCategory }, parseString),
+		scalarAttr("hostcategory", func(r *HBACRule) *string { return &r.HostCategory }, parseString),
+		scalarAttr("servicecategory", func(r *HBACRule) *string { return &r.ServiceCategory }, parseString),
+		listAttr("memberuser_user", func(r *HBACRule) *[]string { return &r.MemberUser }, parseString),
+		listAttr("memberuser_group", func(r *HBACRule) *[]string { return &r.MemberGroup }, parseString),
+		listAttr("memberhost_host", func(r *HBACRule) *[]string { return &r.MemberHost }, parseString),
+		listAttr("memberhost_hostgroup", func(r *HBACRule) *[]string { return &r.MemberHostGroup }, parseString),
+		listAttr("memberservice_hbacsvc", func(r *HBACRule) *[]string { return &r.MemberService }, parseString),
+		listAttr("memberservice_hbacsvcgroup", func(r *HBACRule) *[]string {
+			return &r.MemberServiceGroup
+		}, parseString),
+	},
+}
+
+var hbacServiceCodec = entryCodec[HBACService]{
+	fields: []entryField[HBACService]{
+		scalarAttr("cn", func(s *HBACService) *string { return &s.CN }, parseString),
+		scalarAttr("description", func(s *HBACService) *string { return &s.Description }, parseString),
+		listAttr("memberof_hbacsvcgroup", func(s *HBACService) *[]string { return &s.MemberOfGroup }, parseString),
+	},
+}
+
+var sudoRuleCodec = entryCodec[SudoRule]{
+	fields: []entryField[SudoRule]{
+		scalarAttr("cn", func(r *SudoRule) *string { return &r.CN }, parseString),
+		scalarAttr("description", func(r *SudoRule) *string { return &r.Description }, parseString),
+		scalarAttr("ipaenabledflag", func(r *SudoRule) *bool { return &r.Enabled }, parseBool),
+		scalarAttr("sudoorder", func(r *SudoRule) *int { return &r.Order }, parseInt),
+		scalarAttr("usercategory", func(r *SudoRule) *string { return &r.UserCategory }, parseString),
+		scalarAttr("hostcategory", func(r *SudoRule) *string { return &r.HostCategory }, parseString),
+		scalarAttr("cmdcategory", func(r *SudoRule) *string { return &r.CmdCategory }, parseString),
+		scalarAttr("ipasudorunasusercategory", func(r *SudoRule) *string { return &r.RunAsUserCategory }, parseString),
+		scalarAttr("ipasudorunasgroupcategory", func(r *SudoRule) *string {
+			return &r.RunAsGroupCategory
+		}, parseString),
+		listAttr("memberuser_user", func(r *SudoRule) *[]string { return &r.MemberUser }, parseString),
+		listAttr("memberuser_group", func(r *SudoRule) *[]string { return &r.MemberGroup }, parseString),
+		listAttr("memberhost_host", func(r *SudoRule) *[]string { return &r.MemberHost }, parseString),
+		listAttr("memberhost_hostgroup", func(r *SudoRule) *[]string { return &r.MemberHostGroup }, parseString),
+		listAttr("memberallowcmd_sudocmd", func(r *SudoRule) *[]string { return &r.AllowCommand }, parseString),
+		listAttr("memberallowcmd_sudocmdgroup", func(r *SudoRule) *[]string {
+			return &r.AllowCommandGroup
+		}, parseString),
+		listAttr("memberdenycmd_sudocmd", func(r *SudoRule) *[]string { return &r.DenyCommand }, parseString),
+		listAttr("memberdenycmd_sudocmdgroup", func(r *SudoRule) *[]string { return &r.DenyCommandGroup }, parseString),
+		listAttr("ipasudorunas_user", func(r *SudoRule) *[]string { return &r.RunAsUser }, parseString),
+		listAttr("ipasudorunas_group", func(r *SudoRule) *[]string { return &r.RunAsUserGroup }, parseString),
+		listAttr("ipasudorunasgroup_group", func(r *SudoRule) *[]string { return &r.RunAsGroup }, parseString),
+		listAttr("ipasudoopt", func(r *SudoRule) *[]string { return &r.Options }, parseString),
+	},
+}
+
+var sudoCommandCodec = entryCodec[SudoCommand]{
+	fields: []entryField[SudoCommand]{
+		scalarAttr("sudocmd", func(c *SudoCommand) *string { return &c.Command }, parseString),
+		scalarAttr("description", func(c *SudoCommand) *string { return &c.Description }, parseString),
+		listAttr("memberof_sudocmdgroup", func(c *SudoCommand) *[]string { return &c.MemberOfGroup }, parseString),
+	},
+}
+
+var hostCodec = entryCodec[Host]{
+	fields: []entryField[Host]{
+		scalarAttr("fqdn", func(h *Host) *string { return &h.FQDN }, parseString),
+		scalarAttr("description", func(h *Host) *string { return &h.Description }, parseString),
+		scalarAttr("l", func(h *Host) *string { return &h.Locality }, parseString),
+		scalarAttr("nshostlocation", func(h *Host) *string { return &h.Location }, parseString),
+		scalarAttr("nshardwareplatform", func(h *Host) *string { return &h.Platform }, parseString),
+		scalarAttr("nsosversion", func(h *Host) *string { return &h.OS }, parseString),
+		scalarAttr("has_keytab", func(h *Host) *bool { return &h.HasKeytab }, parseBool),
+		scalarAttr("has_password", func(h *Host) *bool { return &h.HasPassword }, parseBool),
+		listAttr("managedby_host", func(h *Host) *[]string { return &h.ManagedBy }, parseString),
+		listAttr("memberof_hostgroup", func(h *Host) *[]string { return &h.MemberOfHostGroup }, parseString),
+		scalarAttr("randompassword", func(h *Host) *string { return &h.OTP }, parseString),
+	},
+}
+
+var hostGroupCodec = entryCodec[HostGroup]{
+	fields: []entryField[HostGroup]{
+		scalarAttr("cn", func(g *HostGroup) *string { return &g.CN }, parseString),
+		scalarAttr("description", func(g *HostGroup) *string { return &g.Description }, parseString),
+		listAttr("member_host", func(g *HostGroup) *[]string { return &g.MemberHost }, parseString),
+		listAttr("member_hostgroup", func(g *HostGroup) *[]string { return &g.MemberHostGroup }, parseString),
+		listAttr("memberof_hostgroup", func(g *HostGroup) *[]string { return &g.MemberOfHostGroup }, parseString),
+	},
+}
+
+var privilegeCodec = entryCodec[Privilege]{
+	fields: []entryField[Privilege]{
+		scalarAttr("cn", func(p *Privilege) *string { return &p.CN }, parseString),
+		scalarAttr("description", func(p *Privilege) *string { return &p.Description }, parseString),
+		listAttr("memberof_permission", func(p *Privilege) *[]string { return &p.Permissions }, parseString),
+		listAttr("member_role", func(p *Privilege) *[]string { return &p.Roles }, parseString),
+	},
+}
+
+var permissionCodec = entryCodec[Permission]{
+	fields: []entryField[Permission]{
+		scalarAttr("cn", func(p *Permission) *string { return &p.CN }, parseString),
+		listAttr("ipapermright", func(p *Permission) *[]string { return &p.Rights }, parseString),
+		scalarAttr("type", func(p *Permission) *string { return &p.Type }, parseString),
+		listAttr("attrs", func(p *Permission) *[]string { return &p.Attrs }, parseString),
+		scalarAttr("ipapermbindruletype", func(p *Permission) *string { return &p.BindType }, parseString),
+		listAttr("extratargetfilter", func(p *Permission) *[]string { return &p.TargetFilter }, parseString),
+		listAttr("member_privilege", func(p *Permission) *[]string { return &p.Privileges }, parseString),
+		listAttr("memberindirect_role", func(p *Permission) *[]string { return &p.Roles }, parseString),
+	},
+}
+
+// certificateCodec серийный номер берется из serial_number_hex:
+// serial_number числом теряет точность на случайных 128-битных серийниках
+var certificateCodec = entryCodec[Certificate]{
+	fields: []entryField[Certificate]{
+		scalarAttr("serial_number_hex", func(c *Certificate) **big.Int { return &c.SerialNumber }, parseHexInt),
+		scalarAttr("subject", func(c *Certificate) *string { return &c.Subject }, parseString),
+		scalarAttr("issuer", func(c *Certificate) *string { return &c.Issuer }, parseString),
+		scalarAttr("status", func(c *Certificate) *string { return &c.Status }, parseString),
+		scalarAttr("revoked", func(c *Certificate) *bool { return &c.Revoked }, parseBool),
+		scalarAttr("revocation_reason", func(c *Certificate) **RevocationReason {
+			return &c.RevocationReason
+		}, parseRevocationReason),
+	},
+	after: (*Certificate).afterDecode,
+}
+
+var dnsZoneCodec = entryCodec[DNSZone]{
+	fields: []entryField[DNSZone]{
+		scalarAttr("idnsname", func(z *DNSZone) *string { return &z.Name }, parseString),
+		scalarAttr("idnszoneactive", func(z *DNSZone) *bool { return &z.Active }, parseBool),
+		scalarAttr("idnssoamname", func(z *DNSZone) *string { return &z.SOAMName }, parseString),
+		scalarAttr("idnssoarname", func(z *DNSZone) *string { return &z.SOARName }, parseString),
+		scalarAttr("idnssoaserial", func(z *DNSZone) *int { return &z.SOASerial }, parseInt),
+		scalarAttr("idnssoarefresh", func(z *DNSZone) *int { return &z.SOARefresh }, parseInt),
+		scalarAttr("idnssoaretry", func(z *DNSZone) *int { return &z.SOARetry }, parseInt),
+		scalarAttr("idnssoaexpire", func(z *DNSZone) *int { return &z.SOAExpire }, parseInt),
+		scalarAttr("idnssoaminimum", func(z *DNSZone) *int { return &z.SOAMinimum }, parseInt),
+		scalarAttr("dnsttl", func(z *DNSZone) *int { return &z.TTL }, parseInt),
+		listAttr("nsrecord", func(z *DNSZone) *[]string { return &z.NameServers }, parseString),
+		scalarAttr("idnsallowdynupdate", func(z *DNSZone) *bool { return &z.AllowDynUpdate }, parseBool),
+	},
+}
+
+var dnsRecordCodec = entryCodec[DNSRecord]{
+	fields: []entryField[DNSRecord]{
+		scalarAttr("idnsname", func(r *DNSRecord) *string { return &r.Name }, parseString),
+		scalarAttr("dnsttl", func(r *DNSRecord) *int { return &r.TTL }, parseInt),
+		listAttr("arecord", func(r *DNSRecord) *[]string { return &r.A }, parseString),
+		listAttr("aaaarecord", func(r *DNSRecord) *[]string { return &r.AAAA }, parseString),
+		listAttr("cnamerecord", func(r *DNSRecord) *[]string { return &r.CNAME }, parseString),
+		listAttr("ptrrecord", func(r *DNSRecord) *[]string { return &r.PTR }, parseString),
+		listAttr("srvrecord", func(r *DNSRecord) *[]SRVRecord { return &r.SRV }, parseText[SRVRecord]),
+		listAttr("txtrecord", func(r *DNSRecord) *[]string { return &r.TXT }, parseString),
+	},
+}
+
+var otpTokenCodec = entryCodec[OTPToken]{
+	fields: []entryField[OTPToken]{
+		scalarAttr("ipatokenuniqueid", func(t *OTPToken) *string { return &t.ID }, parseString),
+		scalarAttr("type", func(t *OTPToken) *OTPTokenType { return &t.Type }, parseText[OTPTokenType]),
+		scalarAttr("ipatokenowner", func(t *OTPToken) *string { return &t.Owner }, parseString),
+		scalarAttr("description", func(t *OTPToken) *string { return &t.Description }, parseString),
+		scalarAttr("ipatokenvendor", func(t *OTPToken) *string { return &t.Vendor }, parseString),
+		scalarAttr("ipatokenotpalgorithm", func(t *OTPToken) *string { return &t.Algorithm }, parseString),
+		scalarAttr("ipatokenotpdigits", func(t *OTPToken) *int { return &t.Digits }, parseInt),
+		scalarAttr("ipatokentotptimestep", func(t *OTPToken) *int { return &t.TimeStep }, parseInt),
+		scalarAttr("ipatokendisabled", func(t *OTPToken) *bool { return &t.Disabled }, parseBool),
+		scalarAttr("uri", func(t *OTPToken) *string { return &t.URI }, parseString),
+	},
+}
+
+func parseRevocationReason(v any) (*RevocationReason, error) {
+	n, err := parseInt(v)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := RevocationReason(n)
+
+	return &reason, nil
+}
+
+// parseText типы со своим разбором строки (SRVRecord, OTPTokenType)
+func parseText[V any, P interface {
+	*V
+	encoding.TextUnmarshaler
+}](v any) (V, error) {
+	var result V
+
+	str, err := parseString(v)
+	if err != nil {
+		return result, err
+	}
+
+	if err = P(&result).UnmarshalText([]byte(str)); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
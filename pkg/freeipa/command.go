@@ -0,0 +1,183 @@
+package freeipa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Command выполняет произвольную команду IPA (например "config_show" или "automember_find")
+// и раскладывает result.result ответа в out, см. decodeJSON. out может быть nil, если результат не нужен.
+// Для batch в out раскладывается result.results - по элементу на команду, с полями result, error, error_code и т.д.
+// Если схема загружена (Schema), то имя команды, аргументы и опции проверяются до отправки.
+func (f *FreeIPA) Command(ctx context.Context, method string, args []any, opts map[string]any, out any) (int, error) {
+	if schema := f.schema.Load(); schema != nil {
+		if err := schema.Validate(method, args, opts); err != nil {
+			return 0, err
+		}
+	}
+
+	argsSrc := ""
+
+	if len(args) > 0 {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal arguments: %w", err)
+		}
+
+		argsSrc = string(b)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, method, argsSrc, opts)
+	if err != nil {
+		return statusCode, err
+	}
+	if out == nil {
+		return statusCode, nil
+	}
+	if resp.Result == nil {
+		return 0, errors.New(errMsgResponseResultIsNil)
+	}
+
+	var result any = resp.Result.Result
+	if method == "batch" {
+		items := make([]responseItem, len(resp.Result.Results))
+		for i, item := range resp.Result.Results {
+			item.Result = unwrapAll(item.Result)
+			items[i] = item
+		}
+
+		result = items
+	}
+
+	if err = decodeJSON(result, out); err != nil {
+		return 0, fmt.Errorf("failed to decode result of %s: %w", method, err)
+	}
+
+	return statusCode, nil
+}
+
+// Schema загружает описание команд сервера и запоминает его: после этого Command проверяет
+// имена команд и опций локально. Повторный вызов обновляет схему.
+func (f *FreeIPA) Schema(ctx context.Context) (int, *Schema, error) {
+	statusCode, resp, err := f.sendRPC(ctx, "schema", "", nil)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	var raw struct {
+		Fingerprint string `json:"fingerprint"`
+		Commands    []struct {
+			Name   string `json:"name"`
+			Params []struct {
+				Name       string `json:"name"`
+				Type       string `json:"type"`
+				Required   bool   `json:"required"`
+				Multivalue bool   `json:"multivalue"`
+				Positional bool   `json:"positional"`
+			} `json:"params"`
+		} `json:"commands"`
+	}
+
+	if err = decodeJSON(resp.Result.Result, &raw); err != nil {
+		return 0, nil, fmt.Errorf("failed to decode schema: %w", err)
+	}
+
+	schema := &Schema{
+		Fingerprint: raw.Fingerprint,
+		Commands:    make(map[string]SchemaCommand, len(raw.Commands)),
+	}
+
+	for _, c := range raw.Commands {
+		cmd := SchemaCommand{Name: c.Name}
+
+		for _, p := range c.Params {
+			param := SchemaParam{Name: p.Name, Type: p.Type, Required: p.Required, Multivalue: p.Multivalue}
+			if p.Positional {
+				cmd.Args = append(cmd.Args, param)
+			} else {
+				cmd.Options = append(cmd.Options, param)
+			}
+		}
+
+		schema.Commands[c.Name] = cmd
+	}
+
+	f.schema.Store(schema)
+
+	return statusCode, schema, nil
+}
+
+// ResetSchema отключает локальную проверку команд (см. Schema)
+func (f *FreeIPA) ResetSchema() {
+	f.schema.Store(nil)
+}
+
+// Validate проверка команды по схеме, ошибки такие же, как отдал бы сервер:
+// ErrCommand, ErrMaxArgument, ErrOption, ErrRequirement
+func (s *Schema) Validate(method string, args []any, opts map[string]any) error {
+	cmd, ok := s.Commands[method]
+	if !ok {
+		return &Error{
+			Code:    ErrCodeCommand,
+			Name:    ErrCommand.Name,
+			Message: fmt.Sprintf("unknown command '%s'", method),
+		}
+	}
+
+	if len(args) > len(cmd.Args) {
+		return &Error{
+			Code:    ErrCodeMaxArgument,
+			Name:    ErrMaxArgument.Name,
+			Message: fmt.Sprintf("%s: takes at most %d arguments (%d given)", method, len(cmd.Args), len(args)),
+		}
+	}
+
+	for i, arg := range cmd.Args {
+		if arg.Required && (i >= len(args) || args[i] == nil) {
+			return &Error{
+				Code:    ErrCodeRequirement,
+				Name:    ErrRequirement.Name,
+				Message: fmt.Sprintf("'%s' is required", arg.Name),
+			}
+		}
+	}
+
+	for name := range opts {
+		if name == keyOptVersion {
+			continue
+		}
+		if !slices.ContainsFunc(cmd.Options, func(p SchemaParam) bool { return p.Name == name }) {
+			return &Error{
+				Code:    ErrCodeOption,
+				Name:    ErrOption.Name,
+				Message: fmt.Sprintf("%s: unknown option '%s'", method, name),
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeJSON result.result в out через encoding/json (out - любой тип вызывающего, поэтому не entryCodec).
+// Кодировки IPA раскрываются заранее: {"__datetime__"} - время (time.Time), {"__base64__"} - []byte,
+// {"__dns_name__"} - строка. Атрибуты записей остаются срезами, как их отдает IPA ("uid": ["alice"]).
+func decodeJSON(result, out any) error {
+	b, err := json.Marshal(unwrapAll(result))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// HasCommand есть ли команда на сервере, например для проверки версии IPA
+func (s *Schema) HasCommand(method string) bool {
+	_, ok := s.Commands[method]
+	return ok
+}
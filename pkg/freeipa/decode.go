@@ -0,0 +1,404 @@
+package freeipa
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entryCodec разбор записи IPA (result.result) в dto. Атрибуты описываются функциями доступа к полям,
+// как у recordCodec, поэтому разбор идет без reflect, а у каждой dto видно, какие атрибуты в нее попадают.
+// Учитываются кодировки IPA: {"__datetime__"}, {"__base64__"}, {"__dns_name__"}, а также то,
+// что почти все атрибуты приходят срезами, а некоторые (nsaccountlock, dn) - скалярами.
+type entryCodec[T any] struct {
+	fields []entryField[T]
+	remain func(*T) *map[string][]string  // атрибуты, не попавшие в fields, строками; nil - не нужны
+	after  func(*T, map[string]any) error // досчитать поля по записи (например, из dn)
+}
+
+// entryField атрибут записи, values - значения с раскрытыми кодировками IPA, скаляр - срез из одного значения
+type entryField[T any] struct {
+	attr   string
+	decode func(dto *T, values []any) error
+}
+
+// decodeEntry запись ответа IPA в dto
+func decodeEntry[T any](entry any, codec entryCodec[T]) (T, error) {
+	var dto T
+
+	m, ok := entry.(map[string]any)
+	if !ok {
+		return dto, fmt.Errorf(errMsgFailedToParseResponse+": cannot decode %T into entry", entry)
+	}
+
+	if err := codec.decode(m, &dto); err != nil {
+		return dto, fmt.Errorf(errMsgFailedToParseResponse+": %w", err)
+	}
+
+	return dto, nil
+}
+
+// decodeEntries записи <objType>_find/batch в dto
+func decodeEntries[T any](entries []map[string]any, codec entryCodec[T]) ([]T, error) {
+	result := make([]T, 0, len(entries))
+
+	for _, entry := range entries {
+		dto, err := decodeEntry(entry, codec)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, dto)
+	}
+
+	return result, nil
+}
+
+// decodeList result.result ответа <objType>_find: список записей, nil - пустой список
+func decodeList[T any](result any, codec entryCodec[T]) ([]T, error) {
+	if result == nil {
+		return make([]T, 0), nil
+	}
+
+	list, ok := result.([]any)
+	if !ok {
+		return nil, fmt.Errorf(errMsgFailedToParseResponse+": cannot decode %T into entries", result)
+	}
+
+	dtos := make([]T, 0, len(list))
+
+	for _, entry := range list {
+		dto, err := decodeEntry(entry, codec)
+		if err != nil {
+			return nil, err
+		}
+
+		dtos = append(dtos, dto)
+	}
+
+	return dtos, nil
+}
+
+func (c entryCodec[T]) decode(m map[string]any, dto *T) error {
+	for _, field := range c.fields {
+		v, ok := m[field.attr]
+		if !ok || v == nil {
+			continue
+		}
+		if err := field.decode(dto, attrValues(v)); err != nil {
+			return err
+		}
+	}
+
+	if c.remain != nil {
+		*c.remain(dto) = c.remainAttrs(m)
+	}
+
+	if c.after != nil {
+		if err := c.after(dto, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remainAttrs атрибуты, не разобранные в поля, строками. Вложенные объекты пропускаются.
+func (c entryCodec[T]) remainAttrs(m map[string]any) map[string][]string {
+	attrs := make(map[string][]string)
+
+	for key, v := range m {
+		if c.hasField(key) {
+			continue
+		}
+
+		values := make([]string, 0)
+
+		for _, item := range attrValues(v) {
+			if str, ok := attrString(item); ok {
+				values = append(values, str)
+			}
+		}
+
+		if len(values) > 0 {
+			attrs[key] = values
+		}
+	}
+
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	return attrs
+}
+
+func (c entryCodec[T]) hasField(attr string) bool {
+	for _, field := range c.fields {
+		if field.attr == attr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scalarAttr однозначный атрибут: несколько значений - ошибка, а не молча первое
+func scalarAttr[T, V any](attr string, ptr func(*T) *V, parse func(any) (V, error)) entryField[T] {
+	return entryField[T]{
+		attr: attr,
+		decode: func(dto *T, values []any) error {
+			if len(values) > 1 {
+				return fmt.Errorf("multi-valued attribute %s (%d values)", attr, len(values))
+			}
+
+			return decodeFirst(attr, ptr(dto), values, parse)
+		},
+	}
+}
+
+// firstAttr атрибут, у которого нужно только первое значение (mail, cn, ...)
+func firstAttr[T, V any](attr string, ptr func(*T) *V, parse func(any) (V, error)) entryField[T] {
+	return entryField[T]{
+		attr: attr,
+		decode: func(dto *T, values []any) error {
+			return decodeFirst(attr, ptr(dto), values, parse)
+		},
+	}
+}
+
+// listAttr многозначный атрибут
+func listAttr[T, V any](attr string, ptr func(*T) *[]V, parse func(any) (V, error)) entryField[T] {
+	return entryField[T]{
+		attr: attr,
+		decode: func(dto *T, values []any) error {
+			result := make([]V, len(values))
+
+			for i, v := range values {
+				parsed, err := parse(v)
+				if err != nil {
+					return fmt.Errorf("%w (%s[%d])", err, attr, i)
+				}
+
+				result[i] = parsed
+			}
+
+			*ptr(dto) = result
+
+			return nil
+		},
+	}
+}
+
+func decodeFirst[V any](attr string, dst *V, values []any, parse func(any) (V, error)) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	parsed, err := parse(values[0])
+	if err != nil {
+		return fmt.Errorf("%w (%s)", err, attr)
+	}
+
+	*dst = parsed
+
+	return nil
+}
+
+// attrValues значения атрибута с раскрытыми кодировками, скаляр становится срезом из одного значения
+func attrValues(src any) []any {
+	list, ok := src.([]any)
+	if !ok {
+		return []any{unwrapValue(src)}
+	}
+
+	result := make([]any, len(list))
+	for i, v := range list {
+		result[i] = unwrapValue(v)
+	}
+
+	return result
+}
+
+// unwrapValue {"__datetime__"} -> time.Time, {"__base64__"} -> []byte, {"__dns_name__"} -> string
+func unwrapValue(src any) any {
+	m, ok := src.(map[string]any)
+	if !ok || len(m) != 1 {
+		return src
+	}
+
+	if v, ok := m["__datetime__"].(string); ok {
+		if t, err := time.Parse(timeLayout, v); err == nil {
+			return t
+		}
+	}
+	if v, ok := m["__base64__"].(string); ok {
+		if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+			return b
+		}
+	}
+	if v, ok := m["__dns_name__"].(string); ok {
+		return v
+	}
+
+	return src
+}
+
+// unwrapAll unwrapValue на всю глубину
+func unwrapAll(src any) any {
+	switch v := unwrapValue(src).(type) {
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = unwrapAll(item)
+		}
+
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			result[k] = unwrapAll(item)
+		}
+
+		return result
+	default:
+		return v
+	}
+}
+
+// attrString строковое представление значения атрибута, двоичные - в base64
+func attrString(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case []byte:
+		return base64.StdEncoding.EncodeToString(val), true
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(val)), true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case time.Time:
+		return val.Format(timeLayout), true
+	default:
+		return "", false
+	}
+}
+
+// parseString строка как есть, двоичное значение - его содержимое
+func parseString(v any) (string, error) {
+	if b, ok := v.([]byte); ok {
+		return string(b), nil
+	}
+
+	str, ok := attrString(v)
+	if !ok {
+		return "", decodeError(v, "string")
+	}
+
+	return str, nil
+}
+
+// parseBool LDAP отдает булевы атрибуты строками TRUE/FALSE
+func parseBool(v any) (bool, error) {
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.ToLower(val)); err == nil {
+			return b, nil
+		}
+	}
+
+	return false, decodeError(v, "bool")
+}
+
+// parseInt числовые атрибуты IPA часто отдает строками ("uidnumber": ["371000000"])
+func parseInt(v any) (int, error) {
+	switch val := v.(type) {
+	case float64:
+		return int(val), nil
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(val)); err == nil {
+			return n, nil
+		}
+	}
+
+	return 0, decodeError(v, "int")
+}
+
+func parseBoolPtr(v any) (*bool, error) {
+	b, err := parseBool(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+func parseIntPtr(v any) (*int, error) {
+	n, err := parseInt(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+func parseTime(v any) (time.Time, error) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, nil
+	case string:
+		for _, layout := range []string{timeLayout, time.RFC3339} {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	return time.Time{}, decodeError(v, "time")
+}
+
+// parseBase64 двоичное значение: {"__base64__"} или строка в base64 (cert_show отдает certificate так)
+func parseBase64(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		b, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode base64: %w", err)
+		}
+
+		return b, nil
+	default:
+		return nil, decodeError(v, "bytes")
+	}
+}
+
+func parseBase64String(v any) (string, error) {
+	b, err := parseBase64(v)
+
+	return string(b), err
+}
+
+// parseHexInt число в hex ("0x1F"), например serial_number_hex
+func parseHexInt(v any) (*big.Int, error) {
+	str, err := parseString(v)
+	if err != nil {
+		return nil, err
+	}
+
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(str), "0x"), 16) //nolint:mnd // hex
+	if !ok {
+		return nil, fmt.Errorf("invalid hex number %q", str)
+	}
+
+	return n, nil
+}
+
+func decodeError(v any, typ string) error {
+	return fmt.Errorf("cannot decode %T into %s", v, typ)
+}
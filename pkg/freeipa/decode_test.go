@@ -0,0 +1,128 @@
+package freeipa
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	t.Parallel()
+
+	type account struct {
+		UID        []string    `json:"uid"`
+		UIDNumber  []string    `json:"uidnumber"`
+		Locked     bool        `json:"nsaccountlock"`
+		Expiration []time.Time `json:"krbpasswordexpiration"`
+		Photo      [][]byte    `json:"jpegphoto"`
+		Zone       []string    `json:"idnsname"`
+	}
+
+	src := `{
+		"uid": ["alice"],
+		"uidnumber": ["371000005"],
+		"nsaccountlock": true,
+		"krbpasswordexpiration": [{"__datetime__": "20300102030405Z"}],
+		"jpegphoto": [{"__base64__": "cGhvdG8="}],
+		"idnsname": [{"__dns_name__": "example.test."}]
+	}`
+
+	var raw any
+	require.NoError(t, json.Unmarshal([]byte(src), &raw))
+
+	var actual account
+	require.NoError(t, decodeJSON(raw, &actual))
+	require.Equal(t, account{
+		UID:        []string{"alice"},
+		UIDNumber:  []string{"371000005"},
+		Locked:     true,
+		Expiration: []time.Time{time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)},
+		Photo:      [][]byte{[]byte("photo")},
+		Zone:       []string{"example.test."},
+	}, actual)
+
+	var list []account
+	require.NoError(t, decodeJSON([]any{map[string]any{"uid": []any{"bob"}}}, &list))
+	require.Equal(t, []account{{UID: []string{"bob"}}}, list)
+
+	require.Error(t, decodeJSON(raw, account{}))
+}
+
+func TestDecodeEntry(t *testing.T) {
+	t.Parallel()
+
+	src := `{
+		"uid": ["alice"],
+		"givenname": ["Alice", "Alicia"],
+		"sn": ["Smith", "Smyth"],
+		"cn": ["Alice Smith", "Alicia Smyth"],
+		"dn": "uid=alice,cn=staged users,cn=accounts,cn=provisioning,dc=example,dc=test",
+		"mail": ["alice@example.test", "a@example.test"],
+		"memberof_group": ["ipausers", "admins"],
+		"krbpasswordexpiration": [{"__datetime__": "20300102030405Z"}],
+		"jpegphoto": [{"__base64__": "cGhvdG8="}],
+		"usercertificate": [{"__base64__": "ZGVy"}],
+		"employeetype": ["contractor"],
+		"krbextradata": [{"__base64__": "AAI="}],
+		"attributelevelrights": {"uid": "rscwo"}
+	}`
+
+	var raw any
+	require.NoError(t, json.Unmarshal([]byte(src), &raw))
+
+	// имя, фамилия и ФИО в LDAP многозначные, берется первое значение
+	user, err := decodeEntry(raw, userCodec)
+	require.NoError(t, err)
+	require.Equal(t, User{
+		UID:                   "alice",
+		GivenName:             "Alice",
+		SN:                    "Smith",
+		CN:                    "Alice Smith",
+		DN:                    "uid=alice,cn=staged users,cn=accounts,cn=provisioning,dc=example,dc=test",
+		Mail:                  "alice@example.test",
+		MemberOfGroup:         []string{"ipausers", "admins"},
+		KRBPasswordExpiration: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		JPEGPhoto:             "photo",
+		Staged:                true,
+		Certificates:          [][]byte{[]byte("der")},
+		Attrs: map[string][]string{
+			"employeetype": {"contractor"},
+			"krbextradata": {"AAI="},
+		},
+	}, user)
+
+	// однозначный атрибут с несколькими значениями - ошибка, а не молча первое
+	_, err = decodeEntry(map[string]any{"cn": []any{"a", "b"}}, groupCodec)
+	require.EqualError(t, err, "failed to parse response: multi-valued attribute cn (2 values)")
+
+	_, err = decodeEntry(map[string]any{"gidnumber": []any{"abc"}}, groupCodec)
+	require.EqualError(t, err, "failed to parse response: cannot decode string into int (gidnumber)")
+
+	cert, err := decodeEntry(map[string]any{
+		"serial_number_hex": "0x1F",
+		"owner_user":        []any{"alice"},
+		"owner_host":        []any{"web.example.test"},
+	}, certificateCodec)
+	require.NoError(t, err)
+	require.Equal(t, int64(31), cert.SerialNumber.Int64())
+	require.Equal(t, []string{"alice", "web.example.test"}, cert.Owners)
+
+	record, err := decodeEntry(map[string]any{
+		"idnsname":  []any{map[string]any{"__dns_name__": "_ldap._tcp"}},
+		"srvrecord": []any{"0 100 389 ipa.example.test."},
+	}, dnsRecordCodec)
+	require.NoError(t, err)
+	require.Equal(t, DNSRecord{
+		Name: "_ldap._tcp",
+		SRV:  []SRVRecord{{Priority: 0, Weight: 100, Port: 389, Target: "ipa.example.test."}},
+	}, record)
+
+	_, err = decodeEntry(map[string]any{"srvrecord": []any{"389 ipa"}}, dnsRecordCodec)
+	require.Error(t, err)
+
+	token, err := decodeEntry(map[string]any{"type": "TOTP"}, otpTokenCodec)
+	require.NoError(t, err)
+	require.Equal(t, OTPTokenTOTP, token.Type)
+}
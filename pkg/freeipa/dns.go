@@ -0,0 +1,270 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	keyDNSTTL = "dnsttl"
+
+	// DNSZoneApex имя записи вершины зоны (NS, MX зоны и т.п.)
+	DNSZoneApex = "@"
+)
+
+// zones
+
+func (f *FreeIPA) GetDNSZones(ctx context.Context) (int, []DNSZone, error) {
+	statusCode, entries, err := f.findEntries(ctx, "dnszone_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	zones, err := decodeEntries(entries, dnsZoneCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, zones, nil
+}
+
+// GetDNSZone имя можно указывать и без точки на конце
+func (f *FreeIPA) GetDNSZone(ctx context.Context, name string) (int, *DNSZone, error) {
+	return f.sendDNSZoneRPC(ctx, "dnszone_show", name, map[string]any{"all": true})
+}
+
+// CreateDNSZone SOA и NS по умолчанию берутся от сервера IPA, вершина зоны (@) создается сразу
+func (f *FreeIPA) CreateDNSZone(ctx context.Context, reqZone RequestDNSZone) (int, *DNSZone, error) {
+	opts := reqZone.toOpts()
+	if reqZone.Force {
+		opts["force"] = true
+	}
+
+	return f.sendDNSZoneRPC(ctx, "dnszone_add", reqZone.Name, opts)
+}
+
+func (f *FreeIPA) UpdateDNSZone(ctx context.Context, reqZone RequestDNSZone) (int, *DNSZone, error) {
+	return f.sendDNSZoneRPC(ctx, "dnszone_mod", reqZone.Name, reqZone.toOpts())
+}
+
+// DeleteDNSZone удаляет зону вместе со всеми записями
+func (f *FreeIPA) DeleteDNSZone(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "dnszone_del", name)
+}
+
+func (f *FreeIPA) sendDNSZoneRPC(ctx context.Context, method, name string, opts map[string]any) (int, *DNSZone, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	zone, err := decodeEntry(entry, dnsZoneCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &zone, nil
+}
+
+// records
+
+// FindDNSRecords записи зоны, criteria - подстрока имени (пустая - все, включая вершину зоны).
+// Выборка, обрезанная сервером (лимит LDAP), - ошибка ErrSizeLimitExceeded.
+func (f *FreeIPA) FindDNSRecords(ctx context.Context, zone, criteria string) (int, []DNSRecord, error) {
+	args := rpcArgs(zone)
+	if criteria != "" {
+		args = rpcArgs(zone, criteria)
+	}
+
+	opts := map[string]any{
+		"all":       true,
+		"sizelimit": 0, // без него IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "dnsrecord_find", args, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+	if resp.Result.Truncated {
+		return 0, nil, newTruncatedError("dnsrecord_find", resp.Result.Count)
+	}
+
+	records := make([]DNSRecord, 0)
+
+	if resp.Result.Result != nil {
+		if records, err = decodeList(resp.Result.Result, dnsRecordCodec); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return statusCode, records, nil
+}
+
+func (f *FreeIPA) GetDNSRecord(ctx context.Context, zone, name string) (int, *DNSRecord, error) {
+	return f.sendDNSRecordRPC(ctx, "dnsrecord_show", zone, name, map[string]any{"all": true})
+}
+
+// AddDNSRecord добавляет значения к записи record.Name (создает ее при необходимости), TTL 0 не меняется.
+// Уже существующие значения не ошибка.
+func (f *FreeIPA) AddDNSRecord(ctx context.Context, zone string, record DNSRecord) (int, *DNSRecord, error) {
+	opts := record.toOpts()
+	if len(opts) == 0 {
+		return 0, nil, errors.New("record values are empty")
+	}
+	if record.TTL > 0 {
+		opts[keyDNSTTL] = record.TTL
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "dnsrecord_add", rpcArgs(zone, record.Name), opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		// все значения уже есть (EmptyModlist замьючен), отдаем запись как есть
+		return f.GetDNSRecord(ctx, zone, record.Name)
+	}
+
+	entry, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	added, err := decodeEntry(entry, dnsRecordCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &added, nil
+}
+
+// RemoveDNSRecord удаляет значения записи record.Name, запись без значений удаляется целиком
+func (f *FreeIPA) RemoveDNSRecord(ctx context.Context, zone string, record DNSRecord) (int, error) {
+	opts := record.toOpts()
+	if len(opts) == 0 {
+		return 0, errors.New("record values are empty")
+	}
+
+	statusCode, _, err := f.sendRPC(ctx, "dnsrecord_del", rpcArgs(zone, record.Name), opts)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// DeleteDNSRecord удаляет все значения записи
+func (f *FreeIPA) DeleteDNSRecord(ctx context.Context, zone, name string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "dnsrecord_del", rpcArgs(zone, name), map[string]any{"del_all": true})
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+func (f *FreeIPA) sendDNSRecordRPC(
+	ctx context.Context,
+	method, zone, name string,
+	opts map[string]any,
+) (int, *DNSRecord, error) {
+	statusCode, resp, err := f.sendRPC(ctx, method, rpcArgs(zone, name), opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	entry, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	record, err := decodeEntry(entry, dnsRecordCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &record, nil
+}
+
+// toOpts значения записи по типам, пустые не передаются
+func (r DNSRecord) toOpts() map[string]any {
+	srv := make([]string, len(r.SRV))
+	for i, v := range r.SRV {
+		srv[i] = v.String()
+	}
+
+	opts := map[string]any{}
+
+	for key, values := range map[string][]string{
+		"arecord":     r.A,
+		"aaaarecord":  r.AAAA,
+		"cnamerecord": r.CNAME,
+		"ptrrecord":   r.PTR,
+		"srvrecord":   srv,
+		"txtrecord":   r.TXT,
+	} {
+		if len(values) > 0 {
+			putListOpt(opts, key, values)
+		}
+	}
+
+	return opts
+}
+
+// toOpts опции dnszone_add/dnszone_mod
+func (r RequestDNSZone) toOpts() map[string]any {
+	opts := map[string]any{}
+
+	putOpt(opts, "idnssoamname", r.SOAMName)
+	putOpt(opts, "idnssoarname", r.SOARName)
+	putOpt(opts, "idnssoarefresh", r.SOARefresh)
+	putOpt(opts, "idnssoaretry", r.SOARetry)
+	putOpt(opts, "idnssoaexpire", r.SOAExpire)
+	putOpt(opts, "idnssoaminimum", r.SOAMinimum)
+	putOpt(opts, "dnsttl", r.TTL)
+	putOpt(opts, "idnsallowdynupdate", r.AllowDynUpdate)
+
+	return opts
+}
+
+// String значение srvrecord
+func (r SRVRecord) String() string {
+	return strings.Join([]string{
+		strconv.Itoa(int(r.Priority)), strconv.Itoa(int(r.Weight)), strconv.Itoa(int(r.Port)), r.Target,
+	}, " ")
+}
+
+func (r SRVRecord) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText "0 100 389 ipa.example.test."
+func (r *SRVRecord) UnmarshalText(text []byte) error {
+	fields := strings.Fields(string(text))
+	if len(fields) != 4 { //nolint:mnd // priority weight port target
+		return fmt.Errorf("invalid srv record %q", text)
+	}
+
+	nums := make([]uint16, 3) //nolint:mnd // priority weight port
+
+	for i := range nums {
+		n, err := strconv.ParseUint(fields[i], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid srv record %q: %w", text, err)
+		}
+
+		nums[i] = uint16(n)
+	}
+
+	*r = SRVRecord{Priority: nums[0], Weight: nums[1], Port: nums[2], Target: fields[3]}
+
+	return nil
+}
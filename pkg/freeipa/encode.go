@@ -0,0 +1,35 @@
+package freeipa
+
+import (
+	"time"
+)
+
+// Опции jsonRPC-запросов собираются методами to*Opts у Request-структур (как RequestGroup.toModOpts).
+// Общее правило: nil-указатели и nil-срезы не передаются (поле не меняется),
+// пустой не nil срез передается - очистка атрибута.
+
+// putOpt значение по указателю, nil - опция не передается
+func putOpt[V any](opts map[string]any, key string, v *V) {
+	if v != nil {
+		opts[key] = *v
+	}
+}
+
+// putListOpt nil - опция не передается, пустой срез - очистка атрибута
+func putListOpt[V any](opts map[string]any, key string, values []V) {
+	if values == nil {
+		return
+	}
+
+	list := make([]any, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+
+	opts[key] = list
+}
+
+// datetimeOpt время в кодировке IPA
+func datetimeOpt(t time.Time) map[string]any {
+	return map[string]any{"__datetime__": t.UTC().Format(timeLayout)}
+}
@@ -0,0 +1,47 @@
+package freeipa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeOpts(t *testing.T) {
+	t.Parallel()
+
+	mail := "alice@example.test"
+	locked := true
+	expiration := time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("MSK", 3*60*60))
+
+	opts, err := RequestUser{
+		UID:                   "alice",
+		GivenName:             "Alice",
+		SN:                    "Smith",
+		Mail:                  &mail,
+		KRBPasswordExpiration: &expiration,
+		NsAccountLock:         &locked,
+		AddAttr:               []string{"employeetype=contractor"},
+	}.toAddOpts()
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"givenname":             "Alice",
+		"sn":                    "Smith",
+		"mail":                  "alice@example.test",
+		"krbpasswordexpiration": map[string]any{"__datetime__": "20300102000405Z"},
+		"nsaccountlock":         true,
+		"addattr":               []any{"employeetype=contractor"},
+		"random":                true,
+	}, opts)
+
+	// nil - не менять, пустой срез - очистить атрибут
+	opts = RequestPermission{CN: "p", Rights: []string{}, Attrs: []string{"mail"}}.toOpts()
+	require.Equal(t, map[string]any{"ipapermright": []any{}, "attrs": []any{"mail"}}, opts)
+
+	opts = DNSRecord{
+		Name: "_ldap._tcp",
+		TTL:  300,
+		SRV:  []SRVRecord{{Weight: 100, Port: 389, Target: "ipa.example.test."}},
+	}.toOpts()
+	require.Equal(t, map[string]any{"srvrecord": []any{"0 100 389 ipa.example.test."}}, opts)
+}
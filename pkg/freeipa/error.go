@@ -0,0 +1,237 @@
+package freeipa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/volodya-nrg/tools/pkg/errors/custom"
+)
+
+// коды ошибок IPA (ipalib/errors.py)
+const (
+	ErrCodeCommand             = 905
+	ErrCodeAuthentication      = 1000
+	ErrCodeInvalidSessionPass  = 1201
+	ErrCodePasswordExpired     = 1202
+	ErrCodeKrbPrincipalExpired = 1203
+	ErrCodeUserLocked          = 1204
+	ErrCodeAuthorization       = 2000
+	ErrCodeACI                 = 2100
+	ErrCodeInvocation          = 3000
+	ErrCodeMaxArgument         = 3004
+	ErrCodeOption              = 3005
+	ErrCodeRequirement         = 3007
+	ErrCodeConversion          = 3008
+	ErrCodeValidation          = 3009
+	ErrCodePasswordMismatch    = 3011
+	ErrCodeNotFound            = 4001
+	ErrCodeDuplicateEntry      = 4002
+	ErrCodeAlreadyActive       = 4009
+	ErrCodeAlreadyInactive     = 4010
+	ErrCodeNotGroupMember      = 4012
+	ErrCodeAlreadyGroupMember  = 4014
+	ErrCodeAttrValueNotFound   = 4026
+	ErrCodeEmptyModlist        = 4202
+	ErrCodeDatabase            = 4203
+	ErrCodeLimitsExceeded      = 4204
+	ErrCodeDatabaseTimeout     = 4211
+	ErrCodeSizeLimitExceeded   = 4214
+	ErrCodeCertificate         = 4300
+	ErrCodeCertificateOp       = 4301
+	ErrCodeMutuallyExclusive   = 4303
+	ErrCodeDependentEntry      = 4307
+	ErrCodeLastMember          = 4308
+	ErrCodeProtectedEntry      = 4309
+)
+
+// Сентинелы для errors.Is, сравнение идет по коду.
+// ErrPasswordPolicy отдельный случай: IPA отдает нарушение политики паролей как DatabaseError
+// ("Constraint violation: Password is too short"), поэтому он сверяется еще и по тексту.
+var (
+	ErrNotFound           = &Error{Code: ErrCodeNotFound, Name: "NotFound"}
+	ErrDuplicateEntry     = &Error{Code: ErrCodeDuplicateEntry, Name: "DuplicateEntry"}
+	ErrACI                = &Error{Code: ErrCodeACI, Name: "ACIError"}
+	ErrEmptyModlist       = &Error{Code: ErrCodeEmptyModlist, Name: "EmptyModlist"}
+	ErrAttrValueNotFound  = &Error{Code: ErrCodeAttrValueNotFound, Name: "AttrValueNotFound"}
+	ErrAlreadyGroupMember = &Error{Code: ErrCodeAlreadyGroupMember, Name: "AlreadyGroupMember"}
+	ErrNotGroupMember     = &Error{Code: ErrCodeNotGroupMember, Name: "NotGroupMember"}
+	ErrAlreadyActive      = &Error{Code: ErrCodeAlreadyActive, Name: "AlreadyActive"}
+	ErrAlreadyInactive    = &Error{Code: ErrCodeAlreadyInactive, Name: "AlreadyInactive"}
+	ErrValidation         = &Error{Code: ErrCodeValidation, Name: "ValidationError"}
+	ErrRequirement        = &Error{Code: ErrCodeRequirement, Name: "RequirementError"}
+	ErrInvalidPassword    = &Error{Code: ErrCodeInvalidSessionPass, Name: "InvalidSessionPassword"}
+	ErrPasswordExpired    = &Error{Code: ErrCodePasswordExpired, Name: "PasswordExpired"}
+	ErrPrincipalExpired   = &Error{Code: ErrCodeKrbPrincipalExpired, Name: "KrbPrincipalExpired"}
+	ErrUserLocked         = &Error{Code: ErrCodeUserLocked, Name: "UserLocked"}
+	ErrPasswordPolicy     = &Error{Code: ErrCodeDatabase, Name: "PasswordPolicy"}
+	ErrMutuallyExclusive  = &Error{Code: ErrCodeMutuallyExclusive, Name: "MutuallyExclusiveError"}
+	ErrCertificateOp      = &Error{Code: ErrCodeCertificateOp, Name: "CertificateOperationError"}
+	ErrCommand            = &Error{Code: ErrCodeCommand, Name: "CommandError"}
+	ErrOption             = &Error{Code: ErrCodeOption, Name: "OptionError"}
+	ErrMaxArgument        = &Error{Code: ErrCodeMaxArgument, Name: "MaxArgumentError"}
+	ErrSizeLimitExceeded  = &Error{Code: ErrCodeSizeLimitExceeded, Name: "SizeLimitExceeded"}
+)
+
+// Error ошибка, которую вернул сервер IPA: json-error ответа или элемент batch-а
+type Error struct {
+	Code    int
+	Name    string
+	Message string
+	Data    map[string]any
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Name != "" {
+		return e.Name
+	}
+
+	return fmt.Sprintf("freeipa error %d", e.Code)
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error) //nolint:errorlint // сравниваем именно с сентинелом
+	if !ok {
+		return false
+	}
+	if t == ErrPasswordPolicy {
+		return e.isPasswordPolicy()
+	}
+
+	return t.Code == e.Code
+}
+
+// GRPCCode соответствие ошибки IPA коду gRPC
+func (e *Error) GRPCCode() codes.Code {
+	if e.isPasswordPolicy() {
+		return codes.InvalidArgument
+	}
+
+	//nolint:mnd
+	switch {
+	case e.Code == ErrCodeNotFound, e.Code == ErrCodeAttrValueNotFound:
+		return codes.NotFound
+	case e.Code == ErrCodeDuplicateEntry, e.Code == ErrCodeAlreadyGroupMember:
+		return codes.AlreadyExists
+	case e.Code == ErrCodeNotGroupMember, e.Code == ErrCodeEmptyModlist,
+		e.Code == ErrCodeAlreadyActive, e.Code == ErrCodeAlreadyInactive,
+		e.Code == ErrCodeDependentEntry, e.Code == ErrCodeLastMember, e.Code == ErrCodeProtectedEntry,
+		e.Code == ErrCodeMutuallyExclusive, e.Code == ErrCodeCertificateOp:
+		return codes.FailedPrecondition
+	case e.Code == ErrCodeLimitsExceeded, e.Code == ErrCodeSizeLimitExceeded:
+		return codes.ResourceExhausted
+	case e.Code == ErrCodeDatabaseTimeout:
+		return codes.DeadlineExceeded
+	case e.Code >= ErrCodeAuthentication && e.Code < ErrCodeAuthorization:
+		return codes.Unauthenticated
+	case e.Code >= ErrCodeAuthorization && e.Code < ErrCodeInvocation:
+		return codes.PermissionDenied
+	case e.Code == ErrCodeCommand, e.Code >= ErrCodeInvocation && e.Code < 4000:
+		return codes.InvalidArgument
+	default:
+		return codes.Internal
+	}
+}
+
+func (e *Error) isPasswordPolicy() bool {
+	if e.Code != ErrCodeDatabase {
+		return false
+	}
+	if e.Name == ErrPasswordPolicy.Name { // policy-error от change_password
+		return true
+	}
+
+	return strings.Contains(e.Message, "Constraint violation") &&
+		strings.Contains(strings.ToLower(e.Message), "password")
+}
+
+// ToCustomError приводит результат метода FreeIPA (statusCode, err) к custom.CustomError,
+// чтобы gRPC-обработчик отдал правильный статус. Если в цепочке есть Error, то код берется из него,
+// иначе из http-статуса. Для err == nil отдается nil.
+func ToCustomError(statusCode int, err error) *custom.CustomError {
+	if err == nil {
+		return nil
+	}
+
+	var ipaErr *Error
+	if errors.As(err, &ipaErr) {
+		return custom.NewCustomError(err, ipaErr.GRPCCode(), ipaErr.Error())
+	}
+
+	code := codes.Internal
+
+	switch statusCode {
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	}
+
+	return custom.NewCustomError(err, code, "")
+}
+
+// newTruncatedError ответ *_find обрезан лимитом сервера (truncated), хотя нужны были все записи
+func newTruncatedError(method string, count uint32) *Error {
+	return &Error{
+		Code:    ErrSizeLimitExceeded.Code,
+		Name:    ErrSizeLimitExceeded.Name,
+		Message: fmt.Sprintf("%s: result truncated after %d entries", method, count),
+	}
+}
+
+// newRejectionError ошибка по заголовку X-IPA-Rejection-Reason отказа во входе, nil если причина не указана
+func newRejectionError(reason string) *Error {
+	var target *Error
+
+	switch reason {
+	case "":
+		return nil
+	case "invalid-password":
+		target = ErrInvalidPassword
+	case "password-expired":
+		target = ErrPasswordExpired
+	case "krbprincipal-expired":
+		target = ErrPrincipalExpired
+	case "user-locked":
+		target = ErrUserLocked
+	default: // denied и прочее
+		target = &Error{Code: ErrCodeAuthentication, Name: "AuthenticationError"}
+	}
+
+	return &Error{
+		Code:    target.Code,
+		Name:    target.Name,
+		Message: "login rejected: " + reason,
+	}
+}
+
+func newErrorFromResponse(respErr *responseError) *Error {
+	return &Error{
+		Code:    respErr.Code,
+		Name:    respErr.Name,
+		Message: respErr.Message,
+		Data:    respErr.Data,
+	}
+}
+
+// err ошибка элемента batch-а, nil если элемент успешный
+func (r responseItem) err() error {
+	if r.Error == "" && r.ErrorCode == 0 {
+		return nil
+	}
+
+	return &Error{
+		Code:    int(r.ErrorCode),
+		Name:    r.ErrorName,
+		Message: r.Error,
+		Data:    r.ErrorKw,
+	}
+}
@@ -5,4 +5,6 @@ const (
 	errMsgFailedToCreateJSONRPCRequest = "failed to create jsonrpc-request"
 	errMsgResponseResultIsNil          = "response result is nil"
 	errMsgFailedToParseResponse        = "failed to parse response"
+	errMsgFailedToEncodeOptions        = "failed to encode options"
+	errMsgNoServers                    = "no freeipa servers"
 )
@@ -0,0 +1,112 @@
+package freeipa
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHandleResponseError(t *testing.T) {
+	t.Parallel()
+
+	f := NewFreeIPA("https", "ipa.example.com", &http.Transport{}, 0)
+
+	tests := []struct {
+		name           string
+		statusCodeSrc  int
+		body           string
+		statusExpected int
+		sentinel       error
+		grpcCode       codes.Code
+	}{
+		{
+			name:           "not found",
+			statusCodeSrc:  http.StatusOK,
+			body:           `{"result":null,"error":{"code":4001,"name":"NotFound","message":"u: user not found","data":{"reason":"u: user not found"}}}`, //nolint:lll
+			statusExpected: http.StatusNotFound,
+			sentinel:       ErrNotFound,
+			grpcCode:       codes.NotFound,
+		},
+		{
+			name:           "duplicate",
+			statusCodeSrc:  http.StatusOK,
+			body:           `{"result":null,"error":{"code":4002,"name":"DuplicateEntry","message":"user with name \"u\" already exists","data":{}}}`, //nolint:lll
+			statusExpected: 0,
+			sentinel:       ErrDuplicateEntry,
+			grpcCode:       codes.AlreadyExists,
+		},
+		{
+			name:           "aci",
+			statusCodeSrc:  http.StatusOK,
+			body:           `{"result":null,"error":{"code":2100,"name":"ACIError","message":"Insufficient access","data":{"info":"x"}}}`,
+			statusExpected: 0,
+			sentinel:       ErrACI,
+			grpcCode:       codes.PermissionDenied,
+		},
+		{
+			name:           "unknown command",
+			statusCodeSrc:  http.StatusOK,
+			body:           `{"result":null,"error":{"code":905,"name":"CommandError","message":"unknown command 'x'","data":{}}}`,
+			statusExpected: 0,
+			sentinel:       ErrCommand,
+			grpcCode:       codes.InvalidArgument,
+		},
+		{
+			name:           "password policy",
+			statusCodeSrc:  http.StatusOK,
+			body:           `{"result":null,"error":{"code":4203,"name":"DatabaseError","message":"Constraint violation: Password is too short","data":{"desc":"Constraint violation","info":"Password is too short"}}}`, //nolint:lll
+			statusExpected: 0,
+			sentinel:       ErrPasswordPolicy,
+			grpcCode:       codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			statusCode, _, err := f.handleResponse(tt.statusCodeSrc, []byte(tt.body))
+			require.Error(t, err)
+			require.Equal(t, tt.statusExpected, statusCode)
+			require.ErrorIs(t, err, tt.sentinel)
+
+			var ipaErr *Error
+			require.ErrorAs(t, err, &ipaErr)
+			require.NotEmpty(t, ipaErr.Name)
+			require.Equal(t, tt.grpcCode, ToCustomError(statusCode, err).GetCode())
+		})
+	}
+
+	// 4202 (нет изменений) глушится
+	statusCode, _, err := f.handleResponse(http.StatusOK, []byte(`{"result":null,"error":{"code":4202,"name":"EmptyModlist","message":"no modifications to be performed"}}`)) //nolint:lll
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, statusCode)
+
+	// обычный DatabaseError не является нарушением политики паролей
+	require.NotErrorIs(t, &Error{Code: ErrCodeDatabase, Message: "Server is unwilling to perform"}, ErrPasswordPolicy)
+}
+
+func TestResponseItemErr(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, responseItem{}.err())
+
+	err := responseItem{
+		Error:     "r: role not found",
+		ErrorCode: ErrCodeNotFound,
+		ErrorName: "NotFound",
+		ErrorKw:   map[string]any{"reason": "r: role not found"},
+	}.err()
+	require.ErrorIs(t, err, ErrNotFound)
+	require.EqualError(t, err, "r: role not found")
+}
+
+func TestToCustomError(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, ToCustomError(http.StatusOK, nil))
+	require.Equal(t, codes.Unauthenticated, ToCustomError(http.StatusUnauthorized, errors.New("x")).GetCode())
+	require.Equal(t, codes.Internal, ToCustomError(0, errors.New("x")).GetCode())
+}
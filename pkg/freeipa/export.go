@@ -0,0 +1,318 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const exportPageSize = 100
+
+// userRecordEntryCodec запись user_show в UserRecord, многозначные атрибуты - первое значение, как у userCodec
+var userRecordEntryCodec = entryCodec[UserRecord]{
+	fields: []entryField[UserRecord]{
+		scalarAttr("uid", func(r *UserRecord) *string { return &r.UID }, parseString),
+		scalarAttr("dn", func(r *UserRecord) *string { return &r.DN }, parseString),
+		firstAttr("givenname", func(r *UserRecord) *string { return &r.GivenName }, parseString),
+		firstAttr("sn", func(r *UserRecord) *string { return &r.SN }, parseString),
+		firstAttr("cn", func(r *UserRecord) *string { return &r.CN }, parseString),
+		firstAttr("mail", func(r *UserRecord) *string { return &r.Mail }, parseString),
+		firstAttr("telephonenumber", func(r *UserRecord) *string { return &r.TelephoneNumber }, parseString),
+		firstAttr("mobile", func(r *UserRecord) *string { return &r.Mobile }, parseString),
+		firstAttr("title", func(r *UserRecord) *string { return &r.Title }, parseString),
+		firstAttr("ou", func(r *UserRecord) *string { return &r.OrgUnit }, parseString),
+		scalarAttr("nsaccountlock", func(r *UserRecord) **bool { return &r.Disabled }, parseBoolPtr),
+		listAttr("memberof_group", func(r *UserRecord) *[]string { return &r.Groups }, parseString),
+		listAttr("memberof_role", func(r *UserRecord) *[]string { return &r.Roles }, parseString),
+	},
+}
+
+var roleRecordEntryCodec = entryCodec[RoleRecord]{
+	fields: []entryField[RoleRecord]{
+		scalarAttr("cn", func(r *RoleRecord) *string { return &r.Name }, parseString),
+		scalarAttr("dn", func(r *RoleRecord) *string { return &r.DN }, parseString),
+		scalarAttr("description", func(r *RoleRecord) *string { return &r.Description }, parseString),
+		listAttr("member_user", func(r *RoleRecord) *[]string { return &r.Users }, parseString),
+		listAttr("memberof_privilege", func(r *RoleRecord) *[]string { return &r.Privileges }, parseString),
+	},
+}
+
+// ExportUsers выгружает всех пользователей в w потоком. user_find не умеет смещение, поэтому сначала
+// берутся uid (pkey_only), а записи дочитываются страницами по exportPageSize через batch user_show --all.
+// Если сервер все же обрезал выборку (лимит LDAP), то это ошибка ErrSizeLimitExceeded, а не неполная выгрузка.
+func (f *FreeIPA) ExportUsers(ctx context.Context, w io.Writer, format ExportFormat) (int, error) {
+	writer, err := newRecordWriter(w, format, userRecordCodec)
+	if err != nil {
+		return 0, err
+	}
+
+	opts := map[string]any{
+		"pkey_only": true,
+		"sizelimit": 0, // без него IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "user_find", "", opts)
+	if err != nil {
+		return statusCode, err
+	}
+	if resp.Result == nil {
+		return 0, errors.New(errMsgResponseResultIsNil)
+	}
+	if resp.Result.Truncated {
+		return 0, newTruncatedError("user_find", resp.Result.Count)
+	}
+
+	users := make([]User, 0)
+
+	if resp.Result.Result != nil {
+		if users, err = decodeList(resp.Result.Result, userCodec); err != nil {
+			return 0, err
+		}
+	}
+
+	for page := range slices.Chunk(users, exportPageSize) {
+		uids := make([]string, len(page))
+
+		for i, user := range page {
+			uids[i] = user.UID
+		}
+
+		newStatusCode, entries, err := f.showEntries(ctx, "user_show", uids, false)
+		if err != nil {
+			return newStatusCode, err
+		}
+
+		if err = writeRecords(writer, entries, userRecordEntryCodec); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return 0, err
+	}
+
+	return statusCode, nil
+}
+
+// ExportRoles выгружает все роли с участниками-пользователями и привилегиями
+func (f *FreeIPA) ExportRoles(ctx context.Context, w io.Writer, format ExportFormat) (int, error) {
+	writer, err := newRecordWriter(w, format, roleRecordCodec)
+	if err != nil {
+		return 0, err
+	}
+
+	statusCode, entries, err := f.findEntries(ctx, "role_find", "")
+	if err != nil {
+		return statusCode, err
+	}
+
+	if err = writeRecords(writer, entries, roleRecordEntryCodec); err != nil {
+		return 0, err
+	}
+	if err = writer.Close(); err != nil {
+		return 0, err
+	}
+
+	return statusCode, nil
+}
+
+// ImportUsers создает и обновляет пользователей из r (формат как у ExportUsers), пользователи не из файла
+// не трогаются. Пустые поля записи не меняются, пароль не задается (IPA генерирует случайный).
+// Ошибка - только если файл не прочитать или план не построить, остальное - в отчете.
+func (f *FreeIPA) ImportUsers(
+	ctx context.Context,
+	r io.Reader,
+	format ExportFormat,
+	opts ReconcileOptions,
+) (int, *ImportReport, error) {
+	records, errs, err := readRecords(r, format, userRecordCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	desired := DesiredState{}
+	seen := map[string]bool{}
+
+	for _, item := range records {
+		rec := item.rec
+
+		if importErr := checkImportKey("uid", rec.UID, seen); importErr != nil {
+			errs = append(errs, ImportError{Record: item.n, Key: rec.UID, Err: importErr})
+
+			continue
+		}
+
+		desired.Users = append(desired.Users, rec.toRequestUser())
+	}
+
+	statusCode, entries, err := f.findEntries(ctx, "user_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	creates, others, err := planUsers(entries, desired)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	report := &ImportReport{Plan: &ReconcilePlan{Actions: slices.Concat(creates, others)}, Errors: errs}
+
+	return f.applyImport(ctx, statusCode, report, opts)
+}
+
+// ImportRoles создает роли из r и обновляет описание и состав пользователей существующих
+// (лишние участники-пользователи удаляются). Пустое описание и пустой список пользователей не меняются,
+// привилегии не загружаются.
+func (f *FreeIPA) ImportRoles(
+	ctx context.Context,
+	r io.Reader,
+	format ExportFormat,
+	opts ReconcileOptions,
+) (int, *ImportReport, error) {
+	records, errs, err := readRecords(r, format, roleRecordCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	statusCode, entries, err := f.findEntries(ctx, "role_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	roles, err := decodeEntries(entries, roleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var creates, others []ReconcileAction
+
+	seen := map[string]bool{}
+
+	for _, item := range records {
+		rec := item.rec
+
+		if importErr := checkImportKey("name", rec.Name, seen); importErr != nil {
+			errs = append(errs, ImportError{Record: item.n, Key: rec.Name, Err: importErr})
+
+			continue
+		}
+
+		reqOpts := map[string]any{}
+		if rec.Description != "" {
+			reqOpts[keyOptDescription] = rec.Description
+		}
+
+		idx := slices.IndexFunc(roles, func(role Role) bool {
+			return strings.EqualFold(role.CN, rec.Name)
+		})
+		if idx < 0 {
+			creates = append(creates, newReconcileAction(ReconcileCreateRole, rec.Name, "role_add", reqOpts))
+			others = append(others, planMembers("role", rec.Name, rec.Users, nil)...)
+
+			continue
+		}
+
+		role := roles[idx]
+
+		if rec.Description != "" && rec.Description != role.Description {
+			others = append(others, newReconcileAction(ReconcileUpdateRole, role.CN, "role_mod", reqOpts))
+		}
+
+		if len(rec.Users) > 0 {
+			others = append(others, planMembers("role", role.CN, rec.Users, role.MemberUser)...)
+		}
+	}
+
+	report := &ImportReport{Plan: &ReconcilePlan{Actions: slices.Concat(creates, others)}, Errors: errs}
+
+	return f.applyImport(ctx, statusCode, report, opts)
+}
+
+func (e ImportError) Error() string {
+	if e.Key != "" {
+		return fmt.Sprintf("record %d (%s): %s", e.Record, e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("record %d: %s", e.Record, e.Err)
+}
+
+func (e ImportError) Unwrap() error {
+	return e.Err
+}
+
+func (r UserRecord) toRequestUser() RequestUser {
+	return RequestUser{
+		UID:             r.UID,
+		GivenName:       r.GivenName,
+		SN:              r.SN,
+		Mail:            nonEmpty(r.Mail),
+		NsAccountLock:   r.Disabled,
+		CN:              nonEmpty(r.CN),
+		TelephoneNumber: nonEmpty(r.TelephoneNumber),
+		Mobile:          nonEmpty(r.Mobile),
+		Title:           nonEmpty(r.Title),
+		OU:              nonEmpty(r.OrgUnit),
+	}
+}
+
+func (f *FreeIPA) applyImport(
+	ctx context.Context,
+	statusCode int,
+	report *ImportReport,
+	opts ReconcileOptions,
+) (int, *ImportReport, error) {
+	if opts.DryRun {
+		return statusCode, report, nil
+	}
+
+	statusCode, results, err := f.ApplyPlan(ctx, report.Plan, opts.BatchSize)
+	report.Results = results
+
+	if err != nil {
+		return statusCode, report, err
+	}
+
+	return statusCode, report, nil
+}
+
+func writeRecords[T any](writer recordWriter[T], entries []map[string]any, codec entryCodec[T]) error {
+	records, err := decodeEntries(entries, codec)
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		if err = writer.Write(&records[i]); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkImportKey ключ записи обязателен и не повторяется (без учета регистра)
+func checkImportKey(name, key string, seen map[string]bool) error {
+	if key == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+
+	lower := strings.ToLower(key)
+	if seen[lower] {
+		return fmt.Errorf("duplicate %s", name)
+	}
+
+	seen[lower] = true
+
+	return nil
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,2639 @@
+package freeipa
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"github.com/volodya-nrg/tools/pkg/freeipa/freeipatest"
+	"github.com/volodya-nrg/tools/pkg/funcs"
+)
+
+const fakeAdminPass = "Secret123"
+
+// newFakeClient клиент к фейковому серверу, уже залогиненный под админом
+func newFakeClient(t *testing.T) (*FreeIPA, *freeipatest.Server) {
+	t.Helper()
+
+	srv := freeipatest.NewServer(fakeAdminPass)
+	t.Cleanup(srv.Close)
+
+	cl := NewFreeIPA(srv.Scheme(), srv.Host(), &http.Transport{}, 5*time.Second)
+	t.Cleanup(func() { _ = cl.Close() })
+
+	statusCode, err := cl.Login(t.Context(), freeipatest.AdminUID, fakeAdminPass)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, statusCode)
+
+	return cl, srv
+}
+
+// newSSHKey ed25519-ключ в формате authorized_keys (тело ключа случайное, для IPA это не важно)
+func newSSHKey(t *testing.T, comment string) string {
+	t.Helper()
+
+	const keyType = "ssh-ed25519"
+
+	pub := make([]byte, 32)
+	_, err := rand.Read(pub)
+	require.NoError(t, err)
+
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(keyType)))
+	blob = append(blob, keyType...)
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(pub)))
+	blob = append(blob, pub...)
+
+	return keyType + " " + base64.StdEncoding.EncodeToString(blob) + " " + comment
+}
+
+// newCert самоподписанный сертификат в DER
+func newCert(t *testing.T, cn string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{freeipatest.Realm}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return der
+}
+
+// newCSR запрос на сертификат в PEM и ключ к нему в PEM
+func newCSR(t *testing.T, cn string, dnsNames ...string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: dnsNames,
+	}, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// countEvents число событий вида kind
+// traceHandler добавляет trace_id из контекста, как обработчик из pkg/logger
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if traceID, ok := ctx.Value("trace_id").(string); ok {
+		r.AddAttrs(slog.String("trace_id", traceID))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+// withoutAttrs пользователь без прочих атрибутов: user_show --all отдает их шире, чем user_add
+func withoutAttrs(user *User) User {
+	u := *user
+	u.Attrs = nil
+
+	return u
+}
+
+func countEvents(events []ChangeEvent, kind ChangeEventKind) int {
+	n := 0
+
+	for _, event := range events {
+		if event.Kind == kind {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestFreeIPAFake(t *testing.T) {
+	t.Parallel()
+
+	t.Run("users", func(t *testing.T) {
+		t.Parallel()
+
+		cl, _ := newFakeClient(t)
+		newUserID := "test-" + funcs.RandStr()
+
+		statusCode, userExpected, err := cl.CreateUser(t.Context(), RequestUser{
+			UID:                   newUserID,
+			GivenName:             "first",
+			SN:                    "last",
+			Mail:                  funcs.Pointer(newUserID + "@example.com"),
+			UserPassword:          funcs.Pointer("password1"),
+			KRBPasswordExpiration: funcs.Pointer(time.Now().AddDate(0, 3, 0)),
+			Title:                 funcs.Pointer("engineer"),
+			AddAttr:               []string{"o=MyCompany", "jpegphoto=cGhvdG8="},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "engineer", userExpected.Title)
+		require.Equal(t, "MyCompany", userExpected.Organization)
+		require.Equal(t, "photo", userExpected.JPEGPhoto)
+		require.False(t, userExpected.KRBPasswordExpiration.IsZero())
+
+		statusCode, userActual, err := cl.GetUser(t.Context(), newUserID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, withoutAttrs(userExpected), withoutAttrs(userActual))
+
+		// повторное создание
+		statusCode, _, err = cl.CreateUser(t.Context(), RequestUser{UID: newUserID, GivenName: "a", SN: "b"})
+		require.ErrorIs(t, err, ErrDuplicateEntry)
+		require.Equal(t, 0, statusCode)
+
+		statusCode, users, total, err := cl.GetUsers(t.Context(), 1, 1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, uint32(2), total)
+		require.Len(t, users, 1)
+		require.Equal(t, newUserID, users[0].UID)
+
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{UID: newUserID, NsAccountLock: funcs.Pointer(true)})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// нет изменений - не ошибка
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{UID: newUserID, NsAccountLock: funcs.Pointer(true)})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.DeleteUser(t.Context(), newUserID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.GetUser(t.Context(), newUserID)
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+	})
+	t.Run("update user attributes", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		require.NoError(t, srv.AddUser("alice", "Alice", "Smith", "password1", nil))
+
+		statusCode, err := cl.UpdateUser(t.Context(), RequestUser{
+			UID:             "alice",
+			CN:              funcs.Pointer("Alice Smith"),
+			TelephoneNumber: funcs.Pointer("+7 495 000-00-00"),
+			Mobile:          funcs.Pointer("+7 900 000-00-00"),
+			Title:           funcs.Pointer("engineer"),
+			OU:              funcs.Pointer("R&D"),
+			AddAttr:         []string{"employeetype=contractor"},
+			SetAttr:         []string{"carlicense=A1", "carlicense=B2"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, user, err := cl.GetUser(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Equal(t, "Alice Smith", user.CN)
+		require.Equal(t, "+7 495 000-00-00", user.TelephoneNumber)
+		require.Equal(t, "+7 900 000-00-00", user.Mobile)
+		require.Equal(t, "engineer", user.Title)
+		require.Equal(t, "R&D", user.OrgUnit)
+		require.Equal(t, []string{"contractor"}, user.Attrs["employeetype"])
+		require.ElementsMatch(t, []string{"A1", "B2"}, user.Attrs["carlicense"])
+
+		// пустая строка и ClearAttr очищают, DelAttr удаляет одно значение
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{
+			UID:             "alice",
+			TelephoneNumber: funcs.Pointer(""),
+			ClearAttr:       []string{"employeetype"},
+			DelAttr:         []string{"carlicense=A1"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, user, err = cl.GetUser(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Empty(t, user.TelephoneNumber)
+		require.Equal(t, "+7 900 000-00-00", user.Mobile)
+		require.NotContains(t, user.Attrs, "employeetype")
+		require.Equal(t, []string{"B2"}, user.Attrs["carlicense"])
+
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{UID: "alice", DelAttr: []string{"carlicense=A1"}})
+		require.ErrorContains(t, err, "does not contain")
+		require.Equal(t, 0, statusCode)
+
+		statusCode, _, err = cl.CreateUser(t.Context(), RequestUser{
+			UID: "bob", GivenName: "Bob", SN: "Young", DelAttr: []string{"carlicense=A1"},
+		})
+		require.Error(t, err)
+		require.Equal(t, 0, statusCode)
+
+		desired := RequestUser{
+			UID:       "alice",
+			GivenName: "Alice",
+			Title:     funcs.Pointer("engineer"),
+			Mobile:    funcs.Pointer("+7 900 000-00-00"),
+			AddAttr:   []string{"carlicense=B2"},
+			DelAttr:   []string{"carlicense=A1"},
+			SetAttr:   []string{"carlicense=B2"},
+			ClearAttr: []string{"employeetype"},
+		}
+
+		// уже в нужном состоянии - запрос не отправляется
+		statusCode, isChanged, err := cl.ApplyUser(t.Context(), desired)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.False(t, isChanged)
+
+		desired.Title = funcs.Pointer("lead")
+		desired.SetAttr = []string{"carlicense=B2", "carlicense=C3"}
+
+		statusCode, isChanged, err = cl.ApplyUser(t.Context(), desired)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, isChanged)
+
+		_, user, err = cl.GetUser(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Equal(t, "lead", user.Title)
+		require.ElementsMatch(t, []string{"B2", "C3"}, user.Attrs["carlicense"])
+
+		statusCode, isChanged, err = cl.ApplyUser(t.Context(), desired)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.False(t, isChanged)
+
+		// бинарный атрибут сравнивается по содержимому: IPA принимает base64 с переносами, а отдает без них
+		photo := RequestUser{UID: "alice", AddAttr: []string{"jpegphoto=cGhv\ndG8="}}
+
+		_, isChanged, err = cl.ApplyUser(t.Context(), photo)
+		require.NoError(t, err)
+		require.True(t, isChanged)
+
+		calls := srv.Calls("user_mod")
+
+		_, isChanged, err = cl.ApplyUser(t.Context(), photo)
+		require.NoError(t, err)
+		require.False(t, isChanged)
+		require.Equal(t, calls, srv.Calls("user_mod"))
+
+		photo.AddAttr, photo.SetAttr = nil, []string{"jpegphoto=cGhv\ndG8="}
+
+		_, isChanged, err = cl.ApplyUser(t.Context(), photo)
+		require.NoError(t, err)
+		require.False(t, isChanged)
+
+		statusCode, _, err = cl.ApplyUser(t.Context(), RequestUser{UID: "nobody"})
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+	})
+	t.Run("find users", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		require.NoError(t, srv.AddUser("alice", "Alice", "Zeta", "password1", nil))
+		require.NoError(t, srv.AddUser("bob", "Bob", "Young", "password1", nil))
+		require.NoError(t, srv.AddUser("carol", "Carol", "Young", "password1", nil))
+
+		statusCode, _, err := cl.CreateGroup(t.Context(), RequestGroup{CN: "devs"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		statusCode, err = cl.AddGroupMembers(t.Context(), "devs", []string{"alice", "carol"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{UID: "carol", NsAccountLock: funcs.Pointer(true)})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		uids := func(users []User) []string {
+			result := make([]string, len(users))
+			for i, u := range users {
+				result[i] = u.UID
+			}
+			return result
+		}
+
+		tests := []struct {
+			name     string
+			query    UserQuery
+			expected []string
+		}{
+			{name: "criteria", query: UserQuery{Criteria: "young"}, expected: []string{"bob", "carol"}},
+			{name: "in group", query: UserQuery{InGroup: []string{"devs"}}, expected: []string{"alice", "carol"}},
+			{
+				name:     "not in group",
+				query:    UserQuery{NotInGroup: []string{"devs", "admins"}},
+				expected: []string{"bob"},
+			},
+			{name: "disabled", query: UserQuery{Disabled: funcs.Pointer(true)}, expected: []string{"carol"}},
+			{name: "exact sn", query: UserQuery{SN: funcs.Pointer("Zeta")}, expected: []string{"alice"}},
+			{
+				name:     "sort by sn desc",
+				query:    UserQuery{NotInGroup: []string{"admins"}, SortBy: UserSortBySN, SortDesc: true},
+				expected: []string{"alice", "carol", "bob"},
+			},
+			{name: "size limit", query: UserQuery{SizeLimit: 2}, expected: []string{"admin", "alice"}},
+		}
+		for _, tt := range tests {
+			statusCode, users, total, err := cl.FindUsers(t.Context(), tt.query, -1, -1)
+			require.NoError(t, err, tt.name)
+			require.Equal(t, http.StatusOK, statusCode, tt.name)
+			require.Equal(t, tt.expected, uids(users), tt.name)
+			require.Equal(t, uint32(len(tt.expected)), total, tt.name)
+		}
+
+		// страница после сортировки
+		statusCode, users, total, err := cl.FindUsers(t.Context(), UserQuery{SortBy: UserSortByGivenName}, 2, 1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, uint32(4), total)
+		require.Equal(t, []string{"alice", "bob"}, uids(users)) // admin без имени идет первым
+	})
+	t.Run("find beyond search limit", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		for i := range 120 {
+			require.NoError(t, srv.AddUser(fmt.Sprintf("user%03d", i), "User", "Many", "", nil))
+		}
+
+		statusCode, users, total, err := cl.GetUsers(t.Context(), 1, 120)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, uint32(121), total) // вместе с admin
+		require.Len(t, users, 1)
+
+		// выборка, обрезанная сервером, - ошибка, а не неполный список
+		srv.SetSizeLimit(100)
+
+		_, _, _, err = cl.GetUsers(t.Context(), -1, -1)
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+
+		// обрезка по SizeLimit запроса - не ошибка
+		_, users, _, err = cl.FindUsers(t.Context(), UserQuery{SizeLimit: 10}, -1, -1)
+		require.NoError(t, err)
+		require.Len(t, users, 10)
+
+		srv.SetSizeLimit(0)
+
+		for i := range 120 {
+			require.NoError(t, srv.AddEntry("group", map[string][]string{"cn": {fmt.Sprintf("group%03d", i)}}))
+		}
+
+		_, groups, total, err := cl.GetGroups(t.Context(), -1, -1)
+		require.NoError(t, err)
+		require.Equal(t, uint32(122), total) // вместе с admins и ipausers
+		require.Len(t, groups, limitDefault)
+
+		for i := range 120 {
+			require.NoError(t, srv.AddEntry("stageuser", map[string][]string{
+				"uid":       {fmt.Sprintf("stage%03d", i)},
+				"givenname": {"Stage"},
+				"sn":        {"Many"},
+			}))
+		}
+
+		_, stageUsers, total, err := cl.GetStageUsers(t.Context(), 1, 119)
+		require.NoError(t, err)
+		require.Equal(t, uint32(120), total)
+		require.Equal(t, "stage119", stageUsers[0].UID)
+
+		srv.SetSizeLimit(100)
+
+		_, _, _, err = cl.GetStageUsers(t.Context(), -1, -1)
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+	})
+	t.Run("user lifecycle", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		require.NoError(t, srv.AddUser("bob", "Bob", "Smith", "password1", nil))
+
+		// блокировка / разблокировка
+		statusCode, err := cl.DisableUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.DisableUser(t.Context(), "bob")
+		require.ErrorIs(t, err, ErrAlreadyInactive)
+		require.Equal(t, 0, statusCode)
+
+		statusCode, user, err := cl.GetUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, user.NsAccountLock)
+
+		statusCode, err = cl.EnableUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// удаление с сохранением
+		statusCode, err = cl.DeleteUser(t.Context(), "bob", WithPreserve())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, user, err = cl.GetUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, user.Preserved)
+		require.Empty(t, user.MemberOfGroup)
+
+		statusCode, users, _, err := cl.FindUsers(t.Context(), UserQuery{Preserved: funcs.Pointer(true)}, -1, -1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, users, 1)
+		require.Equal(t, "bob", users[0].UID)
+
+		statusCode, users, _, err = cl.GetUsers(t.Context(), -1, -1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, users, 1) // только admin
+
+		statusCode, err = cl.UndeleteUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, user, err = cl.GetUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.False(t, user.Preserved)
+		require.False(t, user.NsAccountLock)
+
+		// stage-пользователь
+		statusCode, user, err = cl.CreateStageUser(t.Context(), RequestUser{
+			UID:                   "carol",
+			GivenName:             "Carol",
+			SN:                    "Young",
+			UserPassword:          funcs.Pointer("password1"),
+			KRBPasswordExpiration: funcs.Pointer(time.Now().AddDate(0, 1, 0)),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, user.Staged)
+
+		statusCode, users, total, err := cl.GetStageUsers(t.Context(), -1, -1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, uint32(1), total)
+		require.Equal(t, "carol", users[0].UID)
+
+		statusCode, user, err = cl.ActivateStageUser(t.Context(), "carol")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.False(t, user.Staged)
+		require.Equal(t, "Carol", user.GivenName)
+
+		statusCode, _, err = cl.GetStageUser(t.Context(), "carol")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+
+		// после активации пароль рабочий
+		statusCode, err = cl.Login(t.Context(), "carol", "password1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+	})
+	t.Run("roles", func(t *testing.T) {
+		t.Parallel()
+
+		cl, _ := newFakeClient(t)
+		roleName := "test-" + funcs.RandStr()
+
+		statusCode, err := cl.CreateRole(t.Context(), roleName, funcs.Pointer("desc"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.ToggleRoleForUser(t.Context(), roleName, freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, role, err := cl.GetRole(t.Context(), roleName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{freeipatest.AdminUID}, role.MemberUser)
+
+		// если роль выдали между чтением и изменением, то это не ошибка
+		statusCode, err = cl.editRoleForUser(t.Context(), roleName, freeipatest.AdminUID, false)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, isHas, err := cl.HasRole(t.Context(), roleName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, isHas)
+
+		statusCode, roles, total, err := cl.GetRoles(t.Context(), -1, -1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, uint32(1), total)
+		require.Len(t, roles, 1)
+
+		// ошибка элемента batch-а типизирована
+		statusCode, _, err = cl.GetRolesByName(t.Context(), []string{funcs.RandStr()})
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, 0, statusCode)
+
+		// обертки не теряют ошибку IPA
+		statusCode, err = cl.ToggleRoleForUser(t.Context(), roleName, funcs.RandStr())
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+		require.Equal(t, codes.NotFound, ToCustomError(statusCode, err).GetCode())
+
+		var ipaErr *Error
+		require.ErrorAs(t, err, &ipaErr)
+		require.Equal(t, ErrCodeNotFound, ipaErr.Code)
+
+		// и ошибку подключения
+		closed := NewFreeIPA("http", "127.0.0.1:1", &http.Transport{}, time.Second)
+
+		_, _, err = closed.HasRole(t.Context(), roleName)
+
+		var opErr *net.OpError
+		require.ErrorAs(t, err, &opErr)
+
+		statusCode, err = cl.ToggleRoleForUser(t.Context(), roleName, freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.DeleteRole(t.Context(), roleName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+	})
+	t.Run("role members", func(t *testing.T) {
+		t.Parallel()
+
+		cl, _ := newFakeClient(t)
+
+		for _, role := range []string{"viewers", "editors"} {
+			statusCode, err := cl.CreateRole(t.Context(), role, nil)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, statusCode)
+		}
+
+		for _, uid := range []string{"alice", "bob"} {
+			statusCode, _, err := cl.CreateUser(t.Context(), RequestUser{UID: uid, GivenName: uid, SN: "test"})
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, statusCode)
+		}
+
+		statusCode, results, err := cl.AssignRoles(t.Context(), "alice", "viewers", "editors")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []RoleMemberResult{
+			{Role: "viewers", User: "alice", Outcome: MemberAdded},
+			{Role: "editors", User: "alice", Outcome: MemberAdded},
+		}, results)
+
+		// повторная выдача не ошибка
+		statusCode, results, err = cl.AssignRoles(t.Context(), "alice", "viewers")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, MemberUnchanged, results[0].Outcome)
+
+		// итоги отдаются и при ошибке
+		statusCode, results, err = cl.AssignRoles(t.Context(), "bob", "viewers", "nothing")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, 0, statusCode)
+		require.Len(t, results, 2)
+		require.Equal(t, MemberAdded, results[0].Outcome)
+		require.Equal(t, MemberFailed, results[1].Outcome)
+
+		statusCode, results, err = cl.SetRoleMembers(t.Context(), "viewers", "bob", "carol")
+		require.ErrorContains(t, err, "role viewers, user carol: no such entry")
+		require.Equal(t, 0, statusCode)
+		require.ElementsMatch(t, []RoleMemberResult{
+			{Role: "viewers", User: "carol", Outcome: MemberFailed, Err: results[0].Err},
+			{Role: "viewers", User: "alice", Outcome: MemberRemoved},
+			{Role: "viewers", User: "bob", Outcome: MemberUnchanged},
+		}, results)
+
+		statusCode, role, err := cl.GetRole(t.Context(), "viewers")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{"bob"}, role.MemberUser)
+
+		statusCode, results, err = cl.RevokeRoles(t.Context(), "alice", "viewers", "editors")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []RoleMemberResult{
+			{Role: "viewers", User: "alice", Outcome: MemberUnchanged},
+			{Role: "editors", User: "alice", Outcome: MemberRemoved},
+		}, results)
+
+		statusCode, user, err := cl.GetUser(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Empty(t, user.MemberOfRole)
+	})
+	t.Run("reconcile", func(t *testing.T) {
+		t.Parallel()
+
+		cl, _ := newFakeClient(t)
+
+		statusCode, err := cl.CreateRole(t.Context(), "auditors", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.CreateUser(t.Context(), RequestUser{UID: "old", GivenName: "old", SN: "user"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.CreateUser(t.Context(), RequestUser{UID: "bob", GivenName: "bob", SN: "smith"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		desired := DesiredState{
+			Users: []RequestUser{
+				{UID: "alice", GivenName: "alice", SN: "doe", Mail: funcs.Pointer("alice@example.test")},
+				{UID: "bob", GivenName: "bob", SN: "smith", Title: funcs.Pointer("dev")},
+			},
+			Groups: []DesiredGroup{
+				{RequestGroup: RequestGroup{CN: "devs", Description: funcs.Pointer("developers")}, Users: []string{"alice", "bob"}},
+			},
+			Roles:          map[string][]string{"auditors": {"alice"}},
+			DisableMissing: true,
+			Protected:      []string{freeipatest.AdminUID},
+		}
+
+		// dry-run ничего не меняет
+		statusCode, plan, results, err := cl.Reconcile(t.Context(), desired, ReconcileOptions{DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Nil(t, results)
+		require.Equal(t, strings.Join([]string{
+			"create_user alice: givenname, mail, random, sn",
+			"create_group devs: description",
+			"update_user bob: title",
+			"disable_user old",
+			"add_group_members devs: alice, bob",
+			"add_role_members auditors: alice",
+		}, "\n"), plan.String())
+
+		_, _, err = cl.GetUser(t.Context(), "alice")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// шаги разбиваются на batch-и, создание уходит раньше добавления участников
+		statusCode, plan, results, err = cl.Reconcile(t.Context(), desired, ReconcileOptions{BatchSize: 2})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, results, len(plan.Actions))
+
+		for _, result := range results {
+			require.NoError(t, result.Err, result.Action.String())
+		}
+
+		statusCode, user, err := cl.GetUser(t.Context(), "old")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, user.NsAccountLock)
+
+		statusCode, group, err := cl.GetGroup(t.Context(), "devs")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.ElementsMatch(t, []string{"alice", "bob"}, group.MemberUser)
+
+		statusCode, role, err := cl.GetRole(t.Context(), "auditors")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{"alice"}, role.MemberUser)
+
+		// повторный запуск ничего не меняет
+		statusCode, plan, err = cl.PlanReconcile(t.Context(), desired)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Empty(t, plan.Actions)
+
+		// лишние участники удаляются, ошибки шагов отдаются по каждому элементу
+		desired.Groups[0].Users = []string{"alice"}
+		desired.Roles["auditors"] = []string{"bob", "nobody"}
+
+		statusCode, plan, results, err = cl.Reconcile(t.Context(), desired, ReconcileOptions{})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, strings.Join([]string{
+			"remove_group_members devs: bob",
+			"add_role_members auditors: bob, nobody",
+			"remove_role_members auditors: alice",
+		}, "\n"), plan.String())
+		require.Len(t, results, 3)
+		require.NoError(t, results[0].Err)
+		require.ErrorContains(t, results[1].Err, "user nobody: no such entry")
+		require.NoError(t, results[2].Err)
+
+		statusCode, role, err = cl.GetRole(t.Context(), "auditors")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{"bob"}, role.MemberUser)
+
+		// роли не создаются
+		desired.Roles[funcs.RandStr()] = nil
+
+		_, _, err = cl.PlanReconcile(t.Context(), desired)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// план строится по всем пользователям, а не по первым ipasearchrecordslimit (100)
+		many, manySrv := newFakeClient(t)
+
+		for i := range 120 {
+			require.NoError(t, manySrv.AddUser(fmt.Sprintf("user%03d", i), "User", "Many", "", nil))
+		}
+
+		manyDesired := DesiredState{
+			Users:          []RequestUser{{UID: "user119", GivenName: "User", SN: "Many"}},
+			DisableMissing: true,
+			Protected:      []string{freeipatest.AdminUID},
+		}
+
+		_, plan, err = many.PlanReconcile(t.Context(), manyDesired)
+		require.NoError(t, err)
+		require.Len(t, plan.Actions, 119)
+
+		for _, action := range plan.Actions {
+			require.Equal(t, ReconcileDisableUser, action.Kind)
+		}
+
+		// по неполному снимку план не строится
+		manySrv.SetSizeLimit(100)
+
+		_, _, err = many.PlanReconcile(t.Context(), manyDesired)
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+	})
+	t.Run("export and import", func(t *testing.T) {
+		t.Parallel()
+
+		src, _ := newFakeClient(t)
+
+		statusCode, _, err := src.CreateUser(t.Context(), RequestUser{
+			UID:       "alice",
+			GivenName: "Алиса",
+			SN:        "Doe",
+			Mail:      funcs.Pointer("alice@example.test"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = src.CreateUser(t.Context(), RequestUser{
+			UID:           "bob",
+			GivenName:     "Bob",
+			SN:            "Smith",
+			NsAccountLock: funcs.Pointer(true),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = src.CreateRole(t.Context(), "auditors", funcs.Pointer("read only"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = src.AssignRoles(t.Context(), "alice", "auditors")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		for _, format := range []ExportFormat{FormatLDIF, FormatCSV, FormatJSON} {
+			t.Run(string(format), func(t *testing.T) {
+				var users, roles strings.Builder
+
+				statusCode, err := src.ExportUsers(t.Context(), &users, format)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, statusCode)
+
+				statusCode, err = src.ExportRoles(t.Context(), &roles, format)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, statusCode)
+
+				dst, _ := newFakeClient(t)
+
+				// dry-run только показывает план
+				statusCode, report, err := dst.ImportUsers(t.Context(), strings.NewReader(users.String()), format,
+					ReconcileOptions{DryRun: true})
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Empty(t, report.Errors)
+				require.Nil(t, report.Results)
+				require.Len(t, report.Plan.Actions, 2)
+				require.Equal(t, ReconcileCreateUser, report.Plan.Actions[0].Kind)
+				require.Equal(t, "alice", report.Plan.Actions[0].Target)
+
+				_, _, err = dst.GetUser(t.Context(), "alice")
+				require.ErrorIs(t, err, ErrNotFound)
+
+				statusCode, report, err = dst.ImportUsers(t.Context(), strings.NewReader(users.String()), format,
+					ReconcileOptions{})
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Len(t, report.Results, 2)
+
+				statusCode, report, err = dst.ImportRoles(t.Context(), strings.NewReader(roles.String()), format,
+					ReconcileOptions{})
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "create_role auditors: description\nadd_role_members auditors: alice",
+					report.Plan.String())
+
+				for _, result := range report.Results {
+					require.NoError(t, result.Err)
+				}
+
+				// после загрузки выгрузка совпадает с исходной
+				var dstUsers, dstRoles strings.Builder
+
+				_, err = dst.ExportUsers(t.Context(), &dstUsers, format)
+				require.NoError(t, err)
+				require.Equal(t, users.String(), dstUsers.String())
+
+				_, err = dst.ExportRoles(t.Context(), &dstRoles, format)
+				require.NoError(t, err)
+				require.Equal(t, roles.String(), dstRoles.String())
+
+				// повторная загрузка ничего не меняет
+				statusCode, report, err = dst.ImportUsers(t.Context(), strings.NewReader(users.String()), format,
+					ReconcileOptions{DryRun: true})
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Empty(t, report.Plan.Actions)
+			})
+		}
+
+		// ошибки записей попадают в отчет, остальные записи загружаются
+		csvData := "uid,givenname,sn,disabled\n,No,Uid,false\ncarol,Carol,King,maybe\ndave,Dave,Lee,\ndave,Dave,Lee,\n"
+
+		statusCode, report, err := src.ImportUsers(t.Context(), strings.NewReader(csvData), FormatCSV, ReconcileOptions{})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, report.Errors, 3)
+		require.EqualError(t, report.Errors[0],
+			`record 2 (carol): disabled: strconv.ParseBool: parsing "maybe": invalid syntax`)
+		require.EqualError(t, report.Errors[1], "record 1: uid is required")
+		require.EqualError(t, report.Errors[2], "record 4 (dave): duplicate uid")
+		require.Equal(t, "create_user dave: givenname, random, sn", report.Plan.String())
+		require.NoError(t, report.Results[0].Err)
+
+		// пустая блокировка и пустой список пользователей роли ничего не меняют
+		_, report, err = src.ImportUsers(t.Context(), strings.NewReader("uid,givenname,sn,disabled\nbob,Bob,Smith,\n"),
+			FormatCSV, ReconcileOptions{DryRun: true})
+		require.NoError(t, err)
+		require.Empty(t, report.Plan.Actions)
+
+		_, report, err = src.ImportRoles(t.Context(), strings.NewReader("name,description,users\nauditors,,\n"),
+			FormatCSV, ReconcileOptions{DryRun: true})
+		require.NoError(t, err)
+		require.Empty(t, report.Plan.Actions)
+
+		// выгрузка не обрезается лимитом ipasearchrecordslimit (100 по умолчанию)
+		many, manySrv := newFakeClient(t)
+
+		for i := range 150 {
+			require.NoError(t, manySrv.AddUser(fmt.Sprintf("user%03d", i), "User", "Many", "", nil))
+		}
+
+		var manyUsers strings.Builder
+
+		_, err = many.ExportUsers(t.Context(), &manyUsers, FormatCSV)
+		require.NoError(t, err)
+		require.Equal(t, 1+1+150, strings.Count(manyUsers.String(), "\n")) // заголовок, admin, пользователи
+
+		// обрезанная самим сервером выборка - ошибка, а не неполная выгрузка
+		manySrv.SetSizeLimit(50)
+
+		_, err = many.ExportUsers(t.Context(), io.Discard, FormatCSV)
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+	})
+	t.Run("watcher", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		statusCode, err := cl.CreateRole(t.Context(), "auditors", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.CreateUser(t.Context(), RequestUser{UID: "bob", GivenName: "Bob", SN: "Smith"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// первый опрос только запоминает снимок
+		watcher := NewWatcher(cl, time.Hour, nil)
+		require.Equal(t, watchIntervalDefault, NewWatcher(cl, 0, nil).interval)
+
+		statusCode, events, err := watcher.Poll(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Empty(t, events)
+
+		statusCode, _, err = cl.CreateUser(t.Context(), RequestUser{UID: "alice", GivenName: "Alice", SN: "Doe"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{UID: "bob", Title: funcs.Pointer("dev")})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.DisableUser(t.Context(), "bob")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.AssignRoles(t.Context(), "alice", "auditors")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, events, err = watcher.Poll(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		kinds := make([]string, len(events))
+		for i, event := range events {
+			kinds[i] = string(event.Kind) + " " + event.Name
+		}
+
+		require.Equal(t, []string{
+			"user_created alice",
+			"user_updated bob",
+			"user_disabled bob",
+			"group_membership_changed ipausers",
+			"role_membership_changed auditors",
+		}, kinds)
+		require.Equal(t, []string{"title"}, events[1].Fields)
+		require.False(t, events[1].At.IsZero())
+		require.Equal(t, []string{"alice"}, events[3].Added)
+		require.Equal(t, []string{"alice"}, events[4].Added)
+
+		// видны все пользователи, а не первые ipasearchrecordslimit (100)
+		for i := range 110 {
+			require.NoError(t, srv.AddUser(fmt.Sprintf("user%03d", i), "User", "Many", "", nil))
+		}
+
+		_, events, err = watcher.Poll(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, 110, countEvents(events, EventUserCreated))
+
+		// обрезанный сервером снимок - ошибка, предыдущий снимок остается
+		srv.SetSizeLimit(50)
+
+		before := watcher.State()
+
+		_, _, err = watcher.Poll(t.Context())
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+		require.Equal(t, before, watcher.State())
+
+		srv.SetSizeLimit(0)
+
+		_, events, err = watcher.Poll(t.Context())
+		require.NoError(t, err)
+		require.Empty(t, events)
+
+		// снимок переживает перезапуск
+		data, err := json.Marshal(watcher.State())
+		require.NoError(t, err)
+
+		var state WatchState
+		require.NoError(t, json.Unmarshal(data, &state))
+
+		statusCode, err = cl.DeleteUser(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		ch := NewWatcher(cl, 10*time.Millisecond, &state).Events(ctx, 0)
+
+		event := <-ch
+		require.Equal(t, EventUserDeleted, event.Kind)
+		require.Equal(t, "alice", event.Name)
+
+		event = <-ch
+		require.Equal(t, EventGroupMembershipChanged, event.Kind)
+		require.Equal(t, []string{"alice"}, event.Removed)
+
+		event = <-ch
+		require.Equal(t, EventRoleMembershipChanged, event.Kind)
+		require.Equal(t, []string{"alice"}, event.Removed)
+
+		cancel()
+
+		_, ok := <-ch
+		require.False(t, ok) // канал закрывается после отмены
+	})
+	t.Run("privileges", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+		service := "HTTP/web." + freeipatest.Domain + "@" + freeipatest.Realm
+
+		require.NoError(t, srv.AddEntry("service", map[string][]string{"krbprincipalname": {service}}))
+
+		// права обязательны и проверяются
+		_, _, err := cl.CreatePermission(t.Context(), RequestPermission{CN: "Read VPN users"})
+		require.ErrorIs(t, err, ErrRequirement)
+
+		_, _, err = cl.CreatePermission(t.Context(), RequestPermission{CN: "Read VPN users", Rights: []string{"fly"}})
+		require.ErrorIs(t, err, ErrValidation)
+
+		statusCode, permission, err := cl.CreatePermission(t.Context(), RequestPermission{
+			CN:     "Read VPN users",
+			Rights: []string{"read", "search"},
+			Type:   funcs.Pointer("user"),
+			Attrs:  []string{"uid", "mail"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{"read", "search"}, permission.Rights)
+		require.Equal(t, "permission", permission.BindType)
+
+		_, permission, err = cl.UpdatePermission(t.Context(), RequestPermission{
+			CN:    "Read VPN users",
+			Attrs: []string{"uid", "mail", "sshpubkey"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"uid", "mail", "sshpubkey"}, permission.Attrs)
+
+		_, _, err = cl.CreatePermission(t.Context(), RequestPermission{CN: "Write VPN users", Rights: []string{"write"}})
+		require.NoError(t, err)
+
+		_, permissions, err := cl.GetPermissions(t.Context(), "vpn")
+		require.NoError(t, err)
+		require.Len(t, permissions, 2)
+
+		statusCode, privilege, err := cl.CreatePrivilege(t.Context(), "VPN admins", funcs.Pointer("Manage VPN access"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "VPN admins", privilege.CN)
+
+		statusCode, err = cl.AddPrivilegePermissions(t.Context(), "VPN admins", []string{"Read VPN users", "Write VPN users"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.AddPrivilegePermissions(t.Context(), "VPN admins", []string{"Read VPN users", "nope"})
+		require.ErrorContains(t, err, "permission Read VPN users: This entry is already a member")
+		require.ErrorContains(t, err, "permission nope: no such entry")
+
+		_, privilege, err = cl.UpdatePrivilege(t.Context(), "VPN admins", "VPN")
+		require.NoError(t, err)
+		require.Equal(t, "VPN", privilege.Description)
+		require.Equal(t, []string{"Read VPN users", "Write VPN users"}, privilege.Permissions)
+
+		// роль: привилегии и участники всех типов
+		_, err = cl.CreateRole(t.Context(), "vpn-operator", nil)
+		require.NoError(t, err)
+
+		_, _, err = cl.CreateGroup(t.Context(), RequestGroup{CN: "ops"})
+		require.NoError(t, err)
+
+		_, _, err = cl.CreateHost(t.Context(), RequestHost{FQDN: "vpn." + freeipatest.Domain, Force: true})
+		require.NoError(t, err)
+
+		_, _, err = cl.CreateHostGroup(t.Context(), "gateways", nil)
+		require.NoError(t, err)
+
+		statusCode, err = cl.AddRolePrivileges(t.Context(), "vpn-operator", []string{"VPN admins"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.AddRolePrivileges(t.Context(), "vpn-operator", []string{"nope"})
+		require.ErrorContains(t, err, "privilege nope: no such entry")
+
+		statusCode, err = cl.AddRoleMembers(t.Context(), "vpn-operator", RoleMembers{
+			Users:      []string{freeipatest.AdminUID},
+			Groups:     []string{"ops"},
+			Hosts:      []string{"vpn." + freeipatest.Domain},
+			HostGroups: []string{"gateways"},
+			Services:   []string{service},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.AddRoleMembers(t.Context(), "vpn-operator", RoleMembers{Hosts: []string{"nope." + freeipatest.Domain}})
+		require.ErrorContains(t, err, "no such entry")
+
+		_, role, err := cl.GetRole(t.Context(), "vpn-operator")
+		require.NoError(t, err)
+		require.Equal(t, []string{"VPN admins"}, role.Privileges)
+		require.Equal(t, []string{freeipatest.AdminUID}, role.MemberUser)
+		require.Equal(t, []string{"ops"}, role.MemberGroup)
+		require.Equal(t, []string{"vpn." + freeipatest.Domain}, role.MemberHost)
+		require.Equal(t, []string{"gateways"}, role.MemberHostGroup)
+		require.Equal(t, []string{service}, role.MemberService)
+
+		_, privilege, err = cl.GetPrivilege(t.Context(), "VPN admins")
+		require.NoError(t, err)
+		require.Equal(t, []string{"vpn-operator"}, privilege.Roles)
+
+		_, permission, err = cl.GetPermission(t.Context(), "Read VPN users")
+		require.NoError(t, err)
+		require.Equal(t, []string{"VPN admins"}, permission.Privileges)
+		require.Equal(t, []string{"vpn-operator"}, permission.Roles)
+
+		_, err = cl.RemoveRoleMembers(t.Context(), "vpn-operator", RoleMembers{Hosts: []string{"vpn." + freeipatest.Domain}})
+		require.NoError(t, err)
+
+		_, err = cl.RemoveRolePrivileges(t.Context(), "vpn-operator", []string{"VPN admins"})
+		require.NoError(t, err)
+
+		_, role, err = cl.GetRole(t.Context(), "vpn-operator")
+		require.NoError(t, err)
+		require.Empty(t, role.Privileges)
+		require.Empty(t, role.MemberHost)
+
+		_, err = cl.RemovePrivilegePermissions(t.Context(), "VPN admins", []string{"Write VPN users"})
+		require.NoError(t, err)
+
+		statusCode, err = cl.DeletePermission(t.Context(), "Read VPN users")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, privileges, err := cl.GetPrivileges(t.Context())
+		require.NoError(t, err)
+		require.Len(t, privileges, 1)
+		require.Empty(t, privileges[0].Permissions)
+
+		_, err = cl.DeletePrivilege(t.Context(), "VPN admins")
+		require.NoError(t, err)
+
+		statusCode, _, err = cl.GetPrivilege(t.Context(), "VPN admins")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+	})
+	t.Run("resolver", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		require.NoError(t, srv.AddUser("alice", "Alice", "Smith", "Secret123", nil))
+
+		// alice -> devs -> ops -> роль operator; роль auditor выдана напрямую
+		_, _, err := cl.CreateGroup(t.Context(), RequestGroup{CN: "devs"})
+		require.NoError(t, err)
+		_, _, err = cl.CreateGroup(t.Context(), RequestGroup{CN: "ops"})
+		require.NoError(t, err)
+		_, err = cl.AddGroupMembers(t.Context(), "devs", []string{"alice"}, nil)
+		require.NoError(t, err)
+		_, err = cl.AddGroupMembers(t.Context(), "ops", nil, []string{"devs"})
+		require.NoError(t, err)
+
+		for _, name := range []string{"operator", "auditor"} {
+			_, err = cl.CreateRole(t.Context(), name, nil)
+			require.NoError(t, err)
+		}
+
+		_, err = cl.AddRoleMembers(t.Context(), "operator", RoleMembers{Groups: []string{"ops"}})
+		require.NoError(t, err)
+		_, err = cl.AddRoleMembers(t.Context(), "auditor", RoleMembers{Users: []string{"alice"}})
+		require.NoError(t, err)
+
+		for _, name := range []string{"VPN admins", "Audit"} {
+			_, _, err = cl.CreatePrivilege(t.Context(), name, nil)
+			require.NoError(t, err)
+		}
+
+		_, _, err = cl.CreatePermission(t.Context(), RequestPermission{CN: "Read VPN users", Rights: []string{"read"}})
+		require.NoError(t, err)
+		_, err = cl.AddPrivilegePermissions(t.Context(), "VPN admins", []string{"Read VPN users"})
+		require.NoError(t, err)
+		_, err = cl.AddRolePrivileges(t.Context(), "operator", []string{"VPN admins"})
+		require.NoError(t, err)
+		_, err = cl.AddRolePrivileges(t.Context(), "auditor", []string{"Audit"})
+		require.NoError(t, err)
+
+		resolver := NewResolver(cl, time.Minute)
+
+		access, err := resolver.Resolve(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Equal(t, &EffectiveAccess{
+			UID:         "alice",
+			Roles:       []string{"auditor", "operator"},
+			Privileges:  []string{"Audit", "VPN admins"},
+			Permissions: []string{"Read VPN users"},
+		}, access)
+
+		isAllowed, err := resolver.Authorize(t.Context(), "alice", "vpn admins")
+		require.NoError(t, err)
+		require.True(t, isAllowed)
+
+		isAllowed, err = resolver.Authorize(t.Context(), "alice", "Host admins")
+		require.NoError(t, err)
+		require.False(t, isAllowed)
+
+		isAllowed, err = resolver.Authorize(t.Context(), "nobody", "Audit")
+		require.NoError(t, err)
+		require.False(t, isAllowed)
+
+		_, err = resolver.Resolve(t.Context(), "nobody")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// повторные проверки идут из кеша
+		userShowCalls := srv.Calls("user_show")
+
+		_, err = cl.RemoveGroupMembers(t.Context(), "ops", nil, []string{"devs"})
+		require.NoError(t, err)
+
+		isAllowed, err = resolver.Authorize(t.Context(), "alice", "VPN admins")
+		require.NoError(t, err)
+		require.True(t, isAllowed)
+		require.Equal(t, userShowCalls, srv.Calls("user_show"))
+
+		resolver.Invalidate("ALICE")
+
+		isAllowed, err = resolver.Authorize(t.Context(), "alice", "VPN admins")
+		require.NoError(t, err)
+		require.False(t, isAllowed)
+		require.Equal(t, userShowCalls+1, srv.Calls("user_show"))
+
+		// одновременный Resolve ждет уже идущего вычисления, а не ходит в IPA сам
+		resolver.Invalidate("alice")
+
+		call := &resolveCall{done: make(chan struct{})}
+		resolver.mu.Lock()
+		resolver.inflight["alice"] = call
+		resolver.mu.Unlock()
+
+		resolved := make(chan *EffectiveAccess, 1)
+		resolveErr := make(chan error, 1)
+
+		go func() {
+			access, err := resolver.Resolve(t.Context(), "Alice")
+			resolved <- access
+			resolveErr <- err
+		}()
+
+		call.access = &EffectiveAccess{UID: "alice", Roles: []string{"operator"}}
+		close(call.done)
+		require.Equal(t, call.access, <-resolved)
+		require.NoError(t, <-resolveErr)
+		require.Equal(t, userShowCalls+1, srv.Calls("user_show"))
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		resolver.mu.Lock()
+		resolver.inflight["alice"] = &resolveCall{done: make(chan struct{})}
+		resolver.mu.Unlock()
+
+		_, err = resolver.Resolve(ctx, "alice")
+		require.ErrorIs(t, err, context.Canceled)
+
+		// сброс кеша не ждет зависшего вычисления
+		resolver.Invalidate("alice")
+
+		// роль, удаленная между user_show и role_show, пропускается
+		_, entries, err := cl.showEntries(t.Context(), "role_show", []string{"operator", "ghost"}, true)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		_, _, err = cl.showEntries(t.Context(), "role_show", []string{"operator", "ghost"}, false)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// у отключенного пользователя прав нет
+		_, err = cl.DisableUser(t.Context(), "alice")
+		require.NoError(t, err)
+
+		resolver.InvalidateAll()
+
+		access, err = resolver.Resolve(t.Context(), "alice")
+		require.NoError(t, err)
+		require.Empty(t, access.Roles)
+		require.Empty(t, access.Privileges)
+	})
+	t.Run("ssh keys and certs", func(t *testing.T) {
+		t.Parallel()
+
+		admin, srv := newFakeClient(t)
+		require.NoError(t, srv.AddUser("dave", "Dave", "Brown", "Secret123", nil))
+
+		// ключами и сертификатами пользователь управляет сам
+		cl := NewFreeIPA(srv.Scheme(), srv.Host(), &http.Transport{}, 5*time.Second)
+		t.Cleanup(func() { _ = cl.Close() })
+
+		_, err := cl.Login(t.Context(), "dave", "Secret123")
+		require.NoError(t, err)
+
+		laptopKey, desktopKey := newSSHKey(t, "dave@laptop"), newSSHKey(t, "dave@desktop")
+
+		statusCode, err := cl.AddUserSSHKeys(t.Context(), "dave", []string{laptopKey, desktopKey})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.AddUserSSHKeys(t.Context(), "dave", []string{"ssh-rsa not-a-key"})
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, err = cl.AddUserSSHKeys(t.Context(), freeipatest.AdminUID, []string{newSSHKey(t, "")})
+		require.ErrorIs(t, err, ErrACI)
+
+		_, user, err := cl.GetUser(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Equal(t, []string{laptopKey, desktopKey}, user.SSHPublicKeys)
+		require.Len(t, user.SSHKeyFingerprints, 2)
+		require.Regexp(t, `^SHA256:\S+ dave@laptop \(ssh-ed25519\)$`, user.SSHKeyFingerprints[0])
+
+		_, err = cl.RemoveUserSSHKeys(t.Context(), "dave", []string{laptopKey})
+		require.NoError(t, err)
+
+		_, err = cl.RemoveUserSSHKeys(t.Context(), "dave", []string{laptopKey})
+		require.ErrorIs(t, err, ErrAttrValueNotFound)
+
+		_, user, err = cl.GetUser(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Equal(t, []string{desktopKey}, user.SSHPublicKeys)
+		require.Len(t, user.SSHKeyFingerprints, 1)
+
+		// сертификаты
+		vpnCert, wifiCert := newCert(t, "dave-vpn"), newCert(t, "dave-wifi")
+
+		statusCode, err = cl.AddUserCertificates(t.Context(), "dave", [][]byte{vpnCert, wifiCert})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.AddUserCertificates(t.Context(), "dave", [][]byte{[]byte("garbage")})
+		require.ErrorIs(t, err, ErrValidation)
+
+		// повторное добавление ничего не меняет, EmptyModlist клиент не считает ошибкой
+		statusCode, err = cl.AddUserCertificates(t.Context(), "dave", [][]byte{vpnCert})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, user, err = cl.GetUser(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{vpnCert, wifiCert}, user.Certificates)
+
+		statusCode, certs, err := admin.GetUserCertificates(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, certs, 2)
+
+		// порядок - по серийному номеру
+		vpnIdx := slices.IndexFunc(certs, func(c Certificate) bool { return c.Subject == "CN=dave-vpn,O="+freeipatest.Realm })
+		require.NotEqual(t, -1, vpnIdx)
+		require.Equal(t, "VALID", certs[vpnIdx].Status)
+		require.Equal(t, []string{"dave"}, certs[vpnIdx].Owners)
+		require.NotNil(t, certs[vpnIdx].X509)
+		require.Equal(t, vpnCert, certs[vpnIdx].X509.Raw)
+		require.Equal(t, 0, certs[vpnIdx].SerialNumber.Cmp(certs[vpnIdx].X509.SerialNumber))
+
+		_, err = cl.RemoveUserCertificates(t.Context(), "dave", [][]byte{vpnCert})
+		require.NoError(t, err)
+
+		_, certs, err = admin.GetUserCertificates(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Len(t, certs, 1)
+		require.Equal(t, "CN=dave-wifi,O="+freeipatest.Realm, certs[0].Subject)
+
+		_, certs, err = admin.GetUserCertificates(t.Context(), freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Empty(t, certs)
+	})
+	t.Run("certificates", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+		host := "web." + freeipatest.Domain
+		service := "HTTP/" + host + "@" + freeipatest.Realm
+
+		_, _, err := cl.CreateHost(t.Context(), RequestHost{FQDN: host, Force: true})
+		require.NoError(t, err)
+		require.NoError(t, srv.AddEntry("service", map[string][]string{"krbprincipalname": {service}}))
+		require.NoError(t, srv.AddUser("erin", "Erin", "Green", "Secret123", nil))
+
+		hostCSR, hostKey := newCSR(t, host, host)
+
+		statusCode, hostCert, err := cl.RequestCertificate(t.Context(), "host/"+host, hostCSR, "")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.NoError(t, hostCert.X509.CheckSignatureFrom(srv.CACertificate()))
+		require.Equal(t, []string{host}, hostCert.X509.DNSNames)
+		require.Equal(t, 0, hostCert.SerialNumber.Cmp(hostCert.X509.SerialNumber))
+		require.Equal(t, []string{host}, hostCert.Owners)
+
+		// сертификат и ключ сразу годятся для tls
+		_, err = tls.X509KeyPair(hostCert.PEM(), hostKey)
+		require.NoError(t, err)
+
+		serviceCSR, _ := newCSR(t, host)
+		_, serviceCert, err := cl.RequestCertificate(t.Context(), service, serviceCSR, "")
+		require.NoError(t, err)
+		require.Equal(t, []string{service}, serviceCert.Owners)
+
+		userCSR, _ := newCSR(t, "erin")
+		_, _, err = cl.RequestCertificate(t.Context(), "erin", userCSR, "IECUserRoles")
+		require.NoError(t, err)
+
+		_, _, err = cl.RequestCertificate(t.Context(), "erin", userCSR, "nope")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		_, _, err = cl.RequestCertificate(t.Context(), "host/"+host, userCSR, "")
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, _, err = cl.RequestCertificate(t.Context(), "host/nope."+freeipatest.Domain, hostCSR, "")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		_, _, err = cl.RequestCertificate(t.Context(), "host/"+host, []byte("garbage"), "")
+		require.ErrorIs(t, err, ErrCertificateOp)
+
+		// выпущенный сертификат попадает в запись владельца
+		_, user, err := cl.GetUser(t.Context(), "erin")
+		require.NoError(t, err)
+		require.Len(t, user.Certificates, 1)
+
+		statusCode, cert, err := cl.GetCertificate(t.Context(), hostCert.SerialNumber)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "VALID", cert.Status)
+		require.False(t, cert.Revoked)
+		require.Nil(t, cert.RevocationReason)
+
+		statusCode, err = cl.RevokeCertificate(t.Context(), hostCert.SerialNumber, RevocationKeyCompromise)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.RevokeCertificate(t.Context(), hostCert.SerialNumber, RevocationKeyCompromise)
+		require.ErrorIs(t, err, ErrCertificateOp)
+
+		_, err = cl.RevokeCertificate(t.Context(), serviceCert.SerialNumber, RevocationReason(7))
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, cert, err = cl.GetCertificate(t.Context(), hostCert.SerialNumber)
+		require.NoError(t, err)
+		require.True(t, cert.Revoked)
+		require.Equal(t, "REVOKED", cert.Status)
+		require.Equal(t, funcs.Pointer(RevocationKeyCompromise), cert.RevocationReason)
+
+		statusCode, _, err = cl.GetCertificate(t.Context(), big.NewInt(42))
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+
+		// поиск
+		_, certs, err := cl.FindCertificates(t.Context(), CertificateFilter{})
+		require.NoError(t, err)
+		require.Len(t, certs, 3)
+		require.True(t, slices.IsSortedFunc(certs, func(a, b Certificate) int {
+			return a.SerialNumber.Cmp(b.SerialNumber)
+		}))
+
+		// выборка, обрезанная сервером, - ошибка, а не неполный список
+		srv.SetSizeLimit(2)
+
+		_, _, err = cl.FindCertificates(t.Context(), CertificateFilter{})
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+
+		srv.SetSizeLimit(0)
+
+		_, certs, err = cl.FindCertificates(t.Context(), CertificateFilter{Subject: "web"})
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+
+		_, certs, err = cl.FindCertificates(t.Context(), CertificateFilter{Hosts: []string{host}})
+		require.NoError(t, err)
+		require.Len(t, certs, 1)
+		require.Equal(t, hostCert.X509.Raw, certs[0].X509.Raw)
+
+		_, certs, err = cl.FindCertificates(t.Context(), CertificateFilter{
+			RevocationReason: funcs.Pointer(RevocationKeyCompromise),
+		})
+		require.NoError(t, err)
+		require.Len(t, certs, 1)
+
+		_, certs, err = cl.FindCertificates(t.Context(), CertificateFilter{
+			ExpiresBefore: funcs.Pointer(time.Now().Add(time.Hour)),
+		})
+		require.NoError(t, err)
+		require.Empty(t, certs)
+
+		_, certs, err = cl.GetUserCertificates(t.Context(), "erin")
+		require.NoError(t, err)
+		require.Len(t, certs, 1)
+		require.Equal(t, "CN=erin,O="+freeipatest.Realm, certs[0].Subject)
+	})
+	t.Run("dns", func(t *testing.T) {
+		t.Parallel()
+
+		cl, fake := newFakeClient(t)
+		zoneName := "dns-" + strings.ToLower(funcs.RandStr()) + ".test"
+
+		statusCode, zone, err := cl.CreateDNSZone(t.Context(), RequestDNSZone{
+			Name:       zoneName,
+			SOARefresh: funcs.Pointer(7200),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, zoneName+".", zone.Name)
+		require.True(t, zone.Active)
+		require.Equal(t, 7200, zone.SOARefresh)
+		require.Equal(t, "hostmaster."+zoneName+".", zone.SOARName)
+		require.NotEmpty(t, zone.NameServers)
+
+		_, _, err = cl.CreateDNSZone(t.Context(), RequestDNSZone{Name: zoneName + "."})
+		require.ErrorIs(t, err, ErrDuplicateEntry)
+
+		statusCode, zone, err = cl.UpdateDNSZone(t.Context(), RequestDNSZone{
+			Name:           zoneName,
+			TTL:            funcs.Pointer(600),
+			AllowDynUpdate: funcs.Pointer(true),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, 600, zone.TTL)
+		require.True(t, zone.AllowDynUpdate)
+
+		_, zones, err := cl.GetDNSZones(t.Context())
+		require.NoError(t, err)
+		require.True(t, slices.ContainsFunc(zones, func(z DNSZone) bool { return z.Name == zoneName+"." }))
+
+		srv := SRVRecord{Priority: 0, Weight: 100, Port: 389, Target: "ipa.example.test."}
+
+		statusCode, record, err := cl.AddDNSRecord(t.Context(), zoneName, DNSRecord{
+			Name: "www",
+			TTL:  300,
+			A:    []string{"192.0.2.10", "192.0.2.11"},
+			AAAA: []string{"2001:db8::10"},
+			TXT:  []string{"v=spf1 -all"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "www", record.Name)
+		require.Equal(t, 300, record.TTL)
+		require.Equal(t, []string{"192.0.2.10", "192.0.2.11"}, record.A)
+
+		// повторное добавление тех же значений не ошибка
+		_, record, err = cl.AddDNSRecord(t.Context(), zoneName, DNSRecord{Name: "www", A: []string{"192.0.2.10"}})
+		require.NoError(t, err)
+		require.Len(t, record.A, 2)
+
+		_, _, err = cl.AddDNSRecord(t.Context(), zoneName, DNSRecord{Name: "bad", A: []string{"2001:db8::1"}})
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, _, err = cl.AddDNSRecord(t.Context(), zoneName, DNSRecord{Name: "www", CNAME: []string{"web"}})
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, record, err = cl.AddDNSRecord(t.Context(), zoneName, DNSRecord{Name: "_ldap._tcp", SRV: []SRVRecord{srv}})
+		require.NoError(t, err)
+		require.Equal(t, []SRVRecord{srv}, record.SRV)
+
+		_, _, err = cl.AddDNSRecord(t.Context(), zoneName, DNSRecord{Name: "mail", CNAME: []string{"www"}})
+		require.NoError(t, err)
+
+		_, records, err := cl.FindDNSRecords(t.Context(), zoneName, "")
+		require.NoError(t, err)
+		require.Len(t, records, 4) // @, _ldap._tcp, mail, www
+
+		_, records, err = cl.FindDNSRecords(t.Context(), zoneName, "ww")
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+
+		// выборка, обрезанная сервером, - ошибка, а не неполный список
+		fake.SetSizeLimit(3)
+
+		_, _, err = cl.FindDNSRecords(t.Context(), zoneName, "")
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+
+		fake.SetSizeLimit(0)
+
+		statusCode, err = cl.RemoveDNSRecord(t.Context(), zoneName, DNSRecord{Name: "www", A: []string{"192.0.2.11"}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.RemoveDNSRecord(t.Context(), zoneName, DNSRecord{Name: "www", A: []string{"192.0.2.11"}})
+		require.ErrorIs(t, err, ErrAttrValueNotFound)
+
+		_, record, err = cl.GetDNSRecord(t.Context(), zoneName, "www")
+		require.NoError(t, err)
+		require.Equal(t, []string{"192.0.2.10"}, record.A)
+		require.Equal(t, []string{"2001:db8::10"}, record.AAAA)
+
+		// удаление последнего значения удаляет запись
+		_, err = cl.RemoveDNSRecord(t.Context(), zoneName, DNSRecord{Name: "mail", CNAME: []string{"www"}})
+		require.NoError(t, err)
+
+		_, _, err = cl.GetDNSRecord(t.Context(), zoneName, "mail")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		statusCode, err = cl.DeleteDNSRecord(t.Context(), zoneName, "www")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, _, err = cl.GetDNSRecord(t.Context(), zoneName, "www")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		statusCode, err = cl.DeleteDNSZone(t.Context(), zoneName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, _, err = cl.GetDNSZone(t.Context(), zoneName)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		_, _, err = cl.FindDNSRecords(t.Context(), zoneName, "")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("otp tokens", func(t *testing.T) {
+		t.Parallel()
+
+		admin, srv := newFakeClient(t)
+		require.NoError(t, srv.AddUser("erin", "Erin", "Gray", "Secret123", nil))
+
+		statusCode, token, err := admin.CreateOTPToken(t.Context(), RequestOTPToken{
+			Owner:       "erin",
+			Description: funcs.Pointer("phone"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.NotEmpty(t, token.ID)
+		require.Equal(t, OTPTokenTOTP, token.Type)
+		require.Equal(t, "erin", token.Owner)
+		require.Equal(t, 6, token.Digits)
+		require.Equal(t, 30, token.TimeStep)
+		require.False(t, token.Disabled)
+
+		uri, err := url.Parse(token.URI)
+		require.NoError(t, err)
+		require.Equal(t, "otpauth", uri.Scheme)
+		require.Equal(t, "totp", uri.Host)
+		require.NotEmpty(t, uri.Query().Get("secret"))
+		require.Equal(t, "30", uri.Query().Get("period"))
+
+		_, _, err = admin.CreateOTPToken(t.Context(), RequestOTPToken{Owner: "erin", Algorithm: funcs.Pointer("md5")})
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, _, err = admin.CreateOTPToken(t.Context(), RequestOTPToken{Owner: "nobody"})
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// второй токен пользователь выпускает себе сам
+		cl := NewFreeIPA(srv.Scheme(), srv.Host(), &http.Transport{}, 5*time.Second)
+		t.Cleanup(func() { _ = cl.Close() })
+
+		_, err = cl.Login(t.Context(), "erin", "Secret123")
+		require.NoError(t, err)
+
+		_, hotp, err := cl.CreateOTPToken(t.Context(), RequestOTPToken{
+			ID:     "erin-yubikey",
+			Type:   OTPTokenHOTP,
+			Digits: funcs.Pointer(8),
+		})
+		require.NoError(t, err)
+		require.Equal(t, "erin", hotp.Owner)
+		require.Equal(t, 8, hotp.Digits)
+		require.True(t, strings.HasPrefix(hotp.URI, "otpauth://hotp/"))
+
+		_, _, err = cl.CreateOTPToken(t.Context(), RequestOTPToken{Owner: freeipatest.AdminUID})
+		require.ErrorIs(t, err, ErrACI)
+
+		_, tokens, err := admin.GetOTPTokens(t.Context(), "erin")
+		require.NoError(t, err)
+		require.Len(t, tokens, 2)
+		require.Empty(t, tokens[0].URI) // uri отдается только при создании
+
+		_, tokens, err = admin.GetOTPTokens(t.Context(), freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Empty(t, tokens)
+
+		// выборка, обрезанная сервером, - ошибка, а не неполный список
+		srv.SetSizeLimit(1)
+
+		_, _, err = admin.GetOTPTokens(t.Context(), "erin")
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+
+		srv.SetSizeLimit(0)
+
+		statusCode, err = cl.DisableOTPToken(t.Context(), hotp.ID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, hotp, err = admin.GetOTPToken(t.Context(), hotp.ID)
+		require.NoError(t, err)
+		require.True(t, hotp.Disabled)
+
+		_, err = admin.EnableOTPToken(t.Context(), hotp.ID)
+		require.NoError(t, err)
+
+		_, hotp, err = admin.GetOTPToken(t.Context(), hotp.ID)
+		require.NoError(t, err)
+		require.False(t, hotp.Disabled)
+
+		// обязательный 2FA
+		statusCode, err = admin.SetUserAuthTypes(t.Context(), "erin", []UserAuthType{UserAuthOTP})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, user, err := admin.GetUser(t.Context(), "erin")
+		require.NoError(t, err)
+		require.Equal(t, []string{"otp"}, user.AuthTypes)
+
+		_, err = admin.SetUserAuthTypes(t.Context(), "erin", []UserAuthType{"sms"})
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, err = admin.SetUserAuthTypes(t.Context(), "erin", nil)
+		require.NoError(t, err)
+
+		_, user, err = admin.GetUser(t.Context(), "erin")
+		require.NoError(t, err)
+		require.Empty(t, user.AuthTypes)
+
+		statusCode, err = cl.DeleteOTPToken(t.Context(), hotp.ID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, _, err = admin.GetOTPToken(t.Context(), hotp.ID)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		_, err = cl.DeleteOTPToken(t.Context(), token.ID+"-missing")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("command", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+		require.NoError(t, srv.AddUser("frank", "Frank", "White", "Secret123", map[string][]string{
+			"mail": {"frank@example.test", "f.white@example.test"},
+		}))
+
+		// атрибуты остаются срезами, кодировки IPA раскрываются
+		type account struct {
+			UID        []string    `json:"uid"`
+			Mail       []string    `json:"mail"`
+			UIDNumber  []string    `json:"uidnumber"`
+			Locked     bool        `json:"nsaccountlock"`
+			Expiration []time.Time `json:"krbpasswordexpiration"`
+			Groups     []string    `json:"memberof_group"`
+		}
+
+		var user account
+
+		statusCode, err := cl.Command(t.Context(), "user_show", []any{"frank"}, map[string]any{"all": true}, &user)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{"frank"}, user.UID)
+		require.Equal(t, []string{"frank@example.test", "f.white@example.test"}, user.Mail)
+		require.Len(t, user.UIDNumber, 1)
+		require.Len(t, user.Expiration, 1)
+		require.False(t, user.Expiration[0].IsZero())
+		require.Equal(t, []string{freeipatest.UsersGroup}, user.Groups)
+
+		var users []account
+
+		_, err = cl.Command(t.Context(), "user_find", []any{"fra"}, nil, &users)
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+
+		_, err = cl.Command(t.Context(), "user_show", []any{"nobody"}, nil, &user)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		_, err = cl.Command(t.Context(), "user_disable", []any{"frank"}, nil, nil)
+		require.NoError(t, err)
+
+		// batch: по элементу на команду, ошибки команд - в полях элемента
+		var items []struct {
+			Result    account `json:"result"`
+			ErrorName string  `json:"error_name"`
+		}
+
+		batch := []any{
+			map[string]any{"method": "user_show", "params": []any{[]any{"frank"}, map[string]any{}}},
+			map[string]any{"method": "user_show", "params": []any{[]any{"nobody"}, map[string]any{}}},
+		}
+
+		statusCode, err = cl.Command(t.Context(), "batch", batch, nil, &items)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, items, 2)
+		require.Equal(t, []string{"frank"}, items[0].Result.UID)
+		require.Empty(t, items[0].ErrorName)
+		require.Equal(t, ErrNotFound.Name, items[1].ErrorName)
+
+		// без схемы неизвестная команда уходит на сервер
+		callsBefore := srv.Calls("no_such_command")
+
+		_, err = cl.Command(t.Context(), "no_such_command", nil, nil, nil)
+		require.ErrorIs(t, err, ErrCommand)
+		require.Equal(t, callsBefore+1, srv.Calls("no_such_command"))
+
+		statusCode, schema, err := cl.Schema(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.NotEmpty(t, schema.Fingerprint)
+		require.True(t, schema.HasCommand("user_show"))
+		require.Equal(t, "uid", schema.Commands["user_show"].Args[0].Name)
+		require.True(t, schema.Commands["user_show"].Args[0].Required)
+
+		// со схемой ошибки отдаются локально
+		_, err = cl.Command(t.Context(), "no_such_command", nil, nil, nil)
+		require.ErrorIs(t, err, ErrCommand)
+		require.Equal(t, callsBefore+1, srv.Calls("no_such_command"))
+
+		_, err = cl.Command(t.Context(), "user_show", []any{"frank"}, map[string]any{"colour": "red"}, &user)
+		require.ErrorIs(t, err, ErrOption)
+
+		_, err = cl.Command(t.Context(), "user_show", nil, nil, &user)
+		require.ErrorIs(t, err, ErrRequirement)
+
+		_, err = cl.Command(t.Context(), "user_show", []any{"frank", "extra"}, nil, &user)
+		require.ErrorIs(t, err, ErrMaxArgument)
+
+		statusCode, err = cl.Command(t.Context(), "user_show", []any{"frank"}, map[string]any{"all": true}, &user)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, user.Locked)
+
+		cl.ResetSchema()
+
+		_, err = cl.Command(t.Context(), "no_such_command", nil, nil, nil)
+		require.ErrorIs(t, err, ErrCommand)
+		require.Equal(t, callsBefore+2, srv.Calls("no_such_command"))
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		statusCode, group, err := cl.CreateGroup(t.Context(), RequestGroup{CN: "devs"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Positive(t, group.GIDNumber)
+
+		statusCode, _, err = cl.CreateGroup(t.Context(), RequestGroup{CN: "backend", NonPosix: funcs.Pointer(true)})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.AddGroupMembers(t.Context(), "devs", nil, []string{"backend"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.AddGroupMembers(t.Context(), "backend", []string{freeipatest.AdminUID}, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.AddGroupMembers(t.Context(), "backend", []string{freeipatest.AdminUID, "nobody"}, nil)
+		require.ErrorContains(t, err, "user nobody: no such entry")
+		require.Equal(t, 0, statusCode)
+
+		statusCode, group, err = cl.GetGroup(t.Context(), "devs")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{"backend"}, group.MemberGroup)
+		require.Equal(t, []string{freeipatest.AdminUID}, group.MemberIndirectUser)
+
+		statusCode, groups, total, err := cl.GetGroups(t.Context(), 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, uint32(4), total) // admins, backend, devs, ipausers
+		require.Len(t, groups, 2)
+		require.Equal(t, "admins", groups[0].CN)
+
+		// выборка, обрезанная сервером, - ошибка, а не неполный список
+		srv.SetSizeLimit(3)
+
+		_, _, _, err = cl.GetGroups(t.Context(), -1, -1)
+		require.ErrorIs(t, err, ErrSizeLimitExceeded)
+
+		srv.SetSizeLimit(0)
+
+		statusCode, err = cl.DeleteGroup(t.Context(), "backend")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, group, err = cl.GetGroup(t.Context(), "devs")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Empty(t, group.MemberGroup)
+	})
+	t.Run("hosts", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		// без DNS-записи и force хост не заводится
+		_, _, err := cl.CreateHost(t.Context(), RequestHost{FQDN: "vm1.example.test"})
+		require.Error(t, err)
+
+		_, _, err = cl.CreateHost(t.Context(), RequestHost{FQDN: "vm1", Force: true})
+		require.ErrorIs(t, err, ErrValidation)
+
+		statusCode, host, err := cl.CreateHost(t.Context(), RequestHost{
+			FQDN:        "vm1.example.test",
+			Description: funcs.Pointer("build agent"),
+			Locality:    funcs.Pointer("msk"),
+			OS:          funcs.Pointer("Fedora 40"),
+			Force:       true,
+			Random:      true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "vm1.example.test", host.FQDN)
+		require.Equal(t, "msk", host.Locality)
+		require.Equal(t, "Fedora 40", host.OS)
+		require.NotEmpty(t, host.OTP)
+		require.True(t, host.HasPassword)
+		require.False(t, host.HasKeytab)
+		require.Equal(t, []string{"vm1.example.test"}, host.ManagedBy)
+
+		_, _, err = cl.CreateHost(t.Context(), RequestHost{FQDN: "vm2.example.test", IPAddress: funcs.Pointer("192.0.2.10")})
+		require.NoError(t, err)
+
+		_, _, err = cl.CreateHost(t.Context(), RequestHost{FQDN: "vm1.example.test", Force: true})
+		require.ErrorIs(t, err, ErrDuplicateEntry)
+
+		// регистрация расходует OTP
+		require.NoError(t, srv.EnrollHost("vm1.example.test"))
+
+		_, host, err = cl.GetHost(t.Context(), "vm1.example.test")
+		require.NoError(t, err)
+		require.True(t, host.HasKeytab)
+		require.False(t, host.HasPassword)
+		require.Empty(t, host.OTP)
+
+		statusCode, err = cl.DisableHost(t.Context(), "vm1.example.test")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.DisableHost(t.Context(), "vm1.example.test")
+		require.ErrorIs(t, err, ErrAlreadyInactive)
+
+		// новый OTP для повторной регистрации
+		_, host, err = cl.UpdateHost(t.Context(), RequestHost{FQDN: "vm1.example.test", Random: true})
+		require.NoError(t, err)
+		require.False(t, host.HasKeytab)
+		require.True(t, host.HasPassword)
+		require.NotEmpty(t, host.OTP)
+
+		_, hosts, err := cl.GetHosts(t.Context(), "agent")
+		require.NoError(t, err)
+		require.Len(t, hosts, 1)
+
+		// группы хостов
+		statusCode, hostGroup, err := cl.CreateHostGroup(t.Context(), "ci", funcs.Pointer("CI machines"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "ci", hostGroup.CN)
+
+		_, _, err = cl.CreateHostGroup(t.Context(), "all-vms", nil)
+		require.NoError(t, err)
+
+		_, err = cl.AddHostGroupMembers(t.Context(), "ci", []string{"vm1.example.test", "vm2.example.test"}, nil)
+		require.NoError(t, err)
+
+		_, err = cl.AddHostGroupMembers(t.Context(), "all-vms", nil, []string{"ci"})
+		require.NoError(t, err)
+
+		_, err = cl.AddHostGroupMembers(t.Context(), "ci", []string{"nope.example.test"}, nil)
+		require.ErrorContains(t, err, "host nope.example.test: no such entry")
+
+		_, hostGroup, err = cl.GetHostGroup(t.Context(), "ci")
+		require.NoError(t, err)
+		require.Equal(t, []string{"vm1.example.test", "vm2.example.test"}, hostGroup.MemberHost)
+		require.Equal(t, []string{"all-vms"}, hostGroup.MemberOfHostGroup)
+
+		_, host, err = cl.GetHost(t.Context(), "vm2.example.test")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ci"}, host.MemberOfHostGroup)
+
+		_, err = cl.RemoveHostGroupMembers(t.Context(), "ci", []string{"vm2.example.test"}, nil)
+		require.NoError(t, err)
+
+		statusCode, err = cl.DeleteHost(t.Context(), "vm1.example.test")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, hostGroups, err := cl.GetHostGroups(t.Context())
+		require.NoError(t, err)
+		require.Len(t, hostGroups, 2)
+		require.Empty(t, hostGroups[1].MemberHost)
+
+		_, err = cl.DeleteHostGroup(t.Context(), "ci")
+		require.NoError(t, err)
+
+		statusCode, _, err = cl.GetHost(t.Context(), "vm1.example.test")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+	})
+	t.Run("hbac", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+		require.NoError(t, srv.AddUser("erin", "Erin", "Green", "password1", nil))
+		require.NoError(t, srv.AddEntry("host", map[string][]string{"fqdn": {"web1.example.test"}}))
+		require.NoError(t, srv.AddEntry("hostgroup", map[string][]string{
+			"cn":          {"webservers"},
+			"member_host": {"web1.example.test"},
+		}))
+
+		// по умолчанию доступ всем через allow_all
+		statusCode, rules, err := cl.GetHBACRules(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, rules, 1)
+		require.Equal(t, "allow_all", rules[0].CN)
+		require.True(t, rules[0].Enabled)
+		require.Equal(t, CategoryAll, rules[0].UserCategory)
+
+		statusCode, err = cl.DisableHBACRule(t.Context(), "allow_all")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		_, err = cl.DisableHBACRule(t.Context(), "allow_all")
+		require.ErrorIs(t, err, ErrAlreadyInactive)
+
+		statusCode, res, err := cl.HBACTest(t.Context(), "erin", "web1.example.test", "sshd")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.False(t, res.Granted)
+
+		// свое правило: группа -> группа хостов -> sshd
+		_, _, err = cl.CreateGroup(t.Context(), RequestGroup{CN: "devs"})
+		require.NoError(t, err)
+		_, err = cl.AddGroupMembers(t.Context(), "devs", []string{"erin"}, nil)
+		require.NoError(t, err)
+
+		statusCode, rule, err := cl.CreateHBACRule(t.Context(), RequestHBACRule{
+			CN:          "devs_web",
+			Description: funcs.Pointer("devs to web servers"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, rule.Enabled)
+
+		statusCode, err = cl.AddHBACRuleMembers(t.Context(), "devs_web", RuleMembers{
+			Groups:     []string{"devs"},
+			HostGroups: []string{"webservers"},
+			Services:   []string{"sshd"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// несуществующий и повторный участники
+		_, err = cl.AddHBACRuleMembers(t.Context(), "devs_web", RuleMembers{
+			Users:  []string{"nobody"},
+			Groups: []string{"devs"},
+		})
+		require.ErrorContains(t, err, "user nobody: no such entry")
+		require.ErrorContains(t, err, "group devs: This entry is already a member")
+
+		_, err = cl.AddHBACRuleMembers(t.Context(), "devs_web", RuleMembers{})
+		require.Error(t, err)
+
+		_, rule, err = cl.GetHBACRule(t.Context(), "devs_web")
+		require.NoError(t, err)
+		require.Equal(t, []string{"devs"}, rule.MemberGroup)
+		require.Equal(t, []string{"webservers"}, rule.MemberHostGroup)
+		require.Equal(t, []string{"sshd"}, rule.MemberService)
+
+		_, res, err = cl.HBACTest(t.Context(), "erin", "web1.example.test", "sshd")
+		require.NoError(t, err)
+		require.True(t, res.Granted)
+		require.Equal(t, []string{"devs_web"}, res.Matched)
+
+		_, res, err = cl.HBACTest(t.Context(), "erin", "web1.example.test", "login")
+		require.NoError(t, err)
+		require.False(t, res.Granted)
+		require.Equal(t, []string{"devs_web"}, res.NotMatched)
+
+		_, _, err = cl.HBACTest(t.Context(), "nobody", "web1.example.test", "sshd")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// категория all при наличии участников
+		allUsers := RequestHBACRule{CN: "devs_web", UserCategory: funcs.Pointer(CategoryAll)}
+
+		_, _, err = cl.UpdateHBACRule(t.Context(), allUsers)
+		require.ErrorIs(t, err, ErrMutuallyExclusive)
+
+		_, err = cl.RemoveHBACRuleMembers(t.Context(), "devs_web", RuleMembers{Groups: []string{"devs"}})
+		require.NoError(t, err)
+
+		_, rule, err = cl.UpdateHBACRule(t.Context(), allUsers)
+		require.NoError(t, err)
+		require.Equal(t, CategoryAll, rule.UserCategory)
+
+		_, err = cl.AddHBACRuleMembers(t.Context(), "devs_web", RuleMembers{Users: []string{"erin"}})
+		require.ErrorIs(t, err, ErrMutuallyExclusive)
+
+		// сервисы
+		statusCode, svc, err := cl.CreateHBACService(t.Context(), "vsftpd", funcs.Pointer("ftp"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "vsftpd", svc.CN)
+
+		_, svc, err = cl.GetHBACService(t.Context(), "sudo")
+		require.NoError(t, err)
+		require.Equal(t, []string{"Sudo"}, svc.MemberOfGroup)
+
+		_, services, err := cl.GetHBACServices(t.Context())
+		require.NoError(t, err)
+		require.Len(t, services, 7)
+
+		_, err = cl.DeleteHBACService(t.Context(), "vsftpd")
+		require.NoError(t, err)
+
+		statusCode, err = cl.DeleteHBACRule(t.Context(), "devs_web")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.GetHBACRule(t.Context(), "devs_web")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+	})
+	t.Run("sudo", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+		require.NoError(t, srv.AddUser("frank", "Frank", "Black", "password1", nil))
+		require.NoError(t, srv.AddEntry("host", map[string][]string{"fqdn": {"db1.example.test"}}))
+
+		statusCode, sudoCmd, err := cl.CreateSudoCommand(t.Context(), "/usr/bin/systemctl", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "/usr/bin/systemctl", sudoCmd.Command)
+
+		_, _, err = cl.CreateSudoCommand(t.Context(), "/usr/bin/su", funcs.Pointer("switch user"))
+		require.NoError(t, err)
+
+		_, commands, err := cl.GetSudoCommands(t.Context())
+		require.NoError(t, err)
+		require.Len(t, commands, 2)
+
+		statusCode, rule, err := cl.CreateSudoRule(t.Context(), RequestSudoRule{CN: "dba", Order: funcs.Pointer(10)})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.True(t, rule.Enabled)
+		require.Equal(t, 10, rule.Order)
+
+		_, err = cl.AddSudoRuleMembers(t.Context(), "dba", RuleMembers{
+			Users:         []string{"frank"},
+			Hosts:         []string{"db1.example.test"},
+			AllowCommands: []string{"/usr/bin/systemctl"},
+			DenyCommands:  []string{"/usr/bin/su"},
+			RunAsUsers:    []string{freeipatest.AdminUID},
+		})
+		require.NoError(t, err)
+
+		_, err = cl.AddSudoRuleOption(t.Context(), "dba", "!authenticate")
+		require.NoError(t, err)
+
+		_, err = cl.AddSudoRuleOption(t.Context(), "dba", "!authenticate")
+		require.ErrorIs(t, err, ErrDuplicateEntry)
+
+		_, rule, err = cl.GetSudoRule(t.Context(), "dba")
+		require.NoError(t, err)
+		require.Equal(t, []string{"frank"}, rule.MemberUser)
+		require.Equal(t, []string{"db1.example.test"}, rule.MemberHost)
+		require.Equal(t, []string{"/usr/bin/systemctl"}, rule.AllowCommand)
+		require.Equal(t, []string{"/usr/bin/su"}, rule.DenyCommand)
+		require.Equal(t, []string{freeipatest.AdminUID}, rule.RunAsUser)
+		require.Equal(t, []string{"!authenticate"}, rule.Options)
+
+		_, err = cl.RemoveSudoRuleOption(t.Context(), "dba", "!authenticate")
+		require.NoError(t, err)
+
+		_, err = cl.RemoveSudoRuleMembers(t.Context(), "dba", RuleMembers{DenyCommands: []string{"/usr/bin/su"}})
+		require.NoError(t, err)
+
+		// удаленная команда пропадает из правил
+		_, err = cl.DeleteSudoCommand(t.Context(), "/usr/bin/systemctl")
+		require.NoError(t, err)
+
+		_, err = cl.DisableSudoRule(t.Context(), "dba")
+		require.NoError(t, err)
+
+		_, rules, err := cl.GetSudoRules(t.Context())
+		require.NoError(t, err)
+		require.Len(t, rules, 1)
+		require.False(t, rules[0].Enabled)
+		require.Empty(t, rules[0].AllowCommand)
+		require.Empty(t, rules[0].DenyCommand)
+		require.Empty(t, rules[0].Options)
+
+		_, err = cl.EnableSudoRule(t.Context(), "dba")
+		require.NoError(t, err)
+
+		_, err = cl.DeleteSudoRule(t.Context(), "dba")
+		require.NoError(t, err)
+	})
+	t.Run("failover", func(t *testing.T) {
+		t.Parallel()
+
+		down := freeipatest.NewServer(fakeAdminPass)
+		up := freeipatest.NewServer(fakeAdminPass)
+		t.Cleanup(up.Close)
+
+		cl := NewFreeIPAReplicas(down.Scheme(), []string{down.Host(), up.Host()}, &http.Transport{}, 5*time.Second)
+		t.Cleanup(func() { _ = cl.Close() })
+
+		_, err := cl.Login(t.Context(), freeipatest.AdminUID, fakeAdminPass)
+		require.NoError(t, err)
+		require.Equal(t, 1, down.Calls("login"))
+
+		// сессия на другой реплике своя, поэтому после переключения нужен перелогин
+		cl.EnableRelogin(StaticCredentials(freeipatest.AdminUID, fakeAdminPass))
+
+		// без этого первый запрос ушел бы в открытое keep-alive соединение и не был бы повторен (EOF)
+		_ = cl.Close()
+		down.Close()
+
+		statusCode, user, err := cl.GetUser(t.Context(), freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, freeipatest.AdminUID, user.UID)
+		require.Equal(t, 1, up.Calls("login"))
+
+		// проверки реплик получают наблюдатели
+		metrics := NewRPCMetrics()
+		cl.SetObservers(metrics)
+
+		statuses := cl.HealthCheck(t.Context())
+		require.Len(t, statuses, 2)
+		require.Equal(t, down.Host(), statuses[0].Host)
+		require.False(t, statuses[0].Healthy)
+		require.Error(t, statuses[0].Err)
+		require.False(t, statuses[0].Current)
+		require.True(t, statuses[1].Healthy)
+		require.True(t, statuses[1].Current)
+		require.NoError(t, statuses[1].Err)
+		require.False(t, statuses[1].CheckedAt.IsZero())
+
+		var out strings.Builder
+		require.NoError(t, metrics.WritePrometheus(&out))
+		require.Contains(t, out.String(), `freeipa_rpc_requests_total{method="ping",status="0"} 1`+"\n")
+		require.Contains(t, out.String(), `freeipa_rpc_errors_total{method="ping",code="transport"} 1`+"\n")
+
+		cl.SetObservers()
+
+		require.Error(t, cl.RunHealthChecks(t.Context(), 0))
+
+		// уже известные реплики не дублируются, без порта берется порт текущей реплики
+		upHost, upPort, err := net.SplitHostPort(up.Host())
+		require.NoError(t, err)
+
+		up.SetServers(strings.ToUpper(down.Host()), up.Host(), upHost, "replica.example.test")
+
+		statusCode, added, err := cl.DiscoverServers(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, []string{net.JoinHostPort("replica.example.test", upPort)}, added)
+		require.Len(t, cl.Servers(), 3)
+
+		// без реплик запрос не отправить
+		empty := NewFreeIPAReplicas("https", nil, &http.Transport{}, time.Second)
+
+		_, err = empty.Login(t.Context(), freeipatest.AdminUID, fakeAdminPass)
+		require.ErrorContains(t, err, errMsgNoServers)
+	})
+	t.Run("failover on timeout", func(t *testing.T) {
+		t.Parallel()
+
+		up := freeipatest.NewServer(fakeAdminPass)
+		t.Cleanup(up.Close)
+
+		// хост, до которого не доходят SYN: подключение висит, пока его не оборвет Client.Timeout
+		const blackhole = "blackhole.example.test"
+
+		dialer := &net.Dialer{}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if addr == blackhole+":80" {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+
+		cl := NewFreeIPAReplicas("http", []string{blackhole, up.Host()}, transport, 300*time.Millisecond)
+		t.Cleanup(func() { _ = cl.Close() })
+
+		statusCode, err := cl.Login(t.Context(), freeipatest.AdminUID, fakeAdminPass)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, 1, up.Calls("login"))
+
+		statuses := cl.Servers()
+		require.False(t, statuses[0].Healthy)
+		require.True(t, statuses[1].Current)
+
+		// сервер принял соединение, но не отвечает: запрос мог выполниться, поэтому не повторяется
+		silent, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = silent.Close() })
+
+		cl = NewFreeIPAReplicas("http", []string{silent.Addr().String(), up.Host()}, transport, 300*time.Millisecond)
+		t.Cleanup(func() { _ = cl.Close() })
+
+		_, err = cl.Login(t.Context(), freeipatest.AdminUID, fakeAdminPass)
+		require.ErrorContains(t, err, "Client.Timeout exceeded")
+		require.Equal(t, 1, up.Calls("login"))
+	})
+	t.Run("observers", func(t *testing.T) {
+		t.Parallel()
+
+		cl, _ := newFakeClient(t)
+
+		var logBuf strings.Builder
+
+		metrics := NewRPCMetrics()
+		l := slog.New(traceHandler{slog.NewJSONHandler(&logBuf, &slog.HandlerOptions{Level: slog.LevelDebug})})
+		cl.SetObservers(metrics, NewSlogObserver(l))
+
+		ctx := context.WithValue(t.Context(), "trace_id", "trace-1") //nolint:staticcheck // ключ как в pkg/logger
+
+		_, _, err := cl.GetUser(ctx, freeipatest.AdminUID)
+		require.NoError(t, err)
+
+		statusCode, _, err := cl.GetUser(ctx, "missing")
+		require.Error(t, err)
+		require.Equal(t, http.StatusNotFound, statusCode)
+
+		_, _, err = cl.AssignRoles(ctx, freeipatest.AdminUID, "missing-role")
+		require.Error(t, err)
+
+		// менять нечего (EmptyModlist) - не ошибка
+		_, err = cl.Command(ctx, "user_mod", []any{freeipatest.AdminUID}, nil, nil)
+		require.NoError(t, err)
+
+		var out strings.Builder
+		require.NoError(t, metrics.WritePrometheus(&out))
+		require.Contains(t, out.String(), "# TYPE freeipa_rpc_requests_total counter\n")
+		require.Contains(t, out.String(), `freeipa_rpc_requests_total{method="user_show",status="200"} 2`+"\n")
+		require.Contains(t, out.String(), `freeipa_rpc_errors_total{method="user_show",code="4001"} 1`+"\n")
+		require.Contains(t, out.String(), `freeipa_rpc_duration_seconds_count{method="batch"} 1`+"\n")
+		require.Contains(t, out.String(), "freeipa_rpc_batch_commands_total 1\n")
+		require.Contains(t, out.String(), "freeipa_rpc_batch_errors_total 1\n")
+		require.NotContains(t, out.String(), `freeipa_rpc_errors_total{method="user_mod"`)
+
+		lines := strings.Split(strings.TrimSpace(logBuf.String()), "\n")
+		require.Len(t, lines, 4)
+
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+		require.Equal(t, "user_show", record["method"])
+		require.Equal(t, "trace-1", record["trace_id"])
+		require.InDelta(t, 4001, record["error_code"], 0)
+
+		// без наблюдателей запросы не разбираются
+		cl.SetObservers()
+
+		_, _, err = cl.GetUser(ctx, freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Len(t, strings.Split(strings.TrimSpace(logBuf.String()), "\n"), 4)
+	})
+	t.Run("relogin", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		// без перелогина протухшая сессия отдает 401
+		srv.ExpireSessions()
+
+		statusCode, _, err := cl.GetUser(t.Context(), freeipatest.AdminUID)
+		require.Error(t, err)
+		require.Equal(t, http.StatusUnauthorized, statusCode)
+
+		cl.EnableRelogin(StaticCredentials(freeipatest.AdminUID, fakeAdminPass))
+
+		statusCode, user, err := cl.GetUser(t.Context(), freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, freeipatest.AdminUID, user.UID)
+
+		// параллельные запросы на протухшей сессии перелогиниваются один раз
+		srv.ExpireSessions()
+
+		loginsBefore := srv.Calls("login")
+		errs := make(chan error, 5)
+
+		for range 5 {
+			go func() {
+				_, _, err := cl.GetUser(t.Context(), freeipatest.AdminUID)
+				errs <- err
+			}()
+		}
+		for range 5 {
+			require.NoError(t, <-errs)
+		}
+
+		require.Equal(t, loginsBefore+1, srv.Calls("login"))
+
+		// отказ во входе запоминается: неверный пароль не отправляется на каждый запрос
+		cl.EnableRelogin(StaticCredentials(freeipatest.AdminUID, "wrong"))
+		srv.ExpireSessions()
+
+		loginsBefore = srv.Calls("login")
+
+		for range 5 {
+			go func() {
+				_, _, err := cl.GetUser(t.Context(), freeipatest.AdminUID)
+				errs <- err
+			}()
+		}
+		for range 5 {
+			require.Error(t, <-errs)
+		}
+
+		// причина отказа отдается вызывающему, а не только пишется в лог
+		statusCode, _, err = cl.GetUser(t.Context(), freeipatest.AdminUID)
+		require.ErrorIs(t, err, ErrInvalidPassword)
+		require.Equal(t, http.StatusUnauthorized, statusCode)
+		require.Equal(t, loginsBefore+1, srv.Calls("login"))
+
+		// новые учетные данные снимают запрет
+		cl.EnableRelogin(StaticCredentials(freeipatest.AdminUID, fakeAdminPass))
+
+		_, _, err = cl.GetUser(t.Context(), freeipatest.AdminUID)
+		require.NoError(t, err)
+		require.Equal(t, loginsBefore+2, srv.Calls("login"))
+	})
+	t.Run("passwords", func(t *testing.T) {
+		t.Parallel()
+
+		admin, srv := newFakeClient(t)
+		require.NoError(t, srv.AddUser("carol", "Carol", "White", "password1", nil))
+
+		// случайный пароль от админа сразу просрочен
+		statusCode, randomPass, err := admin.ResetPassword(t.Context(), "carol", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.NotEmpty(t, randomPass)
+
+		cl := NewFreeIPA(srv.Scheme(), srv.Host(), &http.Transport{}, 5*time.Second)
+		t.Cleanup(func() { _ = cl.Close() })
+
+		statusCode, err = cl.Login(t.Context(), "carol", "password1")
+		require.ErrorIs(t, err, ErrInvalidPassword)
+		require.Equal(t, http.StatusUnauthorized, statusCode)
+
+		statusCode, err = cl.Login(t.Context(), "carol", randomPass)
+		require.ErrorIs(t, err, ErrPasswordExpired)
+		require.Equal(t, http.StatusUnauthorized, statusCode)
+		require.Equal(t, codes.Unauthenticated, ToCustomError(statusCode, err).GetCode())
+
+		// смена просроченного пароля без сессии
+		statusCode, err = cl.ChangePassword(t.Context(), "carol", "wrong", "newPassword1", "")
+		require.ErrorIs(t, err, ErrInvalidPassword)
+		require.Equal(t, 0, statusCode)
+
+		statusCode, err = cl.ChangePassword(t.Context(), "carol", randomPass, "short", "")
+		require.ErrorIs(t, err, ErrPasswordPolicy)
+		require.Contains(t, err.Error(), "too short")
+		require.Equal(t, 0, statusCode)
+
+		statusCode, err = cl.ChangePassword(t.Context(), "carol", randomPass, "newPassword1", "")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = cl.Login(t.Context(), "carol", "newPassword1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// заданный админом пароль тоже просрочен
+		statusCode, pass, err := admin.ResetPassword(t.Context(), "carol", funcs.Pointer("adminPassword1"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "adminPassword1", pass)
+
+		_, err = cl.Login(t.Context(), "carol", "adminPassword1")
+		require.ErrorIs(t, err, ErrPasswordExpired)
+
+		// заблокированному пользователю вход запрещен
+		_, err = admin.DisableUser(t.Context(), "carol")
+		require.NoError(t, err)
+
+		statusCode, err = cl.Login(t.Context(), "carol", "adminPassword1")
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrPasswordExpired)
+		require.Equal(t, http.StatusUnauthorized, statusCode)
+
+		require.Equal(t, 1, srv.Calls("passwd"))
+	})
+	t.Run("pwd policy", func(t *testing.T) {
+		t.Parallel()
+
+		cl, srv := newFakeClient(t)
+
+		statusCode, maxLife, err := cl.GetKrbMaxPWDLife(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, defaultKRBMaxPWDLife, maxLife)
+
+		statusCode, global, err := cl.GetPasswordPolicy(t.Context(), "")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, GlobalPasswordPolicy, global.Group)
+		require.Equal(t, 8, global.MinLength)
+		require.Equal(t, 6, global.MaxFail)
+		require.Nil(t, global.Priority)
+
+		statusCode, global, err = cl.UpdatePasswordPolicy(t.Context(), RequestPasswordPolicy{
+			MaxLife:   funcs.Pointer(30),
+			MinLength: funcs.Pointer(10),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, 30, global.MaxLife)
+		require.Equal(t, 10, global.MinLength)
+
+		_, _, err = cl.UpdatePasswordPolicy(t.Context(), RequestPasswordPolicy{Priority: funcs.Pointer(1)})
+		require.ErrorIs(t, err, ErrValidation)
+
+		_, err = cl.DeletePasswordPolicy(t.Context(), GlobalPasswordPolicy)
+		require.ErrorIs(t, err, ErrValidation)
+
+		// групповая политика
+		_, _, err = cl.CreateGroup(t.Context(), RequestGroup{CN: "ops"})
+		require.NoError(t, err)
+
+		_, _, err = cl.CreatePasswordPolicy(t.Context(), RequestPasswordPolicy{Group: "ops", MinLength: funcs.Pointer(4)})
+		require.ErrorIs(t, err, ErrRequirement)
+
+		_, _, err = cl.CreatePasswordPolicy(t.Context(), RequestPasswordPolicy{Group: "nope", Priority: funcs.Pointer(1)})
+		require.ErrorIs(t, err, ErrNotFound)
+
+		statusCode, opsPolicy, err := cl.CreatePasswordPolicy(t.Context(), RequestPasswordPolicy{
+			Group:     "ops",
+			Priority:  funcs.Pointer(5),
+			MinLength: funcs.Pointer(4),
+			MaxFail:   funcs.Pointer(3),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, "ops", opsPolicy.Group)
+		require.Equal(t, funcs.Pointer(5), opsPolicy.Priority)
+
+		statusCode, policies, err := cl.GetPasswordPolicies(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Len(t, policies, 2)
+
+		require.NoError(t, srv.AddUser("dave", "Dave", "Brown", "password1", nil))
+
+		_, userPolicy, err := cl.GetUserPasswordPolicy(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Equal(t, GlobalPasswordPolicy, userPolicy.Group)
+
+		_, err = cl.AddGroupMembers(t.Context(), "ops", []string{"dave"}, nil)
+		require.NoError(t, err)
+
+		_, userPolicy, err = cl.GetUserPasswordPolicy(t.Context(), "dave")
+		require.NoError(t, err)
+		require.Equal(t, "ops", userPolicy.Group)
+		require.Equal(t, 3, userPolicy.MaxFail)
+
+		// для dave действует групповая политика (длина от 4), хотя глобальная требует 10
+		_, err = cl.ChangePassword(t.Context(), "dave", "password1", "pass", "")
+		require.NoError(t, err)
+
+		statusCode, err = cl.DeletePasswordPolicy(t.Context(), "ops")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.GetPasswordPolicy(t.Context(), "ops")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+
+		// обычному пользователю политика не видна
+		require.NoError(t, srv.AddUser("bob", "Bob", "Smith", "password1", nil))
+
+		statusCode, err = cl.Login(t.Context(), "bob", "password1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.GetKrbMaxPWDLife(t.Context())
+		require.ErrorIs(t, err, ErrNotFound)
+		require.Equal(t, http.StatusNotFound, statusCode)
+
+		// и чужие данные менять нельзя
+		statusCode, err = cl.UpdateUser(t.Context(), RequestUser{UID: freeipatest.AdminUID, SN: "x"})
+		require.ErrorIs(t, err, ErrACI)
+		require.Equal(t, 0, statusCode)
+	})
+}
@@ -6,95 +6,118 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"slices"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-
-	"github.com/volodya-nrg/tools/pkg/funcs"
 )
 
 const (
-	limitDefault                = 20
-	timeLayout                  = "20060102150405Z"
-	apiVersion                  = "2.254"
-	keyOptUID                   = "uid"
-	keyOptDN                    = "dn"
-	keyOptGivenName             = "givenname"
-	keyOptSN                    = "sn"
-	keyOptUser                  = "user"
-	keyOptUserPassword          = "userpassword"
-	keyOptKRBPasswordExpiration = "krbpasswordexpiration"
-	keyOptMail                  = "mail"
-	keyOptNSAccountLock         = "nsaccountlock"
-	keyOptRandom                = "random"
-	keyOptVersion               = "version"
-	keyOptDescription           = "description"
-	keyOptCN                    = "cn"
-	keyOptTelephoneNumber       = "telephonenumber"
-	keyOptMobile                = "mobile"
-	keyOptTitle                 = "title"
-	keyOptOU                    = "ou"
-	keyOptO                     = "o" // organization
-	keyOptMemberofGroup         = "memberof_group"
-	keyOptMemberofRole          = "memberof_role"
-	keyOptAddAttr               = "addattr"
-	keyOptJPEGPhoto             = "jpegphoto"
-	keyOptObjectClass           = "objectclass"
-	keyOptMemberUser            = "member_user"
-	keyKRBMaxPWDLife            = "krbmaxpwdlife" //nolint:gosec
-	defaultKRBMaxPWDLife        = 90              // в днях
+	limitDefault         = 20
+	timeLayout           = "20060102150405Z"
+	apiVersion           = "2.254"
+	keyOptGivenName      = "givenname"
+	keyOptSN             = "sn"
+	keyOptUser           = "user"
+	keyOptUserPassword   = "userpassword"
+	keyOptRandom         = "random"
+	keyOptVersion        = "version"
+	keyOptDescription    = "description"
+	keyOptGroup          = "group"
+	keyOptGIDNumber      = "gidnumber"
+	keyOptNonPosix       = "nonposix"
+	keyOptExternal       = "external"
+	keyOptPreserve       = "preserve"
+	keyOptRandomPassword = "randompassword" //nolint:gosec
+	keyOptSetAttr        = "setattr"
+	keyOptAddAttr        = "addattr"
+	keyOptDelAttr        = "delattr"
+	defaultKRBMaxPWDLife = 90 // в днях
+	// reloginBackoff столько после отказа во входе перелогин не пробуется, чтобы неверный пароль
+	// не исчерпал krbmaxfailed и не заблокировал учетную запись
+	reloginBackoff = 30 * time.Second
 )
 
+var errReloginSuspended = errors.New("relogin suspended after rejected login")
+
+// DeleteUserOption опция удаления пользователя, см. DeleteUser
+type DeleteUserOption func(opts map[string]any)
+
+// WithPreserve удаление с сохранением (user_del --preserve): аккаунт уходит в deleted users,
+// войти нельзя, членство в группах и ролях снимается, но uid/uidnumber не переиспользуются.
+// Вернуть можно через UndeleteUser.
+func WithPreserve() DeleteUserOption {
+	return func(opts map[string]any) {
+		opts[keyOptPreserve] = true
+	}
+}
+
+// CredentialsProvider отдает логин и пароль для повторной аутентификации (см. EnableRelogin)
+type CredentialsProvider func(ctx context.Context) (string, string, error)
+
+// loginReject отказ во входе при перелогине для сессии session
+type loginReject struct {
+	session sessionRef
+	at      time.Time
+	err     error
+}
+
 // FreeIPA клиент для общения с сервером IPA. Ошибки все таки надо различать: внутренние и ошибки от response-а.
 type FreeIPA struct {
-	scheme     string
-	host       string
-	client     *http.Client
-	apiVersion string
+	scheme      string
+	servers     *serverPool // реплики, у каждой свой http-клиент с куками сессии
+	apiVersion  string
+	credentials CredentialsProvider           // если задан, то при протухшей сессии перелогиниваемся
+	reloginMu   sync.Mutex                    // защищает credentials, loginReject и сам перелогин
+	loginReject *loginReject                  // последний отказ во входе при перелогине
+	schema      atomic.Pointer[Schema]        // если загружена, то Command проверяет по ней команды
+	observers   atomic.Pointer[[]RPCObserver] // см. SetObservers
 }
 
 func (f *FreeIPA) Close() error {
-	f.client.CloseIdleConnections()
+	f.servers.closeIdleConnections()
 	return nil
 }
 
 // Login специальный/отдельный запрос на аутентификацию (не jsonRPC)
 func (f *FreeIPA) Login(ctx context.Context, userID, password string) (int, error) {
-	values := url.Values{
-		"user":     []string{userID},
-		"password": []string{password},
-	}
-	u := url.URL{
-		Scheme: f.scheme,
-		Host:   f.host,
-		Path:   "ipa/session/login_password",
-	}
-	headers := map[string]string{
-		"Referer": fmt.Sprintf("%s://%s/ipa", f.scheme, f.host),
-	}
+	f.reloginMu.Lock()
+	defer f.reloginMu.Unlock()
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, []byte(values.Encode()), headers)
-	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
-	}
+	return f.login(ctx, userID, password)
+}
 
-	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
-	if err != nil {
-		return newStatusCode, err
-	}
+// EnableRelogin включает режим, при котором клиент на 401 (истекшая сессия) один раз заново
+// аутентифицируется через provider и прозрачно повторяет исходный запрос.
+// После явного Logout следующий запрос тоже перелогинится, для отключения есть DisableRelogin.
+// Если сервер отказал во входе, то reloginBackoff запросы не перелогиниваются, а сразу отдают 401.
+func (f *FreeIPA) EnableRelogin(provider CredentialsProvider) {
+	f.reloginMu.Lock()
+	defer f.reloginMu.Unlock()
 
-	return newStatusCode, nil
+	f.credentials = provider
+	f.loginReject = nil
+}
+
+func (f *FreeIPA) DisableRelogin() {
+	f.EnableRelogin(nil)
+}
+
+// StaticCredentials провайдер для EnableRelogin с запомненными логином и паролем
+func StaticCredentials(userID, password string) CredentialsProvider {
+	return func(context.Context) (string, string, error) {
+		return userID, password, nil
+	}
 }
 
 func (f *FreeIPA) Logout(ctx context.Context) (int, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 
@@ -103,9 +126,10 @@ func (f *FreeIPA) Logout(ctx context.Context) (int, error) {
 		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	// без перелогина, иначе выход из уже закрытой сессии сначала ее откроет
+	_, statusCode, bodyBytes, err := f.rawHTTPRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
@@ -120,46 +144,49 @@ func (f *FreeIPA) Logout(ctx context.Context) (int, error) {
 
 // GetUsers получение пользователей
 func (f *FreeIPA) GetUsers(ctx context.Context, limit, offset int32) (int, []User, uint32, error) {
-	u := url.URL{
-		Scheme: f.scheme,
-		Host:   f.host,
-		Path:   "ipa/session/json",
-	}
-	opts := map[string]any{
-		"pkey_only": true,
-	}
+	return f.FindUsers(ctx, UserQuery{}, limit, offset)
+}
 
-	// список пользователей отдается в алфавитном порядке по uid
-	req, err := f.rpcReq("user_find", "", opts, true)
-	if err != nil {
-		return 0, nil, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (user_find): %s", err)
+// FindUsers поиск пользователей на стороне сервера (user_find) с сортировкой и пагинацией.
+// Сервер отдает только подходящих пользователей, страница вырезается локально и дочитывается через batch.
+// Если сервер обрезал выборку не по query.SizeLimit (лимит LDAP), то это ошибка ErrSizeLimitExceeded.
+func (f *FreeIPA) FindUsers(ctx context.Context, query UserQuery, limit, offset int32) (int, []User, uint32, error) {
+	opts := query.toOpts()
+
+	// по uid сервер сортирует сам, для остальных полей нужны атрибуты
+	if query.SortBy == "" || query.SortBy == UserSortByUID {
+		opts["pkey_only"] = true
+	} else {
+		opts["no_members"] = true
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
-	if err != nil {
-		return 0, nil, 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+	var args string
+	if query.Criteria != "" {
+		args = rpcArgs(query.Criteria)
 	}
 
-	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
+	statusCode, resp, err := f.sendRPC(ctx, "user_find", args, opts)
 	if err != nil {
-		return newStatusCode, nil, 0, err
+		return statusCode, nil, 0, err
 	}
 	if resp.Result == nil {
 		return 0, nil, 0, errors.New(errMsgResponseResultIsNil)
 	}
+	if resp.Result.Truncated && query.SizeLimit == 0 {
+		return 0, nil, 0, newTruncatedError("user_find", resp.Result.Count)
+	}
 
 	users := make([]User, 0)
 	total := resp.Result.Count
 
-	if usersList, ok := resp.Result.Result.([]any); ok {
-		users = make([]User, 0, len(usersList))
-		for _, user := range usersList {
-			if userTmp, ok := user.(map[string]any); ok {
-				users = append(users, mapUserToDTOUser(userTmp))
-			}
+	if resp.Result.Result != nil {
+		if users, err = decodeList(resp.Result.Result, userCodec); err != nil {
+			return 0, nil, 0, err
 		}
 	}
 
+	sortUsers(users, query.SortBy, query.SortDesc)
+
 	targetUsers := getRangeFromSlice(users, limit, offset, limitDefault)
 	methods := make([]string, len(targetUsers))
 	opts = map[string]any{
@@ -168,7 +195,7 @@ func (f *FreeIPA) GetUsers(ctx context.Context, limit, offset int32) (int, []Use
 	}
 
 	for i, user := range targetUsers {
-		method, err := f.rpcReq("user_show", fmt.Sprintf(`["%s"]`, user.UID), opts, false)
+		method, err := f.rpcReq("user_show", rpcArgs(user.UID), opts, false)
 		if err != nil {
 			return 0, nil, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (user_show): %s", err)
 		}
@@ -176,19 +203,9 @@ func (f *FreeIPA) GetUsers(ctx context.Context, limit, offset int32) (int, []Use
 		methods[i] = string(method)
 	}
 
-	req, err = f.rpcReq("batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil, true)
+	statusCode, resp, err = f.sendRPC(ctx, "batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil)
 	if err != nil {
-		return 0, nil, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (batch): %s", err)
-	}
-
-	statusCode, bodyBytes, err = f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
-	if err != nil {
-		return 0, nil, 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
-	}
-
-	newStatusCode, resp, err = f.handleResponse(statusCode, bodyBytes)
-	if err != nil {
-		return newStatusCode, nil, 0, err
+		return statusCode, nil, 0, err
 	}
 	if resp.Result == nil {
 		return 0, nil, 0, errors.New(errMsgResponseResultIsNil)
@@ -198,17 +215,22 @@ func (f *FreeIPA) GetUsers(ctx context.Context, limit, offset int32) (int, []Use
 
 	for _, result := range resp.Result.Results {
 		if userTmp, ok := result.Result.(map[string]any); ok {
-			users = append(users, mapUserToDTOUser(userTmp))
+			user, err := decodeEntry(userTmp, userCodec)
+			if err != nil {
+				return 0, nil, 0, err
+			}
+
+			users = append(users, user)
 		}
 	}
 
-	return newStatusCode, users, total, nil
+	return statusCode, users, total, nil
 }
 
 func (f *FreeIPA) GetUser(ctx context.Context, userID string) (int, *User, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 	opts := map[string]any{
@@ -220,9 +242,9 @@ func (f *FreeIPA) GetUser(ctx context.Context, userID string) (int, *User, error
 		return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
@@ -238,7 +260,10 @@ func (f *FreeIPA) GetUser(ctx context.Context, userID string) (int, *User, error
 		return 0, nil, errors.New(errMsgFailedToParseResponse)
 	}
 
-	user := mapUserToDTOUser(userTmp)
+	user, err := decodeEntry(userTmp, userCodec)
+	if err != nil {
+		return 0, nil, err
+	}
 
 	return newStatusCode, &user, nil
 }
@@ -246,45 +271,12 @@ func (f *FreeIPA) GetUser(ctx context.Context, userID string) (int, *User, error
 func (f *FreeIPA) CreateUser(ctx context.Context, reqUser RequestUser) (int, *User, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
-	opts := map[string]any{
-		keyOptGivenName: reqUser.GivenName,
-		keyOptSN:        reqUser.SN,
-	}
-
-	if reqUser.UserPassword != nil {
-		opts[keyOptUserPassword] = *reqUser.UserPassword
-	} else {
-		opts[keyOptRandom] = true
-	}
-	if reqUser.KRBPasswordExpiration != nil {
-		opts[keyOptKRBPasswordExpiration] = reqUser.KRBPasswordExpiration.Format(timeLayout) // спец. формат
-	}
-	if reqUser.Mail != nil {
-		opts[keyOptMail] = *reqUser.Mail
-	}
-	if reqUser.NsAccountLock != nil {
-		opts[keyOptNSAccountLock] = *reqUser.NsAccountLock
-	}
-	if reqUser.CN != nil {
-		opts[keyOptCN] = *reqUser.CN
-	}
-	if reqUser.TelephoneNumber != nil {
-		opts[keyOptTelephoneNumber] = *reqUser.TelephoneNumber
-	}
-	if reqUser.Mobile != nil {
-		opts[keyOptMobile] = *reqUser.Mobile
-	}
-	if reqUser.Title != nil {
-		opts[keyOptTitle] = *reqUser.Title
-	}
-	if reqUser.OU != nil {
-		opts[keyOptOU] = *reqUser.OU
-	}
-	if len(reqUser.AddAttr) > 0 {
-		opts[keyOptAddAttr] = reqUser.AddAttr
+	opts, err := reqUser.toAddOpts()
+	if err != nil {
+		return 0, nil, err
 	}
 
 	req, err := f.rpcReq("user_add", fmt.Sprintf(`["%s"]`, reqUser.UID), opts, true)
@@ -292,9 +284,9 @@ func (f *FreeIPA) CreateUser(ctx context.Context, reqUser RequestUser) (int, *Us
 		return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
@@ -310,47 +302,126 @@ func (f *FreeIPA) CreateUser(ctx context.Context, reqUser RequestUser) (int, *Us
 		return 0, nil, errors.New(errMsgFailedToParseResponse)
 	}
 
-	user := mapUserToDTOUser(userTmp)
+	user, err := decodeEntry(userTmp, userCodec)
+	if err != nil {
+		return 0, nil, err
+	}
 
 	return newStatusCode, &user, nil
 }
 
-// UpdateUser тут лучше пользователя обратно не отдавать, т.к. он имеет не полные данные
-func (f *FreeIPA) UpdateUser(ctx context.Context, reqUser RequestUser) (int, error) {
-	u := url.URL{
-		Scheme: f.scheme,
-		Host:   f.host,
-		Path:   "ipa/session/json",
+// toAddOpts опции для user_add/stageuser_add, без пароля IPA генерирует случайный
+func (r RequestUser) toAddOpts() (map[string]any, error) {
+	if len(r.DelAttr) > 0 || len(r.ClearAttr) > 0 {
+		return nil, errors.New("delattr and clear are supported only on update")
+	}
+
+	opts := r.toModOpts()
+	opts[keyOptGivenName] = r.GivenName
+	opts[keyOptSN] = r.SN
+
+	if r.UserPassword == nil {
+		opts[keyOptRandom] = true
 	}
+
+	return opts, nil
+}
+
+// toModOpts опции для user_mod: пустые GivenName и SN не меняются (атрибуты обязательные)
+func (r RequestUser) toModOpts() map[string]any {
 	opts := map[string]any{}
 
-	if reqUser.GivenName != "" {
-		opts[keyOptGivenName] = reqUser.GivenName
+	if r.GivenName != "" {
+		opts[keyOptGivenName] = r.GivenName
 	}
-	if reqUser.SN != "" {
-		opts[keyOptSN] = reqUser.SN
+	if r.SN != "" {
+		opts[keyOptSN] = r.SN
 	}
-	if reqUser.UserPassword != nil { // если пароль изменят, то время (KRBPasswordExpiration) не учитывается
-		opts[keyOptUserPassword] = *reqUser.UserPassword
+	if r.KRBPasswordExpiration != nil {
+		opts["krbpasswordexpiration"] = datetimeOpt(*r.KRBPasswordExpiration)
 	}
-	if reqUser.KRBPasswordExpiration != nil {
-		opts[keyOptKRBPasswordExpiration] = reqUser.KRBPasswordExpiration.Format(timeLayout) // спец. формат
+
+	putOpt(opts, "mail", r.Mail)
+	putOpt(opts, keyOptUserPassword, r.UserPassword)
+	putOpt(opts, "nsaccountlock", r.NsAccountLock)
+	putOpt(opts, "cn", r.CN)
+	putOpt(opts, "telephonenumber", r.TelephoneNumber)
+	putOpt(opts, "mobile", r.Mobile)
+	putOpt(opts, "title", r.Title)
+	putOpt(opts, "ou", r.OU)
+
+	setAttr := slices.Clone(r.SetAttr)
+	for _, attr := range r.ClearAttr {
+		setAttr = append(setAttr, attr+"=")
+	}
+
+	for key, values := range map[string][]string{
+		keyOptAddAttr: r.AddAttr,
+		keyOptSetAttr: setAttr,
+		keyOptDelAttr: r.DelAttr,
+	} {
+		if len(values) > 0 {
+			putListOpt(opts, key, values)
+		}
+	}
+
+	return opts
+}
+
+// toOpts опции user_find, пустые поля не передаются
+func (q UserQuery) toOpts() map[string]any {
+	opts := map[string]any{}
+
+	putOpt(opts, "uid", q.UID)
+	putOpt(opts, "mail", q.Mail)
+	putOpt(opts, keyOptGivenName, q.GivenName)
+	putOpt(opts, keyOptSN, q.SN)
+	putOpt(opts, "nsaccountlock", q.Disabled)
+	putOpt(opts, "preserved", q.Preserved)
+
+	for key, values := range map[string][]string{
+		"in_group":     q.InGroup,
+		"not_in_group": q.NotInGroup,
+		"in_role":      q.InRole,
+	} {
+		if len(values) > 0 {
+			putListOpt(opts, key, values)
+		}
 	}
-	if reqUser.Mail != nil {
-		opts[keyOptMail] = *reqUser.Mail
+
+	// без sizelimit IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	opts["sizelimit"] = q.SizeLimit
+
+	return opts
+}
+
+// UpdateUser тут лучше пользователя обратно не отдавать, т.к. он имеет не полные данные.
+// Если меняется пароль, KRBPasswordExpiration не учитывается. Если менять нечего, запрос не отправляется.
+func (f *FreeIPA) UpdateUser(ctx context.Context, reqUser RequestUser) (int, error) {
+	return f.updateUser(ctx, reqUser.UID, reqUser.toModOpts())
+}
+
+// DeleteUser удаление пользователя (user_del), по умолчанию безвозвратное, см. WithPreserve
+func (f *FreeIPA) DeleteUser(ctx context.Context, userID string, options ...DeleteUserOption) (int, error) {
+	u := url.URL{
+		Scheme: f.scheme,
+		Host:   f.host(),
+		Path:   "ipa/session/json",
 	}
-	if reqUser.NsAccountLock != nil {
-		opts[keyOptNSAccountLock] = *reqUser.NsAccountLock
+	opts := map[string]any{}
+
+	for _, option := range options {
+		option(opts)
 	}
 
-	req, err := f.rpcReq("user_mod", fmt.Sprintf(`["%s"]`, reqUser.UID), opts, true)
+	req, err := f.rpcReq("user_del", fmt.Sprintf(`["%s"]`, userID), opts, true)
 	if err != nil {
 		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
@@ -361,29 +432,39 @@ func (f *FreeIPA) UpdateUser(ctx context.Context, reqUser RequestUser) (int, err
 	return newStatusCode, nil
 }
 
-func (f *FreeIPA) DeleteUser(ctx context.Context, userID string) (int, error) {
-	u := url.URL{
-		Scheme: f.scheme,
-		Host:   f.host,
-		Path:   "ipa/session/json",
-	}
-
-	req, err := f.rpcReq("user_del", fmt.Sprintf(`["%s"]`, userID), nil, true)
+// DisableUser блокирует аккаунт (user_disable)
+func (f *FreeIPA) DisableUser(ctx context.Context, userID string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "user_disable", rpcArgs(userID), nil)
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
+		return statusCode, err
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	return statusCode, nil
+}
+
+// EnableUser разблокирует аккаунт (user_enable)
+func (f *FreeIPA) EnableUser(ctx context.Context, userID string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "user_enable", rpcArgs(userID), nil)
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, err
 	}
 
-	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
+	return statusCode, nil
+}
+
+// PreserveUser то же, что DeleteUser с WithPreserve
+func (f *FreeIPA) PreserveUser(ctx context.Context, userID string) (int, error) {
+	return f.DeleteUser(ctx, userID, WithPreserve())
+}
+
+// UndeleteUser восстановление сохраненного пользователя (user_undel)
+func (f *FreeIPA) UndeleteUser(ctx context.Context, userID string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "user_undel", rpcArgs(userID), nil)
 	if err != nil {
-		return newStatusCode, err
+		return statusCode, err
 	}
 
-	return newStatusCode, nil
+	return statusCode, nil
 }
 
 // roles
@@ -392,7 +473,7 @@ func (f *FreeIPA) DeleteUser(ctx context.Context, userID string) (int, error) {
 func (f *FreeIPA) GetRoles(ctx context.Context, limit, offset int32) (int, []Role, uint32, error) {
 	statusCode, roles, total, err := f.getAllRoles(ctx)
 	if err != nil {
-		return statusCode, nil, 0, fmt.Errorf("failed to get all roles: %s", err)
+		return statusCode, nil, 0, fmt.Errorf("failed to get all roles: %w", err)
 	}
 
 	roles = getRangeFromSlice(roles, limit, offset, limitDefault)
@@ -404,7 +485,7 @@ func (f *FreeIPA) GetRoles(ctx context.Context, limit, offset int32) (int, []Rol
 
 	statusCode, roles, err = f.getAllRolesByName(ctx, names)
 	if err != nil {
-		return statusCode, nil, 0, fmt.Errorf("failed to get all roles by name: %s", err)
+		return statusCode, nil, 0, fmt.Errorf("failed to get all roles by name: %w", err)
 	}
 
 	return statusCode, roles, total, nil
@@ -418,7 +499,7 @@ func (f *FreeIPA) GetRolesByName(ctx context.Context, names []string) (int, []Ro
 func (f *FreeIPA) GetRole(ctx context.Context, name string) (int, *Role, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 	opts := map[string]any{
@@ -430,9 +511,9 @@ func (f *FreeIPA) GetRole(ctx context.Context, name string) (int, *Role, error)
 		return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
@@ -448,7 +529,10 @@ func (f *FreeIPA) GetRole(ctx context.Context, name string) (int, *Role, error)
 		return 0, nil, errors.New(errMsgFailedToParseResponse)
 	}
 
-	role := mapUserToDTORole(roleTmp)
+	role, err := decodeEntry(roleTmp, roleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
 
 	return newStatusCode, &role, nil
 }
@@ -456,7 +540,7 @@ func (f *FreeIPA) GetRole(ctx context.Context, name string) (int, *Role, error)
 func (f *FreeIPA) HasRole(ctx context.Context, name string) (int, bool, error) {
 	statusCode, roles, _, err := f.getAllRoles(ctx)
 	if err != nil {
-		return statusCode, false, fmt.Errorf("failed to get all roles: %s", err)
+		return statusCode, false, fmt.Errorf("failed to get all roles: %w", err)
 	}
 
 	return statusCode, slices.ContainsFunc(roles, func(role Role) bool {
@@ -467,7 +551,7 @@ func (f *FreeIPA) HasRole(ctx context.Context, name string) (int, bool, error) {
 func (f *FreeIPA) CreateRole(ctx context.Context, name string, desc *string) (int, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 	opts := map[string]any{}
@@ -481,9 +565,9 @@ func (f *FreeIPA) CreateRole(ctx context.Context, name string, desc *string) (in
 		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
@@ -497,7 +581,7 @@ func (f *FreeIPA) CreateRole(ctx context.Context, name string, desc *string) (in
 func (f *FreeIPA) UpdateRole(ctx context.Context, name, desc string) (int, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 	opts := map[string]any{
@@ -509,9 +593,9 @@ func (f *FreeIPA) UpdateRole(ctx context.Context, name, desc string) (int, error
 		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
@@ -525,7 +609,7 @@ func (f *FreeIPA) UpdateRole(ctx context.Context, name, desc string) (int, error
 func (f *FreeIPA) DeleteRole(ctx context.Context, name string) (int, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 
@@ -534,9 +618,9 @@ func (f *FreeIPA) DeleteRole(ctx context.Context, name string) (int, error) {
 		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
@@ -547,88 +631,151 @@ func (f *FreeIPA) DeleteRole(ctx context.Context, name string) (int, error) {
 	return newStatusCode, nil
 }
 
+// ToggleRoleForUser переключает роль пользователя по его текущему состоянию.
+//
+// Deprecated: между чтением и изменением состояние может поменяться, используйте AssignRoles/RevokeRoles.
 func (f *FreeIPA) ToggleRoleForUser(ctx context.Context, roleName, userID string) (int, error) {
 	statusCode, user, err := f.GetUser(ctx, userID)
 	if err != nil {
-		return statusCode, fmt.Errorf("failed to get user: %s", err)
+		return statusCode, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	return f.editRoleForUser(ctx, roleName, userID, slices.Contains(user.MemberOfRole, roleName))
 }
 
+// AddRoleMembers добавляет в роль пользователей, группы, хосты, группы хостов и сервисы
+func (f *FreeIPA) AddRoleMembers(ctx context.Context, roleName string, members RoleMembers) (int, error) {
+	return f.editMembers(ctx, "role", roleName, members.toMembers(), false)
+}
+
+func (f *FreeIPA) RemoveRoleMembers(ctx context.Context, roleName string, members RoleMembers) (int, error) {
+	return f.editMembers(ctx, "role", roleName, members.toMembers(), true)
+}
+
+// toMembers опции role_add_member/role_remove_member
+func (r RoleMembers) toMembers() map[string][]string {
+	return map[string][]string{
+		keyOptUser:      r.Users,
+		keyOptGroup:     r.Groups,
+		keyOptHost:      r.Hosts,
+		keyOptHostGroup: r.HostGroups,
+		"service":       r.Services,
+	}
+}
+
+// AddRolePrivileges выдает роли привилегии
+func (f *FreeIPA) AddRolePrivileges(ctx context.Context, roleName string, privileges []string) (int, error) {
+	return f.sendMembersRPC(ctx, "role_add_privilege", roleName, map[string][]string{keyOptPrivilege: privileges})
+}
+
+func (f *FreeIPA) RemoveRolePrivileges(ctx context.Context, roleName string, privileges []string) (int, error) {
+	return f.sendMembersRPC(ctx, "role_remove_privilege", roleName, map[string][]string{keyOptPrivilege: privileges})
+}
+
+// GetKrbMaxPWDLife срок жизни пароля по глобальной политике, в днях (вся политика - GetPasswordPolicy)
 func (f *FreeIPA) GetKrbMaxPWDLife(ctx context.Context) (int, int, error) {
-	u := url.URL{
-		Scheme: f.scheme,
-		Host:   f.host,
-		Path:   "ipa/session/json",
+	statusCode, policy, err := f.GetPasswordPolicy(ctx, "")
+	if err != nil {
+		return statusCode, 0, err
 	}
-	opts := map[string]any{
-		// "all": true,
+
+	krbMaxPWDLife := defaultKRBMaxPWDLife
+
+	if policy.MaxLife > 0 {
+		krbMaxPWDLife = policy.MaxLife
 	}
 
-	req, err := f.rpcReq("pwpolicy_show", "", opts, true)
-	if err != nil {
-		return 0, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
+	return statusCode, krbMaxPWDLife, nil
+}
+
+// login без блокировки reloginMu, вызывающий должен ее держать
+func (f *FreeIPA) login(ctx context.Context, userID, password string) (int, error) {
+	values := url.Values{
+		"user":     []string{userID},
+		"password": []string{password},
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	session, statusCode, header, bodyBytes, err := f.formRequest(ctx, "ipa/session/login_password", values)
 	if err != nil {
-		return 0, 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
-	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
+	// причину отказа (в т.ч. просроченный пароль) IPA отдает только в заголовке
+	if statusCode == http.StatusUnauthorized {
+		if rejectionErr := newRejectionError(header.Get(headerRejectionReason)); rejectionErr != nil {
+			return statusCode, fmt.Errorf("original http-statusCode %d: %w", statusCode, rejectionErr)
+		}
+	}
+
+	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
 	if err != nil {
-		return newStatusCode, 0, err
+		return newStatusCode, err
 	}
-	if resp.Result == nil {
-		return 0, 0, errors.New(errMsgResponseResultIsNil)
+
+	session.server.sessionGen.Add(1)
+
+	return newStatusCode, nil
+}
+
+// relogin заново аутентифицируется, если сессию реплики еще никто не обновил после запроса session.
+// Возвращает false, если перелогин выключен.
+func (f *FreeIPA) relogin(ctx context.Context, session sessionRef) (bool, error) {
+	f.reloginMu.Lock()
+	defer f.reloginMu.Unlock()
+
+	if f.credentials == nil {
+		return false, nil
+	}
+	// пока ждали блокировку, сессию уже обновил параллельный запрос
+	if session.server.sessionGen.Load() != session.gen {
+		return true, nil
 	}
 
-	respPWPolicy, ok := resp.Result.Result.(map[string]any)
-	if !ok {
-		return 0, 0, errors.New(errMsgFailedToParseResponse)
+	// вход с этой сессией уже отклонен: тот же пароль снова не отправляем
+	if reject := f.loginReject; reject != nil && reject.session == session && time.Since(reject.at) < reloginBackoff {
+		return false, fmt.Errorf("%w: %w", errReloginSuspended, reject.err)
 	}
 
-	krbMaxPWDLife := defaultKRBMaxPWDLife
+	userID, password, err := f.credentials(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get credentials: %w", err)
+	}
 
-	for k1, v1 := range respPWPolicy {
-		if k1 == keyKRBMaxPWDLife && isNotEmptySlice(v1) {
-			if v2, ok := v1.([]any); ok {
-				strSlice := convertSliceAnyToSliceStr(v2)
-				if krbMaxPWDLife, err = strconv.Atoi(strSlice[0]); err != nil {
-					return 0, 0, errors.New("failed to parse krbMaxPWDLife")
-				}
-			}
+	statusCode, err := f.login(ctx, userID, password)
+	if err != nil {
+		err = fmt.Errorf("failed to login: %w", err)
+		if statusCode == http.StatusUnauthorized {
+			f.loginReject = &loginReject{session: session, at: time.Now(), err: err}
 		}
+
+		return false, err
 	}
 
-	return newStatusCode, krbMaxPWDLife, nil
-}
+	f.loginReject = nil
 
-func (f *FreeIPA) editRoleForUser(ctx context.Context, roleName, userID string, isRemove bool) (int, error) {
-	method := "role_add_member"
+	return true, nil
+}
 
-	if isRemove {
-		method = "role_remove_member"
+// updateUser user_mod с уже собранными опциями, без опций запрос не отправляется
+func (f *FreeIPA) updateUser(ctx context.Context, userID string, opts map[string]any) (int, error) {
+	if len(opts) == 0 {
+		return http.StatusOK, nil
 	}
 
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
-	opts := map[string]any{
-		keyOptUser: userID,
-	}
 
-	req, err := f.rpcReq(method, fmt.Sprintf(`["%s"]`, roleName), opts, true)
+	req, err := f.rpcReq("user_mod", fmt.Sprintf(`["%s"]`, userID), opts, true)
 	if err != nil {
 		return 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, _, err := f.handleResponse(statusCode, bodyBytes)
@@ -639,10 +786,24 @@ func (f *FreeIPA) editRoleForUser(ctx context.Context, roleName, userID string,
 	return newStatusCode, nil
 }
 
+// editRoleForUser в отличие от editMembers не проверяет failed: пользователь, уже состоящий в роли
+// (или уже исключенный), - не ошибка, как и раньше у ToggleRoleForUser
+func (f *FreeIPA) editRoleForUser(ctx context.Context, roleName, userID string, isRemove bool) (int, error) {
+	method := "role_add_member"
+
+	if isRemove {
+		method = "role_remove_member"
+	}
+
+	statusCode, _, err := f.sendRPC(ctx, method, rpcArgs(roleName), map[string]any{keyOptUser: userID})
+
+	return statusCode, err
+}
+
 func (f *FreeIPA) getAllRoles(ctx context.Context) (int, []Role, uint32, error) {
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 	opts := map[string]any{
@@ -654,9 +815,9 @@ func (f *FreeIPA) getAllRoles(ctx context.Context) (int, []Role, uint32, error)
 		return 0, nil, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+": %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, nil, 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, nil, 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
@@ -681,7 +842,12 @@ func (f *FreeIPA) getAllRoles(ctx context.Context) (int, []Role, uint32, error)
 			return 0, nil, 0, errors.New("failed to parse role response")
 		}
 
-		roles = append(roles, mapUserToDTORole(v2))
+		role, err := decodeEntry(v2, roleCodec)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+
+		roles = append(roles, role)
 	}
 
 	return newStatusCode, roles, total, nil
@@ -691,7 +857,7 @@ func (f *FreeIPA) getAllRolesByName(ctx context.Context, names []string) (int, [
 	methods := make([]string, len(names))
 	u := url.URL{
 		Scheme: f.scheme,
-		Host:   f.host,
+		Host:   f.host(),
 		Path:   "ipa/session/json",
 	}
 	opts := map[string]any{
@@ -713,9 +879,9 @@ func (f *FreeIPA) getAllRolesByName(ctx context.Context, names []string) (int, [
 		return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (batch): %s", err)
 	}
 
-	statusCode, bodyBytes, err := f.httpRequest(ctx, f.client, http.MethodPost, u, req, f.headers())
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
 	if err != nil {
-		return 0, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %s", err)
+		return statusCode, nil, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
 	}
 
 	newStatusCode, resp, err := f.handleResponse(statusCode, bodyBytes)
@@ -728,8 +894,8 @@ func (f *FreeIPA) getAllRolesByName(ctx context.Context, names []string) (int, [
 
 	var errs []error
 	for _, result := range resp.Result.Results {
-		if result.Error != "" {
-			errs = append(errs, errors.New(result.Error))
+		if err = result.err(); err != nil {
+			errs = append(errs, err)
 		}
 	}
 	if len(errs) > 0 {
@@ -740,18 +906,167 @@ func (f *FreeIPA) getAllRolesByName(ctx context.Context, names []string) (int, [
 
 	for _, result := range resp.Result.Results {
 		if roleTmp, ok := result.Result.(map[string]any); ok {
-			roles = append(roles, mapUserToDTORole(roleTmp))
+			role, err := decodeEntry(roleTmp, roleCodec)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			roles = append(roles, role)
 		}
 	}
 
 	return newStatusCode, roles, nil
 }
 
+// sendRPC отправляет одиночный jsonRPC-запрос и разбирает ответ через handleResponse.
+// args должен быть уже сформированным json-массивом (см. rpcArgs).
+func (f *FreeIPA) sendRPC(ctx context.Context, method, args string, opts map[string]any) (int, responseBasic, error) {
+	u := url.URL{
+		Scheme: f.scheme,
+		Host:   f.host(),
+		Path:   "ipa/session/json",
+	}
+
+	req, err := f.rpcReq(method, args, opts, true)
+	if err != nil {
+		return 0, responseBasic{}, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (%s): %s", method, err)
+	}
+
+	statusCode, bodyBytes, err := f.httpRequest(ctx, http.MethodPost, u, req, f.headers())
+	if err != nil {
+		return statusCode, responseBasic{}, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
+	}
+
+	return f.handleResponse(statusCode, bodyBytes)
+}
+
+// sendEntryRPC команда, в ответе которой одна запись
+func (f *FreeIPA) sendEntryRPC(
+	ctx context.Context,
+	method, pkey string,
+	opts map[string]any,
+) (int, map[string]any, error) {
+	statusCode, resp, err := f.sendRPC(ctx, method, rpcArgs(pkey), opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	entry, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	return statusCode, entry, nil
+}
+
+// findEntries <objType>_find со всеми атрибутами, criteria - подстрока для поиска (может быть пустой).
+// Отдает все найденные записи: выборка, обрезанная сервером (truncated), - ошибка ErrSizeLimitExceeded.
+func (f *FreeIPA) findEntries(ctx context.Context, method, criteria string) (int, []map[string]any, error) {
+	args := ""
+	if criteria != "" {
+		args = rpcArgs(criteria)
+	}
+
+	opts := map[string]any{
+		"all":       true,
+		"sizelimit": 0, // без него IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, method, args, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+	if resp.Result.Truncated {
+		return 0, nil, newTruncatedError(method, resp.Result.Count)
+	}
+
+	entries := make([]map[string]any, 0)
+
+	if list, ok := resp.Result.Result.([]any); ok {
+		entries = make([]map[string]any, 0, len(list))
+		for _, item := range list {
+			if entry, ok := item.(map[string]any); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return statusCode, entries, nil
+}
+
+// showEntries <objType>_show для нескольких записей одним batch-ем. Отсутствующая запись - ошибка,
+// с isSkipMissing - пропускается (например, удалена между чтением ссылки на нее и самой записи).
+func (f *FreeIPA) showEntries(
+	ctx context.Context,
+	method string,
+	pkeys []string,
+	isSkipMissing bool,
+) (int, []map[string]any, error) {
+	if len(pkeys) == 0 {
+		return http.StatusOK, []map[string]any{}, nil
+	}
+
+	methods := make([]string, len(pkeys))
+	opts := map[string]any{
+		"all": true,
+	}
+
+	for i, pkey := range pkeys {
+		req, err := f.rpcReq(method, rpcArgs(pkey), opts, false)
+		if err != nil {
+			return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (%s): %s", method, err)
+		}
+
+		methods[i] = string(req)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	entries := make([]map[string]any, 0, len(resp.Result.Results))
+
+	for _, result := range resp.Result.Results {
+		if err = result.err(); err != nil {
+			if isSkipMissing && errors.Is(err, ErrNotFound) {
+				continue
+			}
+
+			return 0, nil, err
+		}
+		if entry, ok := result.Result.(map[string]any); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	return statusCode, entries, nil
+}
+
+// deleteEntry <objType>_del
+func (f *FreeIPA) deleteEntry(ctx context.Context, method, pkey string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, method, rpcArgs(pkey), nil)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
 func (f *FreeIPA) headers() map[string]string {
 	return map[string]string{
 		"Content-Type": "application/json",
 		"Accept":       "application/json",
-		"Referer":      fmt.Sprintf("%s://%s/ipa", f.scheme, f.host),
+		"Referer":      fmt.Sprintf("%s://%s/ipa", f.scheme, f.host()),
 	}
 }
 
@@ -787,15 +1102,66 @@ func (f *FreeIPA) rpcReq(method, argsSrc string, optsSrc map[string]any, isFull
 	return []byte(result), nil
 }
 
+// httpRequest при включенном перелогине (EnableRelogin) на 401 один раз заново аутентифицируется
+// и повторяет исходный запрос. Если перелогин не удался, то отдается исходный статус (401) и ошибка перелогина.
 func (f *FreeIPA) httpRequest(
 	ctx context.Context,
-	client *http.Client,
-	method string, //nolint:unparam
+	method string,
 	u url.URL,
 	body []byte,
 	headers map[string]string,
 ) (int, []byte, error) {
-	return funcs.HTTPRequest(ctx, client, method, u, body, headers)
+	session, statusCode, bodyBytes, err := f.rawHTTPRequest(ctx, method, u, body, headers)
+	if err != nil || statusCode != http.StatusUnauthorized {
+		return statusCode, bodyBytes, err
+	}
+
+	isRelogged, err := f.relogin(ctx, session)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if !isRelogged {
+		return statusCode, bodyBytes, nil
+	}
+
+	_, statusCode, bodyBytes, err = f.rawHTTPRequest(ctx, method, u, body, headers)
+
+	return statusCode, bodyBytes, err
+}
+
+// rawHTTPRequest JSON-RPC запрос без перелогина, с переключением на другую реплику (см. requestWithFailover)
+// и наблюдателями (см. SetObservers)
+func (f *FreeIPA) rawHTTPRequest(
+	ctx context.Context,
+	method string, //nolint:unparam
+	u url.URL,
+	body []byte,
+	headers map[string]string,
+) (sessionRef, int, []byte, error) {
+	start := time.Now()
+	session, statusCode, _, bodyBytes, err := f.requestWithFailover(ctx, method, u, body, headers)
+
+	f.observeRPC(ctx, body, statusCode, bodyBytes, time.Since(start), err)
+
+	return session, statusCode, bodyBytes, err
+}
+
+// formRequest запрос формой на ipa/session/* (вход, смена пароля), без перелогина
+func (f *FreeIPA) formRequest(
+	ctx context.Context,
+	path string,
+	values url.Values,
+) (sessionRef, int, http.Header, []byte, error) {
+	u := url.URL{
+		Scheme: f.scheme,
+		Host:   f.host(),
+		Path:   path,
+	}
+	headers := map[string]string{
+		"Referer": fmt.Sprintf("%s://%s/ipa", f.scheme, f.host()),
+	}
+
+	return f.requestWithFailover(ctx, http.MethodPost, u, []byte(values.Encode()), headers)
 }
 
 func (f *FreeIPA) handleResponse( //nolint:nonamedreturns
@@ -822,10 +1188,10 @@ func (f *FreeIPA) handleResponse( //nolint:nonamedreturns
 		if unmarshalErr := json.Unmarshal(bodyBytes, &resp); unmarshalErr == nil {
 			if resp.Error != nil {
 				err = fmt.Errorf(
-					"original http-statusCode %d, json-errorCode %d: %s",
+					"original http-statusCode %d, json-errorCode %d: %w",
 					statusCode,
 					resp.Error.Code,
-					resp.Error.Message,
+					newErrorFromResponse(resp.Error),
 				)
 
 				//nolint: mnd
@@ -866,15 +1232,16 @@ func (f *FreeIPA) handleResponse( //nolint:nonamedreturns
 }
 
 func NewFreeIPA(scheme, host string, transport *http.Transport, timeout time.Duration) *FreeIPA {
-	jar, _ := cookiejar.New(nil)
+	return NewFreeIPAReplicas(scheme, []string{host}, transport, timeout)
+}
+
+// NewFreeIPAReplicas клиент к нескольким репликам одной топологии: запросы идут на текущую,
+// при недоступности - на следующую (см. HealthCheck, DiscoverServers). Сессия у каждой реплики своя,
+// поэтому для переключения без ошибок нужен EnableRelogin.
+func NewFreeIPAReplicas(scheme string, hosts []string, transport *http.Transport, timeout time.Duration) *FreeIPA {
 	return &FreeIPA{
-		scheme: scheme,
-		host:   host,
-		client: &http.Client{
-			Transport: transport,
-			Timeout:   timeout,
-			Jar:       jar, // куки фиксируются автоматически
-		},
+		scheme:     scheme,
+		servers:    newServerPool(hosts, transport, timeout),
 		apiVersion: apiVersion,
 	}
 }
@@ -67,7 +67,7 @@ func TestFreeIPA(t *testing.T) { //nolint:tparallel
 		statusCode, userActual, err := cl.GetUser(t.Context(), userExpected.UID)
 		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, statusCode)
-		require.Equal(t, userExpected, userActual)
+		require.Equal(t, withoutAttrs(userExpected), withoutAttrs(userActual))
 
 		// получим дефолтный диапазон (20) пользователей
 		statusCode, users, total, err := cl.GetUsers(t.Context(), -1, -1) // limit=default, offset=0
@@ -311,6 +311,129 @@ func TestFreeIPA(t *testing.T) { //nolint:tparallel
 		require.NoError(t, err)
 		require.Equal(t, http.StatusOK, statusCode)
 	})
+	t.Run("check groups", func(t *testing.T) { //nolint:paralleltest
+		statusCode, err := cl.Login(t.Context(), adminLogin, adminPass)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		groupName := "test-" + funcs.RandStr()
+		nestedGroupName := "test-" + funcs.RandStr()
+		groupDesc := funcs.RandStr()
+
+		// создадим группы
+		statusCode, group, err := cl.CreateGroup(t.Context(), RequestGroup{
+			CN:          groupName,
+			Description: funcs.Pointer(groupDesc),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, groupName, group.CN)
+		require.Equal(t, groupDesc, group.Description)
+		require.Positive(t, group.GIDNumber)
+
+		statusCode, group, err = cl.CreateGroup(t.Context(), RequestGroup{
+			CN:       nestedGroupName,
+			NonPosix: funcs.Pointer(true),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Zero(t, group.GIDNumber)
+
+		// изменим описание
+		groupDesc2 := funcs.RandStr()
+		statusCode, err = cl.UpdateGroup(t.Context(), RequestGroup{
+			CN:          groupName,
+			Description: funcs.Pointer(groupDesc2),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// добавим админа и вложенную группу
+		statusCode, err = cl.AddGroupMembers(t.Context(), groupName, []string{adminLogin}, []string{nestedGroupName})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		// повторное добавление должно вернуть ошибку по участникам
+		statusCode, err = cl.AddGroupMembers(t.Context(), groupName, []string{adminLogin}, nil)
+		require.Error(t, err)
+		require.Equal(t, 0, statusCode)
+
+		statusCode, group, err = cl.GetGroup(t.Context(), groupName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, groupDesc2, group.Description)
+		require.Contains(t, group.MemberUser, adminLogin)
+		require.Contains(t, group.MemberGroup, nestedGroupName)
+
+		// группа видна у пользователя
+		statusCode, user, err := cl.GetUser(t.Context(), adminLogin)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Contains(t, user.MemberOfGroup, groupName)
+
+		// список групп
+		statusCode, groups, total, err := cl.GetGroups(t.Context(), -1, -1)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.GreaterOrEqual(t, int(total), 2)
+		require.LessOrEqual(t, len(groups), limitDefault)
+
+		// уберем участников
+		statusCode, err = cl.RemoveGroupMembers(t.Context(), groupName, []string{adminLogin}, []string{nestedGroupName})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, group, err = cl.GetGroup(t.Context(), groupName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Empty(t, group.MemberUser)
+		require.Empty(t, group.MemberGroup)
+
+		// удалим группы
+		statusCode, err = cl.DeleteGroup(t.Context(), nestedGroupName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		statusCode, err = cl.DeleteGroup(t.Context(), groupName)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.GetGroup(t.Context(), groupName)
+		require.Error(t, err)
+		require.Equal(t, http.StatusNotFound, statusCode)
+
+		statusCode, err = cl.Logout(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+	})
+	t.Run("check relogin", func(t *testing.T) { //nolint:paralleltest
+		statusCode, err := cl.Login(t.Context(), adminLogin, adminPass)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		cl.EnableRelogin(StaticCredentials(adminLogin, adminPass))
+		defer cl.DisableRelogin()
+
+		// закроем сессию, следующий запрос должен сам перелогиниться
+		statusCode, err = cl.Logout(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, user, err := cl.GetUser(t.Context(), adminLogin)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, adminLogin, user.UID)
+
+		// с неверным паролем перелогин не удастся, отдастся исходный 401
+		cl.EnableRelogin(StaticCredentials(adminLogin, funcs.RandStr()))
+
+		statusCode, err = cl.Logout(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, _, err = cl.GetUser(t.Context(), adminLogin)
+		require.Error(t, err)
+		require.Equal(t, http.StatusUnauthorized, statusCode)
+	})
 	t.Run("check pwd policy", func(t *testing.T) { //nolint:paralleltest
 		// считаем максимальный строк действия пароля из под гостя
 		statusCode, pwdMaxLife, err := cl.GetKrbMaxPWDLife(t.Context())
@@ -328,6 +451,13 @@ func TestFreeIPA(t *testing.T) { //nolint:tparallel
 		require.Equal(t, http.StatusOK, statusCode)
 		require.Positive(t, pwdMaxLife)
 
+		// вся глобальная политика
+		statusCode, policy, err := cl.GetPasswordPolicy(t.Context(), "")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+		require.Equal(t, GlobalPasswordPolicy, policy.Group)
+		require.Equal(t, pwdMaxLife, policy.MaxLife)
+
 		// создадим пользователя
 		newUserID := "test-" + funcs.RandStr()
 		reqUser := RequestUser{
@@ -0,0 +1,372 @@
+package freeipatest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errCodeCertOperation = 4301
+
+	defaultProfile   = "caIPAserviceCert"
+	certValidity     = 2 * 365 * 24 * time.Hour
+	serialNumberBits = 127
+	maxRevokeReason  = 10
+	reasonRemoveCRL  = 8 // removeFromCRL: только для снятия hold, при отзыве недопустим
+	reasonUnassigned = 7
+)
+
+// профили, которые есть в свежем IPA: сервисы/хосты и пользователи
+var certProfiles = []string{defaultProfile, "IECUserRoles"}
+
+// certAuthority встроенный CA: выпускает сертификаты по CSR и помнит их статус
+type certAuthority struct {
+	key    crypto.Signer
+	cert   *x509.Certificate
+	issued map[string]*issuedCert // serial (десятичный) -> сертификат
+}
+
+type issuedCert struct {
+	cert             *x509.Certificate
+	ownerType        string // user, host, service
+	owner            string
+	revocationReason *int
+}
+
+func newCertAuthority() *certAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate CA key: %s", err))
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Certificate Authority", Organization: []string{Realm}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * certValidity), //nolint:mnd // CA живет дольше выпущенных
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create CA certificate: %s", err))
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse CA certificate: %s", err))
+	}
+
+	return &certAuthority{key: key, cert: cert, issued: make(map[string]*issuedCert)}
+}
+
+// CACertificate сертификат встроенного CA, им подписаны все выпущенные cert_request сертификаты
+func (s *Server) CACertificate() *x509.Certificate {
+	return s.ca.cert
+}
+
+// cmdCertRequest выпускает сертификат principal-у: CN в CSR должен совпадать с пользователем/хостом
+func cmdCertRequest(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("request certificate", "certificate")
+	}
+
+	csr, rpcErr := parseCSR(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	principal := firstOpt(opts, "principal")
+	if principal == "" {
+		return nil, errRequired("principal")
+	}
+
+	profile := firstOpt(opts, "profile_id")
+	if profile == "" {
+		profile = defaultProfile
+	}
+	if !slices.Contains(certProfiles, profile) {
+		return nil, newError(errCodeNotFound, "NotFound", fmt.Sprintf("%s: Certificate Profile not found", profile))
+	}
+
+	e, rpcErr := s.dir.principalEntry(principal)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	// у пользователя CN - uid, у хоста и сервиса - имя хоста
+	expectedCN := e.pkey()
+	if e.typ.name != typeUser {
+		expectedCN = principalHost(principal)
+	}
+	if !strings.EqualFold(csr.Subject.CommonName, expectedCN) {
+		return nil, newError(errCodeValidation, "ValidationError", fmt.Sprintf(
+			"invalid 'csr': DN commonName does not match '%s'", expectedCN,
+		))
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, newError(errCodeCertOperation, "CertificateOperationError", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: csr.Subject.CommonName, Organization: []string{Realm}},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, s.ca.cert, csr.PublicKey, s.ca.key)
+	if err != nil {
+		return nil, newError(errCodeCertOperation, "CertificateOperationError", err.Error())
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	issued := &issuedCert{cert: cert, ownerType: e.typ.name, owner: e.pkey()}
+	s.ca.issued[serial.String()] = issued
+
+	// как и IPA, выпущенный сертификат добавляется в запись владельца
+	e.attrs[attrUserCert] = append(e.attrs[attrUserCert], string(der))
+	s.dir.touch(e)
+
+	result := s.ca.render(issued)
+	result["request_id"] = strconv.Itoa(len(s.ca.issued))
+	result["cacn"] = "ipa"
+
+	return map[string]any{"result": result, "value": "", "summary": nil}, nil
+}
+
+func cmdCertShow(s *Server, args []any) (map[string]any, *rpcError) {
+	issued, rpcErr := s.ca.find(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return map[string]any{
+		"result":  s.ca.render(issued),
+		"value":   issued.cert.SerialNumber.String(),
+		"summary": nil,
+	}, nil
+}
+
+func cmdCertRevoke(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("revoke", "certificate")
+	}
+
+	issued, rpcErr := s.ca.find(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	reason := 0
+	if v := firstOpt(opts, "revocation_reason"); v != "" {
+		reason, _ = strconv.Atoi(v)
+	}
+	if reason < 0 || reason > maxRevokeReason || reason == reasonUnassigned || reason == reasonRemoveCRL {
+		return nil, newError(errCodeValidation, "ValidationError", "invalid 'revocation_reason': invalid value")
+	}
+	if issued.revocationReason != nil {
+		return nil, newError(errCodeCertOperation, "CertificateOperationError",
+			"Certificate operation cannot be completed: certificate is already revoked")
+	}
+
+	issued.revocationReason = &reason
+
+	return map[string]any{"result": map[string]any{"revoked": true}, "value": "", "summary": nil}, nil
+}
+
+// cmdCertFind выпущенные CA сертификаты и сертификаты, добавленные в записи пользователей.
+// Фильтры: user/host/service (владельцы), subject (подстрока CN), revocation_reason, validnotafter_to.
+func cmdCertFind(s *Server, opts map[string]any) (map[string]any, *rpcError) {
+	var certs []*issuedCert
+
+	for _, issued := range s.ca.issued {
+		certs = append(certs, issued)
+	}
+
+	for _, e := range s.dir.list(typeUser) {
+		for _, der := range e.attrs[attrUserCert] {
+			if s.ca.byDER(der) != nil {
+				continue
+			}
+			if cert, err := x509.ParseCertificate([]byte(der)); err == nil {
+				certs = append(certs, &issuedCert{cert: cert, ownerType: typeUser, owner: e.pkey()})
+			}
+		}
+	}
+
+	certs = slices.DeleteFunc(certs, func(c *issuedCert) bool { return !matchCert(c, opts) })
+	slices.SortFunc(certs, func(a, b *issuedCert) int { return a.cert.SerialNumber.Cmp(b.cert.SerialNumber) })
+
+	found := make([]any, len(certs))
+	for i, c := range certs {
+		found[i] = s.ca.render(c)
+	}
+
+	found, isTruncated := limitFound(found, s.findSizeLimit(opts))
+
+	return map[string]any{
+		"result":    found,
+		"count":     len(found),
+		"truncated": isTruncated,
+		"summary":   fmt.Sprintf("%d certificates matched", len(found)),
+	}, nil
+}
+
+func matchCert(c *issuedCert, opts map[string]any) bool {
+	for _, ownerType := range []string{typeUser, typeHost, typeService} {
+		owners := toStrings(opts[ownerType])
+		if len(owners) > 0 && (c.ownerType != ownerType || !slices.ContainsFunc(owners, func(o string) bool {
+			return strings.EqualFold(o, c.owner)
+		})) {
+			return false
+		}
+	}
+
+	if subject := firstOpt(opts, "subject"); subject != "" &&
+		!strings.Contains(strings.ToLower(c.cert.Subject.CommonName), strings.ToLower(subject)) {
+		return false
+	}
+	if v := firstOpt(opts, "revocation_reason"); v != "" &&
+		(c.revocationReason == nil || strconv.Itoa(*c.revocationReason) != v) {
+		return false
+	}
+	if v := firstOpt(opts, "validnotafter_to"); v != "" {
+		if t, err := time.Parse(timeLayout, v); err == nil && c.cert.NotAfter.After(t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// find по серийнику: десятичному или hex с префиксом 0x
+func (ca *certAuthority) find(serial string) (*issuedCert, *rpcError) {
+	n, ok := new(big.Int), false
+
+	if hexSerial, isHex := strings.CutPrefix(strings.ToLower(serial), "0x"); isHex {
+		n, ok = n.SetString(hexSerial, 16) //nolint:mnd // hex
+	} else {
+		n, ok = n.SetString(serial, 10) //nolint:mnd // dec
+	}
+
+	if !ok {
+		return nil, newError(errCodeValidation, "ValidationError", "invalid 'serial_number': must be an integer")
+	}
+
+	issued := ca.issued[n.String()]
+	if issued == nil {
+		return nil, newError(errCodeNotFound, "NotFound", fmt.Sprintf("Certificate serial number 0x%X not found", n))
+	}
+
+	return issued, nil
+}
+
+func (ca *certAuthority) byDER(der string) *issuedCert {
+	for _, issued := range ca.issued {
+		if string(issued.cert.Raw) == der {
+			return issued
+		}
+	}
+
+	return nil
+}
+
+// render запись cert_show/cert_find
+func (ca *certAuthority) render(c *issuedCert) map[string]any {
+	result := map[string]any{
+		"serial_number":        json.Number(c.cert.SerialNumber.String()),
+		"serial_number_hex":    fmt.Sprintf("0x%X", c.cert.SerialNumber),
+		"subject":              c.cert.Subject.String(),
+		"issuer":               c.cert.Issuer.String(),
+		"valid_not_before":     c.cert.NotBefore.UTC().Format(certTimeLayout),
+		"valid_not_after":      c.cert.NotAfter.UTC().Format(certTimeLayout),
+		"certificate":          base64.StdEncoding.EncodeToString(c.cert.Raw),
+		"revoked":              c.revocationReason != nil,
+		"status":               "VALID",
+		"owner_" + c.ownerType: []any{c.owner},
+	}
+
+	if c.revocationReason != nil {
+		result["status"] = "REVOKED"
+		result["revocation_reason"] = *c.revocationReason
+	}
+
+	return result
+}
+
+// parseCSR PEM или голый base64 (DER), как принимает IPA
+func parseCSR(value string) (*x509.CertificateRequest, *rpcError) {
+	der := []byte(nil)
+
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		der = block.Bytes
+	} else if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		der = decoded
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		return nil, newError(errCodeCertOperation, "CertificateOperationError",
+			"Failure decoding Certificate Signing Request")
+	}
+
+	return csr, nil
+}
+
+// principalEntry запись владельца principal-а: uid[@REALM], host/fqdn[@REALM] или service/fqdn[@REALM]
+func (d *directory) principalEntry(principal string) (*entry, *rpcError) {
+	name, realm, _ := strings.Cut(principal, "@")
+	if realm == "" {
+		principal += "@" + Realm
+	}
+
+	service, host, isService := strings.Cut(name, "/")
+
+	switch {
+	case !isService:
+		if e := d.get(typeUser, name); e != nil {
+			return e, nil
+		}
+	case service == typeHost:
+		if e := d.get(typeHost, host); e != nil {
+			return e, nil
+		}
+	default:
+		if e := d.get(typeService, principal); e != nil {
+			return e, nil
+		}
+	}
+
+	return nil, newError(errCodeNotFound, "NotFound", fmt.Sprintf("%s: principal not found", principal))
+}
+
+func principalHost(principal string) string {
+	name, _, _ := strings.Cut(principal, "@")
+	_, host, _ := strings.Cut(name, "/")
+
+	return host
+}
@@ -0,0 +1,1199 @@
+package freeipatest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// коды ошибок IPA (ipalib/errors.py)
+const (
+	errCodeCommand           = 905
+	errCodeJSON              = 909
+	errCodeACI               = 2100
+	errCodeRequirement       = 3007
+	errCodeConversion        = 3008
+	errCodeValidation        = 3009
+	errCodePasswordMismatch  = 3011
+	errCodeNotFound          = 4001
+	errCodeAlreadyActive     = 4009
+	errCodeAlreadyInactive   = 4010
+	errCodeDuplicateEntry    = 4002
+	errCodeAttrValueNotFound = 4026
+	errCodeEmptyModlist      = 4202
+	errCodeDatabase          = 4203
+)
+
+// опции, которые не являются атрибутами записи
+var controlOpts = []string{
+	"version", "all", "raw", "no_members", "pkey_only", "sizelimit", "timelimit", "rights", "random",
+	"userpassword", "addattr", "setattr", "delattr", "nonposix", "external", "noprivate", "continue",
+	"preserve", "preserved", "force", "ip_address", "no_reverse", "updatedns", "no_qrcode",
+}
+
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     any               `json:"id"`
+}
+
+type rpcResponse struct {
+	Result    any       `json:"result"`
+	Error     *rpcError `json:"error"`
+	ID        any       `json:"id"`
+	Principal string    `json:"principal"`
+	Version   string    `json:"version"`
+}
+
+type rpcError struct {
+	Code    int            `json:"code"`
+	Name    string         `json:"name"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// execute разбирает params и выполняет команду, вызывающий держит s.mu
+func (s *Server) execute(caller, method string, params []json.RawMessage) (any, *rpcError) {
+	var (
+		args []any
+		opts map[string]any
+	)
+
+	if len(params) > 0 {
+		if err := json.Unmarshal(params[0], &args); err != nil {
+			return nil, &rpcError{Code: errCodeJSON, Name: "JSONError", Message: err.Error()}
+		}
+	}
+	if len(params) > 1 {
+		if err := json.Unmarshal(params[1], &opts); err != nil {
+			return nil, &rpcError{Code: errCodeJSON, Name: "JSONError", Message: err.Error()}
+		}
+	}
+
+	return s.run(caller, method, args, opts)
+}
+
+// run выполняет команду от имени caller, отдает объект result ответа
+func (s *Server) run(caller, method string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	s.calls[method]++
+
+	if opts == nil {
+		opts = map[string]any{}
+	}
+
+	switch method {
+	case "batch":
+		return cmdBatch(s, caller, args)
+	case "ping":
+		return cmdPing()
+	case "server_find":
+		return cmdServerFind(s)
+	case "schema":
+		return cmdSchema()
+	case "session_logout":
+		return cmdLogout(s, caller)
+	case "pwpolicy_show":
+		return cmdPWPolicyShow(s, caller, args, opts)
+	case "pwpolicy_add":
+		return cmdPWPolicyAdd(s, caller, args, opts)
+	case "pwpolicy_mod":
+		return cmdPWPolicyMod(s, caller, args, opts)
+	case "pwpolicy_del":
+		return cmdPWPolicyDel(s, caller, args)
+	case "passwd":
+		return cmdPasswd(s, caller, args, opts)
+	case "hbactest":
+		return cmdHBACTest(s, caller, opts)
+	case "user_add":
+		return cmdUserAdd(s, caller, args, opts)
+	case "user_mod":
+		return cmdUserMod(s, caller, args, opts)
+	case "user_del":
+		return cmdUserDel(s, caller, args, opts)
+	case "user_undel":
+		return cmdUserUndel(s, caller, args)
+	case "user_disable":
+		return cmdUserToggle(s, caller, args, true)
+	case "user_enable":
+		return cmdUserToggle(s, caller, args, false)
+	case "user_add_cert":
+		return cmdUserEditCert(s, caller, args, opts, false)
+	case "user_remove_cert":
+		return cmdUserEditCert(s, caller, args, opts, true)
+	case "cert_find":
+		return cmdCertFind(s, opts)
+	case "cert_request":
+		return cmdCertRequest(s, caller, args, opts)
+	case "cert_show":
+		return cmdCertShow(s, args)
+	case "cert_revoke":
+		return cmdCertRevoke(s, caller, args, opts)
+	case "stageuser_add":
+		return cmdStageUserAdd(s, caller, args, opts)
+	case "stageuser_activate":
+		return cmdStageUserActivate(s, caller, args)
+	case "host_add":
+		return cmdHostAdd(s, caller, args, opts)
+	case "host_mod":
+		return cmdHostMod(s, caller, args, opts)
+	case "host_disable":
+		return cmdHostDisable(s, caller, args)
+	case "otptoken_add":
+		return cmdOTPTokenAdd(s, caller, args, opts)
+	case "otptoken_mod":
+		return cmdOTPTokenOwned(s, caller, "mod", args, opts)
+	case "otptoken_del":
+		return cmdOTPTokenOwned(s, caller, "del", args, opts)
+	case "permission_add":
+		return cmdPermissionAdd(s, caller, args, opts)
+	case "permission_mod":
+		return cmdPermissionMod(s, caller, args, opts)
+	case "role_add_privilege", "role_remove_privilege":
+		isRemove := method == "role_remove_privilege"
+		return cmdEditMemberOf(s, caller, s.dir.types[typeRole], typePrivilege, args, opts, isRemove)
+	case "privilege_add_permission", "privilege_remove_permission":
+		isRemove := method == "privilege_remove_permission"
+		return cmdEditMemberOf(s, caller, s.dir.types[typePrivilege], typePermission, args, opts, isRemove)
+	}
+
+	if strings.HasPrefix(method, "dnszone_") || strings.HasPrefix(method, "dnsrecord_") {
+		return cmdDNS(s, caller, method, args, opts)
+	}
+
+	objType, op, ok := s.splitMethod(method)
+	if !ok {
+		return nil, newError(errCodeCommand, "CommandError", fmt.Sprintf("unknown command '%s'", method))
+	}
+
+	if result, rpcErr, ok := cmdRule(s, caller, objType, op, args, opts); ok {
+		return result, rpcErr
+	}
+
+	switch op {
+	case "find":
+		return cmdFind(s, objType, args, opts)
+	case "show":
+		return cmdShow(s, objType, args, opts)
+	case "add":
+		return cmdAdd(s, caller, objType, args, opts)
+	case "mod":
+		return cmdMod(s, caller, objType, args, opts)
+	case "del":
+		return cmdDel(s, caller, objType, args)
+	case "add_member":
+		return cmdEditMembers(s, caller, objType, args, opts, false)
+	case "remove_member":
+		return cmdEditMembers(s, caller, objType, args, opts, true)
+	default:
+		return nil, newError(errCodeCommand, "CommandError", fmt.Sprintf("unknown command '%s'", method))
+	}
+}
+
+// splitMethod user_add_member -> user, add_member
+func (s *Server) splitMethod(method string) (*objectType, string, bool) {
+	for name, typ := range s.dir.types {
+		if op, ok := strings.CutPrefix(method, name+"_"); ok {
+			return typ, op, true
+		}
+	}
+
+	return nil, "", false
+}
+
+func cmdBatch(s *Server, caller string, args []any) (map[string]any, *rpcError) {
+	results := make([]any, 0, len(args))
+
+	for _, arg := range args {
+		call, _ := arg.(map[string]any)
+		method, _ := call["method"].(string)
+		params, _ := call["params"].([]any)
+
+		var (
+			subArgs []any
+			subOpts map[string]any
+		)
+
+		if len(params) > 0 {
+			subArgs, _ = params[0].([]any)
+		}
+		if len(params) > 1 {
+			subOpts, _ = params[1].(map[string]any)
+		}
+
+		result, rpcErr := s.run(caller, method, subArgs, subOpts)
+		if rpcErr != nil {
+			results = append(results, map[string]any{
+				"error":      rpcErr.Message,
+				"error_code": rpcErr.Code,
+				"error_name": rpcErr.Name,
+				"error_kw":   rpcErr.Data,
+			})
+
+			continue
+		}
+
+		item := map[string]any{"error": nil}
+		for k, v := range result {
+			item[k] = v
+		}
+
+		results = append(results, item)
+	}
+
+	return map[string]any{
+		"count":   len(results),
+		"results": results,
+	}, nil
+}
+
+func cmdPing() (map[string]any, *rpcError) {
+	return map[string]any{
+		"summary": fmt.Sprintf("IPA server version %s. API version %s", ServerVersion, APIVersion),
+	}, nil
+}
+
+func cmdServerFind(s *Server) (map[string]any, *rpcError) {
+	hosts := s.servers
+	if len(hosts) == 0 {
+		hosts = []string{s.Host()}
+	}
+
+	servers := make([]any, len(hosts))
+
+	for i, host := range hosts {
+		servers[i] = map[string]any{
+			"cn": []any{host},
+			"dn": fmt.Sprintf("cn=%s,cn=masters,cn=ipa,cn=etc,%s", host, BaseDN),
+		}
+	}
+
+	return map[string]any{
+		"result":    servers,
+		"count":     len(servers),
+		"truncated": false,
+		"summary":   fmt.Sprintf("%d IPA servers matched", len(servers)),
+	}, nil
+}
+
+func cmdLogout(s *Server, caller string) (map[string]any, *rpcError) {
+	s.logoutUser(caller)
+	return map[string]any{"result": nil}, nil
+}
+
+// cmdPWPolicyShow без аргумента - глобальная политика, с user - действующая для пользователя.
+// Обычному пользователю настоящий IPA отвечает "password policy not found".
+func cmdPWPolicyShow(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	name := firstArg(args)
+	if name == "" {
+		name = globalPolicy
+	}
+
+	e := s.dir.get(typePWPolicy, name)
+	if uid := firstOpt(opts, "user"); uid != "" {
+		if s.dir.get(typeUser, uid) == nil {
+			return nil, errNotFound(typeUser, uid)
+		}
+
+		e = s.dir.policyFor(uid)
+	}
+
+	if e == nil || !s.dir.isAdmin(caller) {
+		return nil, newError(errCodeNotFound, "NotFound", "password policy not found")
+	}
+
+	return map[string]any{
+		"result": s.dir.render(e, renderOptsFrom(opts)),
+		"value":  e.pkey(),
+	}, nil
+}
+
+// cmdPWPolicyAdd политика вешается на существующую группу, приоритет обязателен
+func cmdPWPolicyAdd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	group := firstArg(args)
+	if group != "" && s.dir.get(typeGroup, group) == nil {
+		return nil, errNotFound(typeGroup, group)
+	}
+	if firstOpt(opts, "cospriority") == "" {
+		return nil, errRequired("cospriority")
+	}
+
+	return cmdAdd(s, caller, s.dir.types[typePWPolicy], args, opts)
+}
+
+// cmdPWPolicyMod без аргумента меняет глобальную политику
+func cmdPWPolicyMod(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if firstArg(args) == "" {
+		if _, ok := opts["cospriority"]; ok {
+			return nil, newError(errCodeValidation, "ValidationError",
+				"invalid 'priority': priority cannot be set on global policy")
+		}
+
+		args = []any{globalPolicy}
+	}
+
+	return cmdMod(s, caller, s.dir.types[typePWPolicy], args, opts)
+}
+
+func cmdPWPolicyDel(s *Server, caller string, args []any) (map[string]any, *rpcError) {
+	if len(args) > 0 && slices.ContainsFunc(toStrings(args[0]), func(v string) bool {
+		return strings.EqualFold(v, globalPolicy)
+	}) {
+		return nil, newError(errCodeValidation, "ValidationError",
+			"invalid 'group': cannot delete global password policy")
+	}
+
+	return cmdDel(s, caller, s.dir.types[typePWPolicy], args)
+}
+
+// cmdPasswd passwd principal password [current_password]: админ меняет пароль любому (пароль сразу просрочен),
+// пользователь себе - только с текущим паролем и по политике
+func cmdPasswd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	principal := firstArg(args)
+	if principal == "" {
+		return nil, errRequired("principal")
+	}
+
+	uid, _, _ := strings.Cut(principal, "@")
+
+	e := s.dir.get(typeUser, uid)
+	if e == nil {
+		return nil, errNotFound(typeUser, uid)
+	}
+
+	value := ""
+	if len(args) > 1 {
+		if v := toStrings(args[1]); len(v) > 0 {
+			value = v[0]
+		}
+	}
+	if value == "" {
+		return nil, errRequired("password")
+	}
+
+	expiration := time.Now()
+
+	if !s.dir.isAdmin(caller) || strings.EqualFold(caller, uid) {
+		if !strings.EqualFold(caller, uid) {
+			return nil, errACIAttr("userpassword", e)
+		}
+		if !s.dir.isPasswordValid(uid, firstOpt(opts, "current_password")) {
+			return nil, newError(errCodePasswordMismatch, "PasswordMismatch", "Passwords do not match")
+		}
+		if reason := s.dir.checkPolicy(uid, value); reason != "" {
+			return nil, newError(errCodeDatabase, "DatabaseError", "Constraint violation: "+reason)
+		}
+
+		expiration = s.dir.policyExpiration(uid)
+	}
+
+	s.dir.setPassword(uid, value, expiration)
+	s.dir.touch(e)
+
+	return map[string]any{
+		"result":  true,
+		"value":   e.pkey() + "@" + Realm,
+		"summary": fmt.Sprintf(`Changed password for "%s@%s"`, e.pkey(), Realm),
+	}, nil
+}
+
+func cmdUserAdd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("add", typeUser)
+	}
+
+	uid := firstArg(args)
+	if uid == "" {
+		return nil, errRequired("uid")
+	}
+
+	givenName, sn := firstOpt(opts, "givenname"), firstOpt(opts, "sn")
+	if givenName == "" {
+		return nil, errRequired("givenname")
+	}
+	if sn == "" {
+		return nil, errRequired("sn")
+	}
+
+	if rpcErr := checkSSHKeys(opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	attrs, rpcErr := attrsFromOpts(opts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	e, rpcErr := s.dir.addUser(uid, givenName, sn, attrs)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	updateSSHFingerprints(e)
+
+	result := map[string]any{}
+	randomPass := ""
+
+	// пароль, выставленный админом, сразу просрочен, если срок не указан явно
+	expiration := time.Now()
+	if v := firstOpt(opts, "krbpasswordexpiration"); v != "" {
+		if t, err := time.Parse(timeLayout, v); err == nil {
+			expiration = t
+		}
+	}
+
+	if v := firstOpt(opts, "userpassword"); v != "" {
+		s.dir.setPassword(uid, v, expiration)
+	} else if isTrue(opts["random"]) {
+		randomPass = randomPassword()
+		s.dir.setPassword(uid, randomPass, expiration)
+	}
+
+	result["result"] = s.dir.renderWithRandomPassword(e, renderOptsFrom(opts), randomPass)
+	result["value"] = uid
+	result["summary"] = fmt.Sprintf(`Added user "%s"`, uid)
+
+	return result, nil
+}
+
+func cmdUserMod(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	uid := firstArg(args)
+
+	e := s.dir.get(typeUser, uid)
+	if e == nil {
+		return nil, errNotFound(typeUser, uid)
+	}
+
+	isAdmin := s.dir.isAdmin(caller)
+	if !isAdmin {
+		if !strings.EqualFold(caller, uid) {
+			return nil, errACIAttr("sn", e)
+		}
+
+		for _, attr := range []string{"nsaccountlock", "krbpasswordexpiration"} {
+			if _, ok := opts[attr]; ok {
+				return nil, errACIAttr(attr, e)
+			}
+		}
+	}
+
+	if rpcErr := checkSSHKeys(opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := checkUserAuthTypes(opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	isChanged, rpcErr := applyMod(e, opts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	updateSSHFingerprints(e)
+
+	result := map[string]any{}
+	randomPass := ""
+
+	// смена пароля админом сбрасывает срок его действия
+	if v := firstOpt(opts, "userpassword"); v != "" {
+		s.dir.setPassword(uid, v, time.Now())
+		isChanged = true
+	} else if isTrue(opts["random"]) {
+		randomPass = randomPassword()
+		s.dir.setPassword(uid, randomPass, time.Now())
+		isChanged = true
+	}
+
+	if !isChanged {
+		return nil, errEmptyModlist()
+	}
+
+	s.dir.touch(e)
+
+	result["result"] = s.dir.renderWithRandomPassword(e, renderOptsFrom(opts), randomPass)
+	result["value"] = e.pkey()
+	result["summary"] = fmt.Sprintf(`Modified user "%s"`, e.pkey())
+
+	return result, nil
+}
+
+func cmdUserDel(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if !isTrue(opts["preserve"]) {
+		return cmdDel(s, caller, s.dir.types[typeUser], args)
+	}
+
+	uid := firstArg(args)
+
+	e := s.dir.get(typeUser, uid)
+	if e == nil || e.isPreserved() {
+		return nil, errNotFound(typeUser, uid)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("delete", typeUser)
+	}
+
+	// при сохранении членство снимается, аккаунт блокируется
+	s.dir.unlink(e)
+	e.attrs["preserved"] = []string{"TRUE"}
+	e.attrs["nsaccountlock"] = []string{"TRUE"}
+	s.dir.touch(e)
+	s.logoutUser(uid)
+
+	return map[string]any{
+		"result":  map[string]any{"failed": []any{}},
+		"value":   []any{e.pkey()},
+		"summary": fmt.Sprintf(`Deleted user "%s"`, e.pkey()),
+	}, nil
+}
+
+func cmdUserUndel(s *Server, caller string, args []any) (map[string]any, *rpcError) {
+	uid := firstArg(args)
+
+	e := s.dir.get(typeUser, uid)
+	if e == nil {
+		return nil, errNotFound(typeUser, uid)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("write", typeUser)
+	}
+	if !e.isPreserved() {
+		return nil, newError(errCodeValidation, "ValidationError", fmt.Sprintf("user '%s' is not preserved", uid))
+	}
+
+	delete(e.attrs, "preserved")
+	e.attrs["nsaccountlock"] = []string{"FALSE"}
+	s.dir.touch(e)
+
+	if g := s.dir.get(typeGroup, UsersGroup); g != nil {
+		g.attrs["member_user"] = append(g.attrs["member_user"], e.pkey())
+	}
+
+	return map[string]any{
+		"result":  true,
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(`Undeleted user account "%s"`, e.pkey()),
+	}, nil
+}
+
+func cmdUserToggle(s *Server, caller string, args []any, isDisable bool) (map[string]any, *rpcError) {
+	uid := firstArg(args)
+
+	e := s.dir.get(typeUser, uid)
+	if e == nil {
+		return nil, errNotFound(typeUser, uid)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("nsaccountlock", e)
+	}
+
+	isLocked := e.first("nsaccountlock") == "TRUE"
+	summary := `Disabled user account "%s"`
+
+	switch {
+	case isDisable && isLocked:
+		return nil, newError(errCodeAlreadyInactive, "AlreadyInactive", "This entry is already disabled")
+	case !isDisable && !isLocked:
+		return nil, newError(errCodeAlreadyActive, "AlreadyActive", "This entry is already enabled")
+	case isDisable:
+		e.attrs["nsaccountlock"] = []string{"TRUE"}
+		s.logoutUser(uid)
+	default:
+		e.attrs["nsaccountlock"] = []string{"FALSE"}
+		summary = `Enabled user account "%s"`
+	}
+
+	s.dir.touch(e)
+
+	return map[string]any{
+		"result":  true,
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(summary, e.pkey()),
+	}, nil
+}
+
+func cmdStageUserAdd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if firstOpt(opts, "givenname") == "" {
+		return nil, errRequired("givenname")
+	}
+	if firstOpt(opts, "sn") == "" {
+		return nil, errRequired("sn")
+	}
+
+	// пароль хранится в самой stage-записи до активации
+	stageOpts := maps.Clone(opts)
+	delete(stageOpts, "random")
+
+	if v := firstOpt(opts, "userpassword"); v != "" {
+		stageOpts["addattr"] = append(toAnySlice(toStrings(opts["addattr"])), "userpassword="+v)
+	}
+
+	return cmdAdd(s, caller, s.dir.types[typeStage], args, stageOpts)
+}
+
+func cmdStageUserActivate(s *Server, caller string, args []any) (map[string]any, *rpcError) {
+	uid := firstArg(args)
+
+	stage := s.dir.get(typeStage, uid)
+	if stage == nil {
+		return nil, errNotFound(typeStage, uid)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("add", typeUser)
+	}
+
+	attrs := maps.Clone(stage.attrs)
+	for _, attr := range []string{"uid", "objectclass", "createtimestamp", "modifytimestamp", "userpassword"} {
+		delete(attrs, attr)
+	}
+
+	e, rpcErr := s.dir.addUser(uid, stage.first("givenname"), stage.first("sn"), attrs)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if v := stage.first("userpassword"); v != "" {
+		expiration := time.Now()
+		if t, err := time.Parse(timeLayout, stage.first("krbpasswordexpiration")); err == nil {
+			expiration = t
+		}
+
+		s.dir.setPassword(uid, v, expiration)
+	}
+
+	s.dir.remove(stage)
+
+	return map[string]any{
+		"result":  s.dir.render(e, renderOpts{all: true}),
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(`Stage user %s activated`, e.pkey()),
+	}, nil
+}
+
+func cmdFind(s *Server, typ *objectType, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	criteria := strings.ToLower(firstArg(args))
+	memberFilters := map[string][]string{} // in_group, not_in_role, ...
+	attrOpts := map[string]any{}
+
+	for k, v := range opts {
+		if strings.HasPrefix(k, "in_") || strings.HasPrefix(k, "not_in_") {
+			memberFilters[k] = toStrings(v)
+		} else {
+			attrOpts[k] = v
+		}
+	}
+
+	filters, rpcErr := attrsFromOpts(attrOpts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	sizeLimit := s.findSizeLimit(opts)
+
+	var (
+		found       []any
+		isTruncated bool
+	)
+
+	// удаленные с сохранением ищутся только явно (preserved=true)
+	isPreserved := isTrue(opts["preserved"])
+
+	for _, e := range s.dir.list(typ.name) {
+		if e.isPreserved() != isPreserved {
+			continue
+		}
+		if !matchCriteria(e, criteria) || !matchFilters(e, filters) || !s.dir.matchMembership(e, memberFilters) {
+			continue
+		}
+		if sizeLimit > 0 && len(found) >= sizeLimit {
+			isTruncated = true
+			break
+		}
+
+		found = append(found, s.dir.render(e, renderOptsFrom(opts)))
+	}
+
+	if found == nil {
+		found = []any{}
+	}
+
+	return map[string]any{
+		"result":    found,
+		"count":     len(found),
+		"truncated": isTruncated,
+		"summary":   fmt.Sprintf("%d %ss matched", len(found), typ.name),
+	}, nil
+}
+
+// findSizeLimit лимит выборки *_find: как у IPA, без sizelimit действует ipasearchrecordslimit,
+// 0 - без лимита, но не больше жесткого лимита сервера (SetSizeLimit)
+func (s *Server) findSizeLimit(opts map[string]any) int {
+	sizeLimit := searchRecordsLimit
+	if v := firstOpt(opts, "sizelimit"); v != "" {
+		sizeLimit, _ = strconv.Atoi(v)
+	}
+	if s.sizeLimit > 0 && (sizeLimit <= 0 || sizeLimit > s.sizeLimit) {
+		sizeLimit = s.sizeLimit
+	}
+
+	return sizeLimit
+}
+
+// limitFound обрезает уже собранную выборку *_find по findSizeLimit
+func limitFound(found []any, sizeLimit int) ([]any, bool) {
+	if sizeLimit > 0 && len(found) > sizeLimit {
+		return found[:sizeLimit], true
+	}
+
+	return found, false
+}
+
+func cmdShow(s *Server, typ *objectType, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+
+	return map[string]any{
+		"result":  s.dir.render(e, renderOptsFrom(opts)),
+		"value":   e.pkey(),
+		"summary": nil,
+	}, nil
+}
+
+func cmdAdd(s *Server, caller string, typ *objectType, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("add", typ.name)
+	}
+
+	pkey := firstArg(args)
+	if pkey == "" {
+		return nil, errRequired(typ.pkey)
+	}
+	if s.dir.get(typ.name, pkey) != nil {
+		return nil, errDuplicate(typ.name, pkey)
+	}
+
+	attrs, rpcErr := attrsFromOpts(opts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	attrs[typ.pkey] = []string{pkey}
+	attrs["objectclass"] = slices.Clone(typ.objectClass)
+
+	if typ.name == typeGroup {
+		switch {
+		case isTrue(opts["external"]):
+			attrs["objectclass"] = append(attrs["objectclass"], "ipaexternalgroup")
+		case isTrue(opts["nonposix"]):
+		default:
+			attrs["objectclass"] = append(attrs["objectclass"], "posixgroup")
+			if len(attrs["gidnumber"]) == 0 {
+				attrs["gidnumber"] = []string{s.dir.newIDNumber()}
+			}
+		}
+	}
+
+	e := s.dir.put(typ.name, attrs)
+
+	return map[string]any{
+		"result":  s.dir.render(e, renderOptsFrom(opts)),
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(`Added %s "%s"`, typ.name, e.pkey()),
+	}, nil
+}
+
+func cmdMod(s *Server, caller string, typ *objectType, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("description", e)
+	}
+
+	isChanged, rpcErr := applyMod(e, opts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if !isChanged {
+		return nil, errEmptyModlist()
+	}
+
+	s.dir.touch(e)
+
+	return map[string]any{
+		"result":  s.dir.render(e, renderOptsFrom(opts)),
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(`Modified %s "%s"`, typ.name, e.pkey()),
+	}, nil
+}
+
+func cmdDel(s *Server, caller string, typ *objectType, args []any) (map[string]any, *rpcError) {
+	var pkeys []string
+
+	if len(args) > 0 {
+		pkeys = toStrings(args[0])
+	}
+
+	for _, pkey := range pkeys {
+		e := s.dir.get(typ.name, pkey)
+		if e == nil {
+			return nil, errNotFound(typ.name, pkey)
+		}
+		if !s.dir.isAdmin(caller) {
+			return nil, errACI("delete", typ.name)
+		}
+	}
+
+	for _, pkey := range pkeys {
+		s.dir.remove(s.dir.get(typ.name, pkey))
+	}
+
+	return map[string]any{
+		"result":  map[string]any{"failed": []any{}},
+		"value":   toAnySlice(pkeys),
+		"summary": fmt.Sprintf(`Deleted %s "%s"`, typ.name, strings.Join(pkeys, ",")),
+	}, nil
+}
+
+func cmdEditMembers(
+	s *Server,
+	caller string,
+	typ *objectType,
+	args []any,
+	opts map[string]any,
+	isRemove bool,
+) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("member", e)
+	}
+
+	failed := map[string]any{}
+	completed := 0
+
+	for _, memberType := range typ.memberTypes {
+		attr := "member_" + memberType
+		failedItems := []any{}
+
+		for _, name := range toStrings(opts[memberType]) {
+			isMember := slices.ContainsFunc(e.attrs[attr], func(v string) bool {
+				return strings.EqualFold(v, name)
+			})
+
+			switch {
+			case s.dir.get(memberType, name) == nil:
+				failedItems = append(failedItems, []any{name, "no such entry"})
+			case memberType == typ.name && strings.EqualFold(name, pkey):
+				failedItems = append(failedItems, []any{name, "A group may not be a member of itself"})
+			case !isRemove && isMember:
+				failedItems = append(failedItems, []any{name, "This entry is already a member"})
+			case isRemove && !isMember:
+				failedItems = append(failedItems, []any{name, "This entry is not a member"})
+			case isRemove:
+				e.attrs[attr] = slices.DeleteFunc(e.attrs[attr], func(v string) bool {
+					return strings.EqualFold(v, name)
+				})
+				completed++
+			default:
+				e.attrs[attr] = append(e.attrs[attr], s.dir.get(memberType, name).pkey())
+				completed++
+			}
+		}
+
+		failed[memberType] = failedItems
+	}
+
+	if completed > 0 {
+		s.dir.touch(e)
+	}
+
+	return map[string]any{
+		"result":    s.dir.render(e, renderOptsFrom(opts)),
+		"failed":    map[string]any{"member": failed},
+		"completed": completed,
+	}, nil
+}
+
+// applyMod применяет к записи атрибуты из опций, а также setattr/addattr/delattr
+func applyMod(e *entry, opts map[string]any) (bool, *rpcError) {
+	// addattr добавляет к текущим значениям, а не заменяет их
+	replaceOpts := maps.Clone(opts)
+	delete(replaceOpts, "addattr")
+
+	attrs, rpcErr := attrsFromOpts(replaceOpts)
+	if rpcErr != nil {
+		return false, rpcErr
+	}
+
+	added, rpcErr := attrsFromOpts(map[string]any{"addattr": opts["addattr"]})
+	if rpcErr != nil {
+		return false, rpcErr
+	}
+
+	isChanged := false
+
+	for attr, vals := range attrs {
+		if attr == e.typ.pkey {
+			continue
+		}
+
+		// пустое значение удаляет атрибут
+		if len(vals) == 0 || (len(vals) == 1 && vals[0] == "") {
+			if len(e.attrs[attr]) > 0 {
+				delete(e.attrs, attr)
+				isChanged = true
+			}
+
+			continue
+		}
+		if !slices.Equal(e.attrs[attr], vals) {
+			e.attrs[attr] = vals
+			isChanged = true
+		}
+	}
+
+	for attr, vals := range added {
+		for _, val := range vals {
+			if !slices.Contains(e.attrs[attr], val) {
+				e.attrs[attr] = append(e.attrs[attr], val)
+				isChanged = true
+			}
+		}
+	}
+
+	for _, item := range toStrings(opts["delattr"]) {
+		attr, val, _ := strings.Cut(item, "=")
+		attr = strings.ToLower(attr)
+
+		val, rpcErr = binaryAttrValue(attr, val)
+		if rpcErr != nil {
+			return false, rpcErr
+		}
+
+		if !slices.Contains(e.attrs[attr], val) {
+			return false, newError(
+				errCodeAttrValueNotFound, "AttrValueNotFound", fmt.Sprintf("%s does not contain '%s'", attr, val),
+			)
+		}
+
+		e.attrs[attr] = slices.DeleteFunc(e.attrs[attr], func(v string) bool { return v == val })
+		isChanged = true
+	}
+
+	return isChanged, nil
+}
+
+// attrsFromOpts атрибуты из опций: обычные опции, setattr (замена) и addattr (добавление)
+func attrsFromOpts(opts map[string]any) (map[string][]string, *rpcError) {
+	attrs := map[string][]string{}
+
+	for k, v := range opts {
+		if !slices.Contains(controlOpts, k) {
+			attrs[strings.ToLower(k)] = toStrings(v)
+		}
+	}
+
+	for _, key := range []string{"setattr", "addattr"} {
+		for _, item := range toStrings(opts[key]) {
+			attr, val, ok := strings.Cut(item, "=")
+			if !ok {
+				return nil, newError(errCodeValidation, "ValidationError", fmt.Sprintf(
+					"invalid '%s': Invalid format. Should be name=value", key,
+				))
+			}
+
+			attr = strings.ToLower(attr)
+
+			val, rpcErr := binaryAttrValue(attr, val)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+
+			attrs[attr] = append(attrs[attr], val)
+		}
+	}
+
+	return attrs, nil
+}
+
+// binaryAttrValue значения бинарных атрибутов в setattr/addattr/delattr приходят в base64, как у Bytes в IPA
+func binaryAttrValue(attr, val string) (string, *rpcError) {
+	if !slices.Contains(base64Attrs, attr) || val == "" {
+		return val, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return "", newError(errCodeConversion, "ConversionError", fmt.Sprintf("invalid '%s': must be binary data", attr))
+	}
+
+	return string(decoded), nil
+}
+
+func matchCriteria(e *entry, criteria string) bool {
+	if criteria == "" {
+		return true
+	}
+
+	for _, attr := range e.typ.searchAttrs {
+		for _, v := range e.attrs[attr] {
+			if strings.Contains(strings.ToLower(v), criteria) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchFilters(e *entry, filters map[string][]string) bool {
+	for attr, vals := range filters {
+		for _, val := range vals {
+			if !slices.ContainsFunc(e.attrs[attr], func(v string) bool { return strings.EqualFold(v, val) }) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func renderOptsFrom(opts map[string]any) renderOpts {
+	return renderOpts{
+		all:       isTrue(opts["all"]),
+		noMembers: isTrue(opts["no_members"]),
+		pkeyOnly:  isTrue(opts["pkey_only"]),
+	}
+}
+
+func firstArg(args []any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if v := toStrings(args[0]); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func firstOpt(opts map[string]any, key string) string {
+	if v := toStrings(opts[key]); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// toStrings значение json-опции в LDAP-строки
+func toStrings(v any) []string {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{val}
+	case bool:
+		if val {
+			return []string{"TRUE"}
+		}
+
+		return []string{"FALSE"}
+	case float64:
+		return []string{strconv.FormatFloat(val, 'f', -1, 64)}
+	case []any:
+		result := make([]string, 0, len(val))
+		for _, item := range val {
+			result = append(result, toStrings(item)...)
+		}
+
+		return result
+	case map[string]any:
+		if dt, ok := val["__datetime__"].(string); ok {
+			return []string{dt}
+		}
+		if b64, ok := val["__base64__"].(string); ok {
+			return []string{b64}
+		}
+
+		return []string{fmt.Sprint(val)}
+	default:
+		return []string{fmt.Sprint(val)}
+	}
+}
+
+func isTrue(v any) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+func randomPassword() string {
+	const (
+		letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		length  = 16
+	)
+
+	b := make([]byte, length)
+	for i := range b {
+		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		b[i] = letters[n.Int64()]
+	}
+
+	return string(b)
+}
+
+func newError(code int, name, message string) *rpcError {
+	return &rpcError{
+		Code:    code,
+		Name:    name,
+		Message: message,
+		Data:    map[string]any{"reason": message},
+	}
+}
+
+func errNotFound(objType, pkey string) *rpcError {
+	return newError(errCodeNotFound, "NotFound", fmt.Sprintf("%s: %s not found", pkey, objType))
+}
+
+func errDuplicate(objType, pkey string) *rpcError {
+	message := fmt.Sprintf(`%s with name "%s" already exists`, objType, pkey)
+	return newError(errCodeDuplicateEntry, "DuplicateEntry", message)
+}
+
+func errRequired(name string) *rpcError {
+	return newError(errCodeRequirement, "RequirementError", fmt.Sprintf("'%s' is required", name))
+}
+
+func errEmptyModlist() *rpcError {
+	return newError(errCodeEmptyModlist, "EmptyModlist", "no modifications to be performed")
+}
+
+func errACI(op, objType string) *rpcError {
+	info := fmt.Sprintf("Insufficient '%s' privilege to %s an entry of type '%s'.", op, op, objType)
+	return newError(errCodeACI, "ACIError", "Insufficient access: "+info)
+}
+
+func errACIAttr(attr string, e *entry) *rpcError {
+	info := fmt.Sprintf("Insufficient 'write' privilege to the '%s' attribute of entry '%s'.", attr, e.dn())
+	return newError(errCodeACI, "ACIError", "Insufficient access: "+info)
+}
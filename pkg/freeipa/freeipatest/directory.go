@@ -0,0 +1,710 @@
+package freeipatest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	typeUser     = "user"
+	typeGroup    = "group"
+	typeRole     = "role"
+	typePWPolicy = "pwpolicy"
+	typeStage    = "stageuser"
+
+	typeHost         = "host"
+	typeHostGroup    = "hostgroup"
+	typeHBACRule     = "hbacrule"
+	typeHBACSvc      = "hbacsvc"
+	typeHBACSvcGroup = "hbacsvcgroup"
+	typeSudoRule     = "sudorule"
+	typeSudoCmd      = "sudocmd"
+	typeSudoCmdGroup = "sudocmdgroup"
+	typeService      = "service"
+	typePrivilege    = "privilege"
+	typePermission   = "permission"
+
+	globalPolicy      = "global_policy"
+	defaultMaxPwdLife = 90 // в днях
+	firstIDNumber     = 371000000
+)
+
+// objectType описание типа записей каталога
+type objectType struct {
+	name        string                // user, group, role
+	pkey        string                // атрибут первичного ключа
+	container   string                // rdn контейнера
+	objectClass []string              // objectclass новых записей
+	memberTypes []string              // типы, которые могут быть участниками (member_<type>)
+	searchAttrs []string              // атрибуты для поиска по criteria в *_find
+	ruleMembers map[string]ruleMember // участники правил hbac/sudo: суффикс команды (add_user) -> описание
+}
+
+// ruleMember участники правила hbac/sudo, которые меняются командами *_add_<suffix>/*_remove_<suffix>
+type ruleMember struct {
+	attr     string   // memberuser: значения хранятся в memberuser_user, memberuser_group
+	category string   // usercategory: при значении all участников добавлять нельзя
+	types    []string // user, group (они же имена опций)
+	label    string   // users, для текста ошибок
+}
+
+// entry запись каталога: атрибуты в нижнем регистре, значения как в LDAP (строки)
+type entry struct {
+	typ   *objectType
+	attrs map[string][]string
+}
+
+func (e *entry) pkey() string {
+	return e.first(e.typ.pkey)
+}
+
+func (e *entry) first(attr string) string {
+	if v := e.attrs[attr]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+func (e *entry) dn() string {
+	container := e.typ.container
+	if e.isPreserved() {
+		container = "cn=deleted users,cn=accounts,cn=provisioning"
+	}
+
+	return fmt.Sprintf("%s=%s,%s,%s", e.typ.pkey, e.pkey(), container, BaseDN)
+}
+
+func (e *entry) isPreserved() bool {
+	return e.first("preserved") == "TRUE"
+}
+
+type password struct {
+	value      string
+	expiration time.Time
+}
+
+type directory struct {
+	types     map[string]*objectType
+	entries   map[string]map[string]*entry // type -> lower(pkey) -> entry
+	passwords map[string]password          // uid -> пароль
+	nextID    int                          // uidnumber/gidnumber
+}
+
+// renderOpts как отдавать запись
+type renderOpts struct {
+	all       bool
+	noMembers bool
+	pkeyOnly  bool
+}
+
+// атрибуты, которые IPA кодирует особым образом
+var (
+	datetimeAttrs = []string{"krbpasswordexpiration", "krblastpwdchange", "createtimestamp", "modifytimestamp"}
+	base64Attrs   = []string{"jpegphoto", "usercertificate"}
+	boolAttrs     = []string{
+		"nsaccountlock", "preserved", "ipaenabledflag", "has_keytab", "has_password", "ipatokendisabled",
+	}
+	secretAttrs = []string{"userpassword", "ipatokenotpkey"}     // не отдаются никогда
+	hiddenAttrs = []string{"createtimestamp", "modifytimestamp"} // отдаются только при all=true
+)
+
+func (d *directory) get(objType, pkey string) *entry {
+	return d.entries[objType][strings.ToLower(pkey)]
+}
+
+func (d *directory) list(objType string) []*entry {
+	result := slices.Collect(maps.Values(d.entries[objType]))
+
+	slices.SortFunc(result, func(a, b *entry) int {
+		return strings.Compare(strings.ToLower(a.pkey()), strings.ToLower(b.pkey()))
+	})
+
+	return result
+}
+
+func (d *directory) put(objType string, attrs map[string][]string) *entry {
+	now := time.Now().UTC().Format(timeLayout)
+	attrs["createtimestamp"] = []string{now}
+	attrs["modifytimestamp"] = []string{now}
+
+	e := &entry{typ: d.types[objType], attrs: attrs}
+	d.entries[objType][strings.ToLower(e.pkey())] = e
+
+	return e
+}
+
+func (d *directory) touch(e *entry) {
+	e.attrs["modifytimestamp"] = []string{time.Now().UTC().Format(timeLayout)}
+}
+
+// remove удаляет запись и ссылки на нее из участников
+func (d *directory) remove(e *entry) {
+	delete(d.entries[e.typ.name], strings.ToLower(e.pkey()))
+	d.unlink(e)
+
+	if e.typ.name == typeUser {
+		delete(d.passwords, strings.ToLower(e.pkey()))
+	}
+}
+
+// unlink убирает запись из участников всех контейнеров
+// unlink убирает запись из участников всех остальных (member_<type>, memberuser_<type>, ipasudorunas_<type>, ...)
+func (d *directory) unlink(e *entry) {
+	suffix := "_" + e.typ.name
+	for _, entries := range d.entries {
+		for _, other := range entries {
+			for attr, vals := range other.attrs {
+				if !strings.HasSuffix(attr, suffix) ||
+					!(strings.HasPrefix(attr, "member") || strings.HasPrefix(attr, "ipasudorunas")) {
+					continue
+				}
+
+				other.attrs[attr] = slices.DeleteFunc(vals, func(v string) bool {
+					return strings.EqualFold(v, e.pkey())
+				})
+			}
+		}
+	}
+}
+
+func (d *directory) newIDNumber() string {
+	d.nextID++
+	return strconv.Itoa(d.nextID)
+}
+
+func (d *directory) addUser(uid, givenName, sn string, attrs map[string][]string) (*entry, *rpcError) {
+	if d.get(typeUser, uid) != nil {
+		return nil, errDuplicate(typeUser, uid)
+	}
+
+	cn := givenName + " " + sn
+	id := d.newIDNumber()
+	userAttrs := map[string][]string{
+		"uid":              {uid},
+		"givenname":        {givenName},
+		"sn":               {sn},
+		"cn":               {cn},
+		"displayname":      {cn},
+		"gecos":            {cn},
+		"initials":         {initials(givenName, sn)},
+		"homedirectory":    {"/home/" + uid},
+		"loginshell":       {"/bin/sh"},
+		"uidnumber":        {id},
+		"gidnumber":        {id},
+		"krbprincipalname": {uid + "@" + Realm},
+		"krbcanonicalname": {uid + "@" + Realm},
+		"mail":             {uid + "@" + Domain},
+		"ipauniqueid":      {uuid.NewString()},
+		"nsaccountlock":    {"FALSE"},
+		"objectclass":      slices.Clone(d.types[typeUser].objectClass),
+	}
+
+	maps.Copy(userAttrs, attrs)
+
+	e := d.put(typeUser, userAttrs)
+
+	if g := d.get(typeGroup, UsersGroup); g != nil {
+		g.attrs["member_user"] = append(g.attrs["member_user"], uid)
+	}
+
+	return e, nil
+}
+
+func (d *directory) setPassword(uid, value string, expiration time.Time) {
+	d.passwords[strings.ToLower(uid)] = password{value: value, expiration: expiration}
+
+	if e := d.get(typeUser, uid); e != nil {
+		e.attrs["krbpasswordexpiration"] = []string{expiration.UTC().Format(timeLayout)}
+		e.attrs["krblastpwdchange"] = []string{time.Now().UTC().Format(timeLayout)}
+	}
+}
+
+// checkPassword пустая строка - успех, иначе причина отказа (X-IPA-Rejection-Reason)
+func (d *directory) checkPassword(uid, value string) string {
+	e := d.get(typeUser, uid)
+	p, ok := d.passwords[strings.ToLower(uid)]
+
+	switch {
+	case e == nil || !ok || p.value != value || e.isPreserved():
+		return "invalid-password"
+	case e.first("nsaccountlock") == "TRUE":
+		return "denied"
+	case !p.expiration.After(time.Now()):
+		return "password-expired"
+	default:
+		return ""
+	}
+}
+
+// isPasswordValid совпадает ли пароль, срок действия и блокировка не учитываются
+func (d *directory) isPasswordValid(uid, value string) bool {
+	p, ok := d.passwords[strings.ToLower(uid)]
+	return ok && p.value == value
+}
+
+// policyFor действующая политика пользователя: групповая с наименьшим cospriority, иначе глобальная
+func (d *directory) policyFor(uid string) *entry {
+	var result *entry
+
+	resultPriority := 0
+
+	for _, g := range d.groupsOf(typeUser, uid, true) {
+		policy := d.get(typePWPolicy, g)
+		if policy == nil {
+			continue
+		}
+
+		priority, _ := strconv.Atoi(policy.first("cospriority"))
+		if result == nil || priority < resultPriority {
+			result, resultPriority = policy, priority
+		}
+	}
+
+	if result == nil {
+		result = d.get(typePWPolicy, globalPolicy)
+	}
+
+	return result
+}
+
+// checkPolicy пустая строка - пароль подходит под политику пользователя, иначе причина
+func (d *directory) checkPolicy(uid, value string) string {
+	policy := d.policyFor(uid)
+	if policy == nil {
+		return ""
+	}
+
+	if minLength, _ := strconv.Atoi(policy.first("krbpwdminlength")); len([]rune(value)) < minLength {
+		return "Password is too short"
+	}
+
+	return ""
+}
+
+// policyExpiration срок действия пароля, который пользователь сменил сам
+func (d *directory) policyExpiration(uid string) time.Time {
+	maxLife := defaultMaxPwdLife
+
+	if policy := d.policyFor(uid); policy != nil {
+		if v, err := strconv.Atoi(policy.first("krbmaxpwdlife")); err == nil {
+			maxLife = v
+		}
+	}
+
+	return time.Now().AddDate(0, 0, maxLife)
+}
+
+func (d *directory) isAdmin(uid string) bool {
+	return slices.ContainsFunc(d.groupsOf(typeUser, uid, true), func(g string) bool {
+		return strings.EqualFold(g, AdminsGroup)
+	})
+}
+
+// containersOf записи типа containerType, у которых в member_<memberType> есть pkey
+func (d *directory) containersOf(containerType, memberType, pkey string) []string {
+	var result []string
+
+	for _, e := range d.list(containerType) {
+		if slices.ContainsFunc(e.attrs["member_"+memberType], func(v string) bool {
+			return strings.EqualFold(v, pkey)
+		}) {
+			result = append(result, e.pkey())
+		}
+	}
+
+	return result
+}
+
+// groupsOf группы, в которые входит запись; с isIndirect - с учетом вложенности
+func (d *directory) groupsOf(memberType, pkey string, isIndirect bool) []string {
+	if !isIndirect {
+		return d.containersOf(typeGroup, memberType, pkey)
+	}
+
+	return d.containersOfIndirect(typeGroup, memberType, pkey)
+}
+
+// containersOfIndirect записи типа containerType, куда pkey входит напрямую или через вложенные containerType
+func (d *directory) containersOfIndirect(containerType, memberType, pkey string) []string {
+	seen := map[string]bool{}
+	queue := d.containersOf(containerType, memberType, pkey)
+
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+
+		if seen[strings.ToLower(g)] {
+			continue
+		}
+
+		seen[strings.ToLower(g)] = true
+		queue = append(queue, d.containersOf(containerType, containerType, g)...)
+	}
+
+	result := make([]string, 0, len(seen))
+	for _, e := range d.list(containerType) {
+		if seen[strings.ToLower(e.pkey())] {
+			result = append(result, e.pkey())
+		}
+	}
+
+	return result
+}
+
+// memberOf все контейнеры типа containerType, куда входит запись, с учетом вложенных групп
+func (d *directory) memberOf(e *entry, containerType string) []string {
+	groups := d.groupsOf(e.typ.name, e.pkey(), true)
+	if containerType == typeGroup {
+		return groups
+	}
+
+	result := d.containersOf(containerType, e.typ.name, e.pkey())
+	for _, g := range groups {
+		result = append(result, d.containersOf(containerType, typeGroup, g)...)
+	}
+
+	return uniqueSorted(result)
+}
+
+// matchMembership фильтры in_<type> (входит во все) и not_in_<type> (не входит ни в один)
+func (d *directory) matchMembership(e *entry, filters map[string][]string) bool {
+	for key, names := range filters {
+		containerType, isNot := strings.CutPrefix(key, "not_in_")
+		if !isNot {
+			containerType = strings.TrimPrefix(key, "in_")
+		}
+
+		memberOf := d.memberOf(e, containerType)
+
+		for _, name := range names {
+			isMember := slices.ContainsFunc(memberOf, func(v string) bool { return strings.EqualFold(v, name) })
+			if isMember == isNot {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// indirectUsers пользователи вложенных групп (без прямых участников)
+func (d *directory) indirectUsers(group *entry) []string {
+	seen := map[string]bool{strings.ToLower(group.pkey()): true}
+	queue := slices.Clone(group.attrs["member_group"])
+	direct := group.attrs["member_user"]
+
+	var result []string
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+
+		seen[strings.ToLower(name)] = true
+
+		nested := d.get(typeGroup, name)
+		if nested == nil {
+			continue
+		}
+
+		for _, uid := range nested.attrs["member_user"] {
+			if !slices.Contains(direct, uid) && !slices.Contains(result, uid) {
+				result = append(result, uid)
+			}
+		}
+
+		queue = append(queue, nested.attrs["member_group"]...)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
+// render отдает запись в формате json-ответа IPA
+func (d *directory) render(e *entry, opts renderOpts) map[string]any {
+	result := map[string]any{
+		"dn": e.dn(),
+	}
+
+	if opts.pkeyOnly {
+		result[e.typ.pkey] = []any{e.pkey()}
+		return result
+	}
+
+	for attr, vals := range e.attrs {
+		if len(vals) == 0 || slices.Contains(secretAttrs, attr) || (!opts.all && slices.Contains(hiddenAttrs, attr)) {
+			continue
+		}
+		if opts.noMembers && strings.HasPrefix(attr, "member") {
+			continue
+		}
+
+		result[attr] = renderValues(attr, vals)
+	}
+
+	if !opts.noMembers {
+		d.renderMemberOf(e, result)
+	}
+
+	if e.typ.name == typeUser {
+		_, hasPassword := d.passwords[strings.ToLower(e.pkey())]
+		result["has_password"] = hasPassword
+		result["has_keytab"] = hasPassword
+		if _, ok := result["preserved"]; !ok {
+			result["preserved"] = false
+		}
+	}
+
+	return result
+}
+
+// renderWithRandomPassword как render, IPA кладет сгенерированный пароль (random=true) прямо в запись
+func (d *directory) renderWithRandomPassword(e *entry, opts renderOpts, randomPass string) map[string]any {
+	result := d.render(e, opts)
+	if randomPass != "" {
+		result["randompassword"] = randomPass
+	}
+
+	return result
+}
+
+func (d *directory) renderMemberOf(e *entry, result map[string]any) {
+	setList := func(key string, vals []string) {
+		if len(vals) > 0 {
+			result[key] = toAnySlice(vals)
+		}
+	}
+
+	switch e.typ.name {
+	case typeUser, typeGroup:
+		direct := d.groupsOf(e.typ.name, e.pkey(), false)
+		all := d.groupsOf(e.typ.name, e.pkey(), true)
+		setList("memberof_group", direct)
+		setList("memberofindirect_group", without(all, direct))
+
+		directRoles := d.containersOf(typeRole, e.typ.name, e.pkey())
+		var indirectRoles []string
+
+		for _, g := range all {
+			indirectRoles = append(indirectRoles, d.containersOf(typeRole, typeGroup, g)...)
+		}
+
+		setList("memberof_role", directRoles)
+		setList("memberofindirect_role", without(uniqueSorted(indirectRoles), directRoles))
+
+		if e.typ.name == typeGroup {
+			setList("memberindirect_user", d.indirectUsers(e))
+		}
+	case typeRole:
+		var indirect []string
+
+		for _, g := range e.attrs["member_group"] {
+			if group := d.get(typeGroup, g); group != nil {
+				indirect = append(indirect, group.attrs["member_user"]...)
+				indirect = append(indirect, d.indirectUsers(group)...)
+			}
+		}
+
+		setList("memberindirect_user", without(uniqueSorted(indirect), e.attrs["member_user"]))
+		setList("memberof_privilege", d.containersOf(typePrivilege, typeRole, e.pkey()))
+	case typePermission:
+		var roles []string
+
+		for _, privilege := range e.attrs["member_privilege"] {
+			if p := d.get(typePrivilege, privilege); p != nil {
+				roles = append(roles, p.attrs["member_role"]...)
+			}
+		}
+
+		setList("memberindirect_role", uniqueSorted(roles))
+	default:
+		// host, hostgroup, hbacsvc, sudocmd, privilege, ...
+		for _, containerType := range slices.Sorted(maps.Keys(d.types)) {
+			if slices.Contains(d.types[containerType].memberTypes, e.typ.name) {
+				setList("memberof_"+containerType, d.containersOf(containerType, e.typ.name, e.pkey()))
+			}
+		}
+	}
+}
+
+func renderValues(attr string, vals []string) any {
+	switch {
+	case slices.Contains(boolAttrs, attr):
+		return strings.EqualFold(vals[0], "TRUE")
+	case slices.Contains(datetimeAttrs, attr):
+		result := make([]any, len(vals))
+		for i, v := range vals {
+			result[i] = map[string]any{"__datetime__": v}
+		}
+
+		return result
+	case slices.Contains(base64Attrs, attr):
+		result := make([]any, len(vals))
+		for i, v := range vals {
+			result[i] = map[string]any{"__base64__": base64.StdEncoding.EncodeToString([]byte(v))}
+		}
+
+		return result
+	default:
+		return toAnySlice(vals)
+	}
+}
+
+func (d *directory) seed(adminPassword string) {
+	d.put(typeGroup, map[string][]string{
+		"cn":          {AdminsGroup},
+		"description": {"Account administrators group"},
+		"gidnumber":   {strconv.Itoa(firstIDNumber)},
+		"objectclass": {"top", "groupofnames", "nestedgroup", "ipausergroup", "ipaobject", "posixgroup"},
+	})
+	d.put(typeGroup, map[string][]string{
+		"cn":          {UsersGroup},
+		"description": {"Default group for all users"},
+		"objectclass": {"top", "groupofnames", "nestedgroup", "ipausergroup", "ipaobject"},
+	})
+	d.put(typePWPolicy, map[string][]string{
+		"cn":                         {globalPolicy},
+		"krbmaxpwdlife":              {strconv.Itoa(defaultMaxPwdLife)},
+		"krbminpwdlife":              {"1"},
+		"krbpwdmindiffchars":         {"0"},
+		"krbpwdminlength":            {"8"},
+		"krbpwdhistorylength":        {"0"},
+		"krbpwdmaxfailure":           {"6"},
+		"krbpwdfailurecountinterval": {"60"},
+		"krbpwdlockoutduration":      {"600"},
+		"objectclass":                {"top", "nsContainer", "krbPwdPolicy"},
+	})
+
+	d.seedRules()
+
+	d.nextID = firstIDNumber
+
+	_, _ = d.addUser(AdminUID, "", "Administrator", map[string][]string{
+		"cn":          {"Administrator"},
+		"displayname": {"Administrator"},
+		"gecos":       {"Administrator"},
+		"givenname":   nil,
+		"initials":    nil,
+		"mail":        nil,
+		"loginshell":  {"/bin/bash"},
+		"uidnumber":   {strconv.Itoa(firstIDNumber)},
+		"gidnumber":   {strconv.Itoa(firstIDNumber)},
+	})
+
+	// администратор, как и в настоящем IPA, не входит в ipausers
+	d.get(typeGroup, AdminsGroup).attrs["member_user"] = []string{AdminUID}
+	d.get(typeGroup, UsersGroup).attrs["member_user"] = nil
+	d.setPassword(AdminUID, adminPassword, time.Now().AddDate(0, 0, defaultMaxPwdLife))
+}
+
+func initials(givenName, sn string) string {
+	result := ""
+
+	for _, s := range []string{givenName, sn} {
+		if s != "" {
+			result += strings.ToUpper(s[:1])
+		}
+	}
+
+	return result
+}
+
+func toAnySlice(vals []string) []any {
+	result := make([]any, len(vals))
+	for i, v := range vals {
+		result[i] = v
+	}
+
+	return result
+}
+
+func without(vals, exclude []string) []string {
+	var result []string
+
+	for _, v := range vals {
+		if !slices.ContainsFunc(exclude, func(e string) bool { return strings.EqualFold(e, v) }) {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func uniqueSorted(vals []string) []string {
+	result := slices.Clone(vals)
+	slices.Sort(result)
+
+	return slices.Compact(result)
+}
+
+func newDirectory() *directory {
+	types := map[string]*objectType{
+		typeUser: {
+			name:      typeUser,
+			pkey:      "uid",
+			container: "cn=users,cn=accounts",
+			objectClass: []string{
+				"top", "person", "organizationalperson", "inetorgperson", "inetuser", "posixaccount",
+				"krbprincipalaux", "krbticketpolicyaux", "ipaobject", "ipasshuser", "ipaSshGroupOfPubKeys",
+			},
+			searchAttrs: []string{"uid", "givenname", "sn", "cn", "mail", "displayname"},
+		},
+		typeGroup: {
+			name:        typeGroup,
+			pkey:        "cn",
+			container:   "cn=groups,cn=accounts",
+			objectClass: []string{"top", "groupofnames", "nestedgroup", "ipausergroup", "ipaobject"},
+			memberTypes: []string{typeUser, typeGroup},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typeRole: {
+			name:        typeRole,
+			pkey:        "cn",
+			container:   "cn=roles,cn=accounts",
+			objectClass: []string{"groupofnames", "nestedgroup", "top"},
+			memberTypes: []string{typeUser, typeGroup, typeHost, typeHostGroup, typeService},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typeStage: {
+			name:        typeStage,
+			pkey:        "uid",
+			container:   "cn=staged users,cn=accounts,cn=provisioning",
+			objectClass: []string{"top", "person", "organizationalperson", "inetorgperson", "inetuser", "posixaccount"},
+			searchAttrs: []string{"uid", "givenname", "sn", "cn", "mail"},
+		},
+		typePWPolicy: {
+			name:        typePWPolicy,
+			pkey:        "cn",
+			container:   "cn=" + Realm + ",cn=kerberos",
+			objectClass: []string{"top", "nsContainer", "krbPwdPolicy"},
+			searchAttrs: []string{"cn"},
+		},
+	}
+
+	maps.Copy(types, ruleTypes())
+	maps.Copy(types, pbacTypes())
+	types[typeOTPToken] = otpTokenType()
+
+	entries := make(map[string]map[string]*entry, len(types))
+	for name := range types {
+		entries[name] = make(map[string]*entry)
+	}
+
+	return &directory{
+		types:     types,
+		entries:   entries,
+		passwords: make(map[string]password),
+	}
+}
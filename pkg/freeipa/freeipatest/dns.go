@@ -0,0 +1,458 @@
+package freeipatest
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	attrDNSName = "idnsname"
+	attrCNAME   = "cnamerecord"
+
+	dnsZoneApex = "@"
+	dnsServer   = "ipa.example.test."
+)
+
+var (
+	// dnsNameAttrs IPA отдает как {"__dns_name__": ...}
+	dnsNameAttrs = []string{attrDNSName, "idnssoamname", "idnssoarname"}
+	dnsBoolAttrs = []string{"idnszoneactive", "idnsallowdynupdate"}
+	// dnsRecordAttrs поддерживаемые типы записей
+	dnsRecordAttrs = []string{"arecord", "aaaarecord", attrCNAME, "ptrrecord", "srvrecord", "txtrecord", "nsrecord"}
+	// dnsZoneAttrs что можно менять в dnszone_add/dnszone_mod
+	dnsZoneAttrs = []string{
+		"idnssoamname", "idnssoarname", "idnssoarefresh", "idnssoaretry", "idnssoaexpire", "idnssoaminimum",
+		"dnsttl", "idnsallowdynupdate",
+	}
+)
+
+// dnsZone зона со своими записями, имена записей относительные (www, @ - вершина)
+type dnsZone struct {
+	attrs   map[string][]string
+	records map[string]map[string][]string // lower(name) -> атрибуты записи
+}
+
+func (z *dnsZone) name() string {
+	return z.attrs[attrDNSName][0]
+}
+
+// cmdDNS dnszone_* и dnsrecord_*, зоны хранятся отдельно от каталога: у записей ключ состоит из зоны и имени
+func cmdDNS(s *Server, caller, method string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if strings.HasSuffix(method, "_add") || strings.HasSuffix(method, "_mod") || strings.HasSuffix(method, "_del") {
+		if !s.dir.isAdmin(caller) {
+			return nil, errACI("write", strings.SplitN(method, "_", 2)[0]) //nolint:mnd // тип и операция
+		}
+	}
+
+	switch method {
+	case "dnszone_find":
+		return cmdDNSZoneFind(s, args)
+	case "dnszone_show":
+		return cmdDNSZoneShow(s, args)
+	case "dnszone_add":
+		return cmdDNSZoneAdd(s, args, opts)
+	case "dnszone_mod":
+		return cmdDNSZoneMod(s, args, opts)
+	case "dnszone_del":
+		return cmdDNSZoneDel(s, args)
+	case "dnsrecord_find":
+		return cmdDNSRecordFind(s, args, opts)
+	case "dnsrecord_show":
+		return cmdDNSRecordShow(s, args)
+	case "dnsrecord_add":
+		return cmdDNSRecordAdd(s, args, opts)
+	case "dnsrecord_del":
+		return cmdDNSRecordDel(s, args, opts)
+	default:
+		return nil, newError(errCodeCommand, "CommandError", fmt.Sprintf("unknown command '%s'", method))
+	}
+}
+
+func cmdDNSZoneFind(s *Server, args []any) (map[string]any, *rpcError) {
+	criteria := strings.ToLower(firstArg(args))
+	found := []any{}
+
+	for _, key := range slices.Sorted(maps.Keys(s.dns)) {
+		if z := s.dns[key]; strings.Contains(key, criteria) {
+			found = append(found, renderDNS(z.attrs))
+		}
+	}
+
+	return map[string]any{
+		"result":    found,
+		"count":     len(found),
+		"truncated": false,
+		"summary":   fmt.Sprintf("%d zones matched", len(found)),
+	}, nil
+}
+
+func cmdDNSZoneShow(s *Server, args []any) (map[string]any, *rpcError) {
+	z, rpcErr := s.dnsZone(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return map[string]any{"result": renderDNS(z.attrs), "value": z.name(), "summary": nil}, nil
+}
+
+// cmdDNSZoneAdd SOA и NS по умолчанию указывают на сервер IPA
+func cmdDNSZoneAdd(s *Server, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	name := dnsAbsName(firstArg(args))
+	if name == "." {
+		return nil, errRequired(attrDNSName)
+	}
+	if _, ok := s.dns[name]; ok {
+		return nil, errDuplicate("DNS zone", name)
+	}
+
+	attrs := map[string][]string{
+		attrDNSName:          {name},
+		"idnszoneactive":     {"TRUE"},
+		"idnssoamname":       {dnsServer},
+		"idnssoarname":       {"hostmaster." + name},
+		"idnssoaserial":      {strconv.FormatInt(time.Now().Unix(), 10)},
+		"idnssoarefresh":     {"3600"},
+		"idnssoaretry":       {"900"},
+		"idnssoaexpire":      {"1209600"},
+		"idnssoaminimum":     {"3600"},
+		"idnsallowdynupdate": {"FALSE"},
+		"nsrecord":           {dnsServer},
+	}
+
+	if rpcErr := applyDNSZoneOpts(attrs, opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	z := &dnsZone{
+		attrs:   attrs,
+		records: map[string]map[string][]string{dnsZoneApex: {attrDNSName: {dnsZoneApex}, "nsrecord": {dnsServer}}},
+	}
+	s.dns[name] = z
+
+	return map[string]any{
+		"result":  renderDNS(z.attrs),
+		"value":   name,
+		"summary": fmt.Sprintf(`Added DNS zone "%s"`, name),
+	}, nil
+}
+
+func cmdDNSZoneMod(s *Server, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	z, rpcErr := s.dnsZone(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	before := maps.Clone(z.attrs)
+	if rpcErr = applyDNSZoneOpts(z.attrs, opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if maps.EqualFunc(before, z.attrs, slices.Equal) {
+		return nil, errEmptyModlist()
+	}
+
+	serial, _ := strconv.ParseInt(z.attrs["idnssoaserial"][0], 10, 64)
+	z.attrs["idnssoaserial"] = []string{strconv.FormatInt(serial+1, 10)}
+
+	return map[string]any{
+		"result":  renderDNS(z.attrs),
+		"value":   z.name(),
+		"summary": fmt.Sprintf(`Modified DNS zone "%s"`, z.name()),
+	}, nil
+}
+
+func cmdDNSZoneDel(s *Server, args []any) (map[string]any, *rpcError) {
+	z, rpcErr := s.dnsZone(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	delete(s.dns, z.name())
+
+	return map[string]any{
+		"result":  map[string]any{"failed": []any{}},
+		"value":   []any{z.name()},
+		"summary": fmt.Sprintf(`Deleted DNS zone "%s"`, z.name()),
+	}, nil
+}
+
+// applyDNSZoneOpts числовые параметры SOA проверяются, имена приводятся к абсолютным
+func applyDNSZoneOpts(attrs map[string][]string, opts map[string]any) *rpcError {
+	for _, attr := range dnsZoneAttrs {
+		v := firstOpt(opts, attr)
+		if v == "" {
+			continue
+		}
+
+		switch attr {
+		case "idnssoamname", "idnssoarname":
+			v = dnsAbsName(v)
+		case "idnsallowdynupdate":
+			v = strings.ToUpper(v)
+		default:
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				return newError(errCodeValidation, "ValidationError", fmt.Sprintf("invalid '%s': must be an integer", attr))
+			}
+		}
+
+		attrs[attr] = []string{v}
+	}
+
+	return nil
+}
+
+func cmdDNSRecordFind(s *Server, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	z, rpcErr := s.dnsZone(firstArg(args))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	criteria := ""
+	if len(args) > 1 {
+		criteria = strings.ToLower(firstArg(args[1:]))
+	}
+
+	found := []any{}
+
+	for _, key := range slices.Sorted(maps.Keys(z.records)) {
+		if strings.Contains(key, criteria) {
+			found = append(found, renderDNS(z.records[key]))
+		}
+	}
+
+	found, isTruncated := limitFound(found, s.findSizeLimit(opts))
+
+	return map[string]any{
+		"result":    found,
+		"count":     len(found),
+		"truncated": isTruncated,
+		"summary":   fmt.Sprintf("%d DNS resource records matched", len(found)),
+	}, nil
+}
+
+func cmdDNSRecordShow(s *Server, args []any) (map[string]any, *rpcError) {
+	_, name, record, rpcErr := s.dnsRecord(args)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if record == nil {
+		return nil, newError(errCodeNotFound, "NotFound", name+": DNS resource record not found")
+	}
+
+	return map[string]any{"result": renderDNS(record), "value": name, "summary": nil}, nil
+}
+
+// cmdDNSRecordAdd добавляет значения, запись создается при необходимости. CNAME не совместим с другими данными.
+func cmdDNSRecordAdd(s *Server, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	z, name, record, rpcErr := s.dnsRecord(args)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	isNew := record == nil
+	if isNew {
+		record = map[string][]string{attrDNSName: {name}}
+	}
+
+	isChanged := false
+
+	for _, attr := range dnsRecordAttrs {
+		for _, v := range toStrings(opts[attr]) {
+			if rpcErr = checkDNSValue(attr, v); rpcErr != nil {
+				return nil, rpcErr
+			}
+			if !slices.Contains(record[attr], v) {
+				record[attr] = append(record[attr], v)
+				isChanged = true
+			}
+		}
+	}
+
+	if ttl := firstOpt(opts, "dnsttl"); ttl != "" && !slices.Equal(record["dnsttl"], []string{ttl}) {
+		if n, err := strconv.Atoi(ttl); err != nil || n < 0 {
+			return nil, newError(errCodeValidation, "ValidationError", "invalid 'dnsttl': must be an integer")
+		}
+
+		record["dnsttl"] = []string{ttl}
+		isChanged = true
+	}
+
+	if !isChanged {
+		if isNew {
+			return nil, errRequired("record data")
+		}
+
+		return nil, errEmptyModlist()
+	}
+
+	if rpcErr = checkCNAME(record); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	z.records[strings.ToLower(name)] = record
+
+	return map[string]any{"result": renderDNS(record), "value": name, "summary": nil}, nil
+}
+
+// cmdDNSRecordDel удаляет значения (или все при del_all), запись без данных удаляется
+func cmdDNSRecordDel(s *Server, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	z, name, record, rpcErr := s.dnsRecord(args)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if record == nil {
+		return nil, newError(errCodeNotFound, "NotFound", name+": DNS resource record not found")
+	}
+
+	if !isTrue(opts["del_all"]) {
+		for _, attr := range dnsRecordAttrs {
+			for _, v := range toStrings(opts[attr]) {
+				if !slices.Contains(record[attr], v) {
+					return nil, newError(errCodeAttrValueNotFound, "AttrValueNotFound",
+						fmt.Sprintf("%s does not contain '%s'", attr, v))
+				}
+
+				record[attr] = slices.DeleteFunc(record[attr], func(r string) bool { return r == v })
+			}
+		}
+	}
+
+	hasData := !isTrue(opts["del_all"]) && slices.ContainsFunc(dnsRecordAttrs, func(attr string) bool {
+		return len(record[attr]) > 0
+	})
+
+	if hasData {
+		return map[string]any{"result": renderDNS(record), "value": []any{name}, "summary": nil}, nil
+	}
+
+	delete(z.records, strings.ToLower(name))
+
+	return map[string]any{
+		"result":  map[string]any{"failed": []any{}},
+		"value":   []any{name},
+		"summary": fmt.Sprintf(`Deleted record "%s"`, name),
+	}, nil
+}
+
+func checkDNSValue(attr, v string) *rpcError {
+	invalid := func(msg string) *rpcError {
+		return newError(errCodeValidation, "ValidationError", fmt.Sprintf("%s: '%s': %s", attr, v, msg))
+	}
+
+	switch attr {
+	case "arecord":
+		if addr, err := netip.ParseAddr(v); err != nil || !addr.Is4() {
+			return invalid("invalid IP address format")
+		}
+	case "aaaarecord":
+		if addr, err := netip.ParseAddr(v); err != nil || !addr.Is6() || addr.Is4In6() {
+			return invalid("invalid IP address format")
+		}
+	case "srvrecord":
+		fields := strings.Fields(v)
+		if len(fields) != 4 { //nolint:mnd // priority weight port target
+			return invalid("format must be 'priority weight port target'")
+		}
+
+		for _, f := range fields[:3] {
+			if _, err := strconv.ParseUint(f, 10, 16); err != nil {
+				return invalid("invalid number")
+			}
+		}
+	case attrCNAME, "ptrrecord", "nsrecord", "txtrecord":
+		if strings.TrimSpace(v) == "" {
+			return invalid("empty value")
+		}
+	}
+
+	return nil
+}
+
+// checkCNAME у записи с CNAME не может быть других данных и второго CNAME
+func checkCNAME(record map[string][]string) *rpcError {
+	cnames := len(record[attrCNAME])
+	if cnames == 0 {
+		return nil
+	}
+	if cnames > 1 {
+		return newError(errCodeValidation, "ValidationError",
+			"CNAME record: only one CNAME record is allowed per name (RFC 2136, section 1.1.5)")
+	}
+
+	for _, attr := range dnsRecordAttrs {
+		if attr != attrCNAME && len(record[attr]) > 0 {
+			return newError(errCodeValidation, "ValidationError",
+				"CNAME record: CNAME record is not allowed to coexist with any other record (RFC 1034, section 3.6.2)")
+		}
+	}
+
+	return nil
+}
+
+// dnsZone зона по имени с точкой или без
+func (s *Server) dnsZone(name string) (*dnsZone, *rpcError) {
+	z, ok := s.dns[dnsAbsName(name)]
+	if !ok {
+		return nil, newError(errCodeNotFound, "NotFound", dnsAbsName(name)+": DNS zone not found")
+	}
+
+	return z, nil
+}
+
+// dnsRecord аргументы dnsrecord_*: зона и имя записи, record nil если записи нет
+func (s *Server) dnsRecord(args []any) (*dnsZone, string, map[string][]string, *rpcError) {
+	z, rpcErr := s.dnsZone(firstArg(args))
+	if rpcErr != nil {
+		return nil, "", nil, rpcErr
+	}
+
+	name := ""
+	if len(args) > 1 {
+		name = firstArg(args[1:])
+	}
+	if name == "" {
+		return nil, "", nil, errRequired(attrDNSName)
+	}
+
+	return z, name, z.records[strings.ToLower(name)], nil
+}
+
+func renderDNS(attrs map[string][]string) map[string]any {
+	result := make(map[string]any, len(attrs))
+
+	for attr, vals := range attrs {
+		if len(vals) == 0 {
+			continue
+		}
+
+		if slices.Contains(dnsNameAttrs, attr) {
+			names := make([]any, len(vals))
+			for i, v := range vals {
+				names[i] = map[string]any{"__dns_name__": v}
+			}
+
+			result[attr] = names
+
+			continue
+		}
+
+		if slices.Contains(dnsBoolAttrs, attr) {
+			result[attr] = strings.EqualFold(vals[0], "TRUE")
+
+			continue
+		}
+
+		result[attr] = renderValues(attr, vals)
+	}
+
+	return result
+}
+
+// dnsAbsName example.test -> example.test.
+func dnsAbsName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".") + "."
+}
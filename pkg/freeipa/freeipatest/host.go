@@ -0,0 +1,107 @@
+package freeipatest
+
+import (
+	"fmt"
+	"strings"
+)
+
+const errCodeDNSNotARecord = 4019
+
+// cmdHostAdd как в IPA: без force или ip_address хост должен резолвиться, random выдает OTP для ipa-client-install
+func cmdHostAdd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	fqdn := strings.ToLower(firstArg(args))
+
+	shortName, domain, ok := strings.Cut(fqdn, ".")
+	if !ok || shortName == "" || domain == "" {
+		return nil, newError(errCodeValidation, "ValidationError",
+			"invalid 'hostname': Fully-qualified hostname required")
+	}
+	if !isTrue(opts["force"]) && firstOpt(opts, "ip_address") == "" {
+		return nil, newError(errCodeDNSNotARecord, "DNSNotARecordError",
+			fmt.Sprintf("Host '%s' does not have corresponding DNS A/AAAA record", fqdn))
+	}
+
+	hostOpts, randomPass := hostPasswordOpts(opts)
+	hostOpts["krbprincipalname"] = fmt.Sprintf("host/%s@%s", fqdn, Realm)
+	hostOpts["krbcanonicalname"] = hostOpts["krbprincipalname"]
+	hostOpts["serverhostname"] = shortName
+	hostOpts["managedby_host"] = fqdn
+	hostOpts["has_keytab"] = false
+
+	result, rpcErr := cmdAdd(s, caller, s.dir.types[typeHost], []any{fqdn}, hostOpts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if randomPass != "" {
+		result["result"].(map[string]any)["randompassword"] = randomPass //nolint:forcetypeassert
+	}
+
+	return result, nil
+}
+
+// cmdHostMod random/userpassword задают новый OTP для повторной регистрации
+func cmdHostMod(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	hostOpts, randomPass := hostPasswordOpts(opts)
+
+	result, rpcErr := cmdMod(s, caller, s.dir.types[typeHost], args, hostOpts)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if randomPass != "" {
+		result["result"].(map[string]any)["randompassword"] = randomPass //nolint:forcetypeassert
+	}
+
+	return result, nil
+}
+
+// hostPasswordOpts OTP хоста хранится как атрибут записи, наружу видно только has_password
+func hostPasswordOpts(opts map[string]any) (map[string]any, string) {
+	hostOpts := make(map[string]any, len(opts))
+	for k, v := range opts {
+		hostOpts[k] = v
+	}
+
+	password, randomPass := firstOpt(opts, "userpassword"), ""
+	if password == "" && isTrue(opts["random"]) {
+		randomPass = randomPassword()
+		password = randomPass
+	}
+
+	if password != "" {
+		hostOpts["setattr"] = append(toAnySlice(toStrings(opts["setattr"])), "userpassword="+password)
+		hostOpts["has_password"] = true
+	}
+
+	return hostOpts, randomPass
+}
+
+// cmdHostDisable убирает keytab, OTP и сертификаты, после этого хост надо регистрировать заново
+func cmdHostDisable(s *Server, caller string, args []any) (map[string]any, *rpcError) {
+	fqdn := firstArg(args)
+
+	e := s.dir.get(typeHost, fqdn)
+	if e == nil {
+		return nil, errNotFound(typeHost, fqdn)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("krbprincipalkey", e)
+	}
+
+	if e.first("has_keytab") != "TRUE" && e.first("has_password") != "TRUE" && len(e.attrs["usercertificate"]) == 0 {
+		return nil, newError(errCodeAlreadyInactive, "AlreadyInactive", "This entry is already disabled")
+	}
+
+	e.attrs["has_keytab"] = []string{"FALSE"}
+	e.attrs["has_password"] = []string{"FALSE"}
+	delete(e.attrs, "userpassword")
+	delete(e.attrs, "usercertificate")
+	s.dir.touch(e)
+
+	return map[string]any{
+		"result":  true,
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(`Disabled host "%s"`, e.pkey()),
+	}, nil
+}
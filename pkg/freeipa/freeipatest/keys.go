@@ -0,0 +1,146 @@
+package freeipatest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	attrSSHPubKey   = "ipasshpubkey"
+	attrSSHPubKeyFP = "sshpubkeyfp"
+	attrUserCert    = "usercertificate"
+
+	certTimeLayout = "Mon Jan 02 15:04:05 2006 UTC"
+)
+
+// checkSSHKeys ключи из опций (ipasshpubkey, setattr/addattr ipasshpubkey=...) должны быть в формате authorized_keys
+func checkSSHKeys(opts map[string]any) *rpcError {
+	keys := toStrings(opts[attrSSHPubKey])
+
+	for _, key := range []string{"setattr", "addattr"} {
+		for _, item := range toStrings(opts[key]) {
+			if attr, val, ok := strings.Cut(item, "="); ok && strings.EqualFold(attr, attrSSHPubKey) {
+				keys = append(keys, val)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if _, ok := sshFingerprint(key); !ok {
+			return newError(errCodeValidation, "ValidationError", "invalid 'sshpubkey': invalid SSH public key")
+		}
+	}
+
+	return nil
+}
+
+// updateSSHFingerprints sshpubkeyfp IPA вычисляет сам по текущим ключам
+func updateSSHFingerprints(e *entry) {
+	fingerprints := make([]string, 0, len(e.attrs[attrSSHPubKey]))
+
+	for _, key := range e.attrs[attrSSHPubKey] {
+		if fp, ok := sshFingerprint(key); ok {
+			fingerprints = append(fingerprints, fp)
+		}
+	}
+
+	e.attrs[attrSSHPubKeyFP] = fingerprints
+}
+
+// sshFingerprint "SHA256:<base64> comment (type)" как в sshpubkeyfp
+func sshFingerprint(key string) (string, bool) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 { //nolint:mnd // тип и тело ключа
+		return "", false
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(blob) < 4 { //nolint:mnd // длина типа
+		return "", false
+	}
+
+	// тело ключа начинается с его типа: uint32 длины и сама строка
+	typeLen := binary.BigEndian.Uint32(blob)
+	if uint64(len(blob)) < 4+uint64(typeLen) || !bytes.Equal(blob[4:4+typeLen], []byte(fields[0])) {
+		return "", false
+	}
+
+	sum := sha256.Sum256(blob)
+	result := "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+
+	if comment := strings.Join(fields[2:], " "); comment != "" {
+		result += " " + comment
+	}
+
+	return result + " (" + fields[0] + ")", true
+}
+
+// cmdUserEditCert user_add_cert/user_remove_cert, сертификаты приходят в base64 (DER)
+func cmdUserEditCert(
+	s *Server,
+	caller string,
+	args []any,
+	opts map[string]any,
+	isRemove bool,
+) (map[string]any, *rpcError) {
+	uid := firstArg(args)
+
+	e := s.dir.get(typeUser, uid)
+	if e == nil {
+		return nil, errNotFound(typeUser, uid)
+	}
+	if !s.dir.isAdmin(caller) && !strings.EqualFold(caller, uid) {
+		return nil, errACIAttr(attrUserCert, e)
+	}
+
+	isChanged := false
+
+	for _, encoded := range toStrings(opts[attrUserCert]) {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err == nil {
+			_, err = x509.ParseCertificate(der)
+		}
+		if err != nil {
+			return nil, newError(errCodeValidation, "ValidationError", "invalid 'certificate': "+err.Error())
+		}
+
+		isPresent := slices.Contains(e.attrs[attrUserCert], string(der))
+
+		switch {
+		case isRemove && !isPresent:
+			return nil, newError(errCodeAttrValueNotFound, "AttrValueNotFound",
+				"usercertificate does not contain the certificate")
+		case isRemove:
+			e.attrs[attrUserCert] = slices.DeleteFunc(e.attrs[attrUserCert], func(v string) bool {
+				return v == string(der)
+			})
+			isChanged = true
+		case !isPresent:
+			e.attrs[attrUserCert] = append(e.attrs[attrUserCert], string(der))
+			isChanged = true
+		}
+	}
+
+	if !isChanged {
+		return nil, errEmptyModlist()
+	}
+
+	s.dir.touch(e)
+
+	summary := fmt.Sprintf(`Added certificates to user "%s"`, e.pkey())
+	if isRemove {
+		summary = fmt.Sprintf(`Removed certificates from user "%s"`, e.pkey())
+	}
+
+	return map[string]any{
+		"result":  s.dir.render(e, renderOptsFrom(opts)),
+		"value":   e.pkey(),
+		"summary": summary,
+	}, nil
+}
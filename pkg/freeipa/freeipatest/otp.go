@@ -0,0 +1,193 @@
+package freeipatest
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	typeOTPToken = "otptoken"
+
+	attrOTPOwner    = "ipatokenowner"
+	attrOTPKey      = "ipatokenotpkey"
+	attrUserAuthTyp = "ipauserauthtype"
+
+	otpKeyLen = 20 // 160 бит, как в IPA
+)
+
+var (
+	otpAlgorithms = []string{"sha1", "sha256", "sha384", "sha512"}
+	userAuthTypes = []string{"password", "radius", "otp", "pkinit", "hardened", "idp", "passkey"}
+)
+
+func otpTokenType() *objectType {
+	return &objectType{
+		name:        typeOTPToken,
+		pkey:        "ipatokenuniqueid",
+		container:   "cn=otp",
+		objectClass: []string{"ipatoken", "top"},
+		searchAttrs: []string{"ipatokenuniqueid", "description"},
+	}
+}
+
+// cmdOTPTokenAdd выпускает токен владельцу (по умолчанию - вызывающему), uri отдается только здесь
+func cmdOTPTokenAdd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	owner := firstOpt(opts, attrOTPOwner)
+	if owner == "" {
+		owner = caller
+	}
+
+	ownerEntry := s.dir.get(typeUser, owner)
+	if ownerEntry == nil {
+		return nil, errNotFound(typeUser, owner)
+	}
+	if !s.dir.isAdmin(caller) && !strings.EqualFold(caller, owner) {
+		return nil, errACI("add", typeOTPToken)
+	}
+
+	tokenType := strings.ToLower(firstOpt(opts, "type"))
+	if tokenType == "" {
+		tokenType = "totp"
+	}
+	if tokenType != "totp" && tokenType != "hotp" {
+		return nil, newError(errCodeValidation, "ValidationError", "invalid 'type': must be one of 'totp', 'hotp'")
+	}
+
+	attrs := map[string]string{
+		"ipatokenotpalgorithm": "sha1",
+		"ipatokenotpdigits":    "6",
+		"ipatokentotptimestep": "30",
+		"ipatokenhotpcounter":  "0",
+	}
+
+	for attr := range attrs {
+		if v := firstOpt(opts, attr); v != "" {
+			attrs[attr] = strings.ToLower(v)
+		}
+	}
+
+	if !slices.Contains(otpAlgorithms, attrs["ipatokenotpalgorithm"]) {
+		return nil, newError(errCodeValidation, "ValidationError",
+			"invalid 'algo': must be one of 'sha1', 'sha256', 'sha384', 'sha512'")
+	}
+	if d := attrs["ipatokenotpdigits"]; d != "6" && d != "8" {
+		return nil, newError(errCodeValidation, "ValidationError", "invalid 'digits': must be one of '6', '8'")
+	}
+
+	if tokenType == "totp" {
+		delete(attrs, "ipatokenhotpcounter")
+	} else {
+		delete(attrs, "ipatokentotptimestep")
+	}
+
+	id := firstArg(args)
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	secret := make([]byte, otpKeyLen)
+	_, _ = rand.Read(secret)
+	encodedSecret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	tokenOpts := map[string]any{
+		"type":           strings.ToUpper(tokenType),
+		attrOTPOwner:     ownerEntry.pkey(),
+		attrOTPKey:       encodedSecret,
+		"description":    firstOpt(opts, "description"),
+		"ipatokenvendor": firstOpt(opts, "ipatokenvendor"),
+	}
+	for attr, v := range attrs {
+		tokenOpts[attr] = v
+	}
+
+	// токен создается от имени админа: владельцу тоже можно
+	result, rpcErr := cmdAdd(s, AdminUID, s.dir.types[typeOTPToken], []any{id}, withoutEmpty(tokenOpts))
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	issuer := ownerEntry.pkey() + "@" + Realm
+	query := url.Values{
+		"issuer":    {issuer},
+		"secret":    {encodedSecret},
+		"digits":    {attrs["ipatokenotpdigits"]},
+		"algorithm": {strings.ToUpper(attrs["ipatokenotpalgorithm"])},
+	}
+
+	if tokenType == "totp" {
+		query.Set("period", attrs["ipatokentotptimestep"])
+	} else {
+		query.Set("counter", attrs["ipatokenhotpcounter"])
+	}
+
+	uri := url.URL{Scheme: "otpauth", Host: tokenType, Path: "/" + issuer + ":" + id, RawQuery: query.Encode()}
+	result["result"].(map[string]any)["uri"] = uri.String() //nolint:forcetypeassert
+	result["summary"] = fmt.Sprintf(`Added OTP token "%s"`, id)
+
+	return result, nil
+}
+
+// cmdOTPTokenOwned otptoken_mod/otptoken_del: владелец может управлять своими токенами
+func cmdOTPTokenOwned(s *Server, caller, op string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	typ := s.dir.types[typeOTPToken]
+
+	for _, id := range toStrings(firstOf(args)) {
+		e := s.dir.get(typeOTPToken, id)
+		if e == nil {
+			return nil, errNotFound("OTP token", id)
+		}
+		if !s.dir.isAdmin(caller) && !strings.EqualFold(e.first(attrOTPOwner), caller) {
+			return nil, errACIAttr("ipatokendisabled", e)
+		}
+	}
+
+	if op == "del" {
+		return cmdDel(s, AdminUID, typ, args)
+	}
+
+	for _, attr := range []string{attrOTPOwner, attrOTPKey, "type"} {
+		if _, ok := opts[attr]; ok {
+			return nil, newError(errCodeValidation, "ValidationError",
+				fmt.Sprintf("invalid '%s': attribute is not editable", attr))
+		}
+	}
+
+	return cmdMod(s, AdminUID, typ, args, opts)
+}
+
+// checkUserAuthTypes значения ipauserauthtype в опциях user_mod
+func checkUserAuthTypes(opts map[string]any) *rpcError {
+	for _, v := range toStrings(opts[attrUserAuthTyp]) {
+		if v != "" && !slices.Contains(userAuthTypes, strings.ToLower(v)) {
+			return newError(errCodeValidation, "ValidationError", fmt.Sprintf(
+				"invalid 'ipauserauthtype': must be one of '%s'", strings.Join(userAuthTypes, "', '"),
+			))
+		}
+	}
+
+	return nil
+}
+
+func firstOf(args []any) any {
+	if len(args) == 0 {
+		return nil
+	}
+
+	return args[0]
+}
+
+func withoutEmpty(opts map[string]any) map[string]any {
+	for k, v := range opts {
+		if v == "" {
+			delete(opts, k)
+		}
+	}
+
+	return opts
+}
@@ -0,0 +1,141 @@
+package freeipatest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// permissionRights допустимые значения ipapermright
+var permissionRights = []string{"read", "search", "compare", "write", "add", "delete", "all"}
+
+// pbacTypes привилегии, разрешения и сервисы (последние нужны только как участники ролей)
+func pbacTypes() map[string]*objectType {
+	return map[string]*objectType{
+		typeService: {
+			name:        typeService,
+			pkey:        "krbprincipalname",
+			container:   "cn=services,cn=accounts",
+			objectClass: []string{"krbprincipal", "krbprincipalaux", "krbticketpolicyaux", "ipaobject", "ipaservice"},
+			searchAttrs: []string{"krbprincipalname"},
+		},
+		typePrivilege: {
+			name:        typePrivilege,
+			pkey:        "cn",
+			container:   "cn=privileges,cn=pbac",
+			objectClass: []string{"nestedgroup", "groupofnames", "top"},
+			memberTypes: []string{typeRole},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typePermission: {
+			name:        typePermission,
+			pkey:        "cn",
+			container:   "cn=permissions,cn=pbac",
+			objectClass: []string{"ipapermission", "top", "groupofnames", "ipapermissionv2"},
+			memberTypes: []string{typePrivilege},
+			searchAttrs: []string{"cn"},
+		},
+	}
+}
+
+// cmdPermissionAdd права обязательны, по умолчанию разрешение выдается через привилегии
+func cmdPermissionAdd(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if len(toStrings(opts["ipapermright"])) == 0 {
+		return nil, errRequired("ipapermright")
+	}
+	if rpcErr := checkPermissionOpts(opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if firstOpt(opts, "ipapermbindruletype") == "" {
+		opts["ipapermbindruletype"] = "permission"
+	}
+
+	return cmdAdd(s, caller, s.dir.types[typePermission], args, opts)
+}
+
+func cmdPermissionMod(s *Server, caller string, args []any, opts map[string]any) (map[string]any, *rpcError) {
+	if rpcErr := checkPermissionOpts(opts); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return cmdMod(s, caller, s.dir.types[typePermission], args, opts)
+}
+
+func checkPermissionOpts(opts map[string]any) *rpcError {
+	for _, right := range toStrings(opts["ipapermright"]) {
+		if !slices.Contains(permissionRights, strings.ToLower(right)) {
+			return newError(errCodeValidation, "ValidationError", fmt.Sprintf(
+				"invalid 'ipapermright': must be one of %s", strings.Join(permissionRights, ", "),
+			))
+		}
+	}
+
+	bindType := firstOpt(opts, "ipapermbindruletype")
+	if bindType != "" && !slices.Contains([]string{"permission", "all", "anonymous"}, bindType) {
+		return newError(errCodeValidation, "ValidationError",
+			"invalid 'ipapermbindruletype': must be one of 'permission', 'all', 'anonymous'")
+	}
+
+	return nil
+}
+
+// cmdEditMemberOf обратные связи: role_add_privilege пишет роль в member_role привилегии,
+// privilege_add_permission - привилегию в member_privilege разрешения
+func cmdEditMemberOf(
+	s *Server,
+	caller string,
+	typ *objectType,
+	containerType string,
+	args []any,
+	opts map[string]any,
+	isRemove bool,
+) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("member", e)
+	}
+
+	attr := "member_" + typ.name
+	failedItems := []any{}
+	completed := 0
+
+	for _, name := range toStrings(opts[containerType]) {
+		container := s.dir.get(containerType, name)
+		if container == nil {
+			failedItems = append(failedItems, []any{name, "no such entry"})
+			continue
+		}
+
+		isMember := slices.ContainsFunc(container.attrs[attr], func(v string) bool {
+			return strings.EqualFold(v, e.pkey())
+		})
+
+		switch {
+		case !isRemove && isMember:
+			failedItems = append(failedItems, []any{name, "This entry is already a member"})
+		case isRemove && !isMember:
+			failedItems = append(failedItems, []any{name, "This entry is not a member"})
+		case isRemove:
+			container.attrs[attr] = slices.DeleteFunc(container.attrs[attr], func(v string) bool {
+				return strings.EqualFold(v, e.pkey())
+			})
+			s.dir.touch(container)
+			completed++
+		default:
+			container.attrs[attr] = append(container.attrs[attr], e.pkey())
+			s.dir.touch(container)
+			completed++
+		}
+	}
+
+	return map[string]any{
+		"result":    s.dir.render(e, renderOptsFrom(opts)),
+		"failed":    map[string]any{"member": map[string]any{containerType: failedItems}},
+		"completed": completed,
+	}, nil
+}
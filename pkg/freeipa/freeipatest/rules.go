@@ -0,0 +1,436 @@
+package freeipatest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const errCodeMutuallyExclusive = 4303
+
+// ruleTypes правила hbac/sudo и то, на что они ссылаются: хосты, группы хостов, сервисы и команды
+func ruleTypes() map[string]*objectType {
+	userMember := ruleMember{
+		attr: "memberuser", category: "usercategory", types: []string{typeUser, typeGroup}, label: "users",
+	}
+	hostMember := ruleMember{
+		attr: "memberhost", category: "hostcategory", types: []string{typeHost, typeHostGroup}, label: "hosts",
+	}
+	cmdTypes := []string{typeSudoCmd, typeSudoCmdGroup}
+
+	return map[string]*objectType{
+		typeHost: {
+			name:      typeHost,
+			pkey:      "fqdn",
+			container: "cn=computers,cn=accounts",
+			objectClass: []string{
+				"ipaobject", "nshost", "ipahost", "pkiuser", "ipaservice", "krbprincipalaux", "krbprincipal",
+				"ieee802device", "ipasshhost", "top", "ipaSshGroupOfPubKeys",
+			},
+			searchAttrs: []string{"fqdn", "description", "l", "nsosversion"},
+		},
+		typeHostGroup: {
+			name:        typeHostGroup,
+			pkey:        "cn",
+			container:   "cn=hostgroups,cn=accounts",
+			objectClass: []string{"ipaobject", "ipahostgroup", "nestedGroup", "groupOfNames", "top", "mepOriginEntry"},
+			memberTypes: []string{typeHost, typeHostGroup},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typeHBACSvc: {
+			name:        typeHBACSvc,
+			pkey:        "cn",
+			container:   "cn=hbacservices,cn=hbac",
+			objectClass: []string{"ipaobject", "ipahbacservice"},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typeHBACSvcGroup: {
+			name:        typeHBACSvcGroup,
+			pkey:        "cn",
+			container:   "cn=hbacservicegroups,cn=hbac",
+			objectClass: []string{"ipaobject", "ipahbacservicegroup", "nestedGroup", "groupOfNames", "top"},
+			memberTypes: []string{typeHBACSvc},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typeHBACRule: {
+			name:        typeHBACRule,
+			pkey:        "cn",
+			container:   "cn=hbac",
+			objectClass: []string{"ipaassociation", "ipahbacrule"},
+			searchAttrs: []string{"cn", "description"},
+			ruleMembers: map[string]ruleMember{
+				"user": userMember,
+				"host": hostMember,
+				"service": {
+					attr: "memberservice", category: "servicecategory",
+					types: []string{typeHBACSvc, typeHBACSvcGroup}, label: "services",
+				},
+			},
+		},
+		typeSudoCmd: {
+			name:        typeSudoCmd,
+			pkey:        "sudocmd",
+			container:   "cn=sudocmds,cn=sudo",
+			objectClass: []string{"ipaobject", "ipasudocmd"},
+			searchAttrs: []string{"sudocmd", "description"},
+		},
+		typeSudoCmdGroup: {
+			name:        typeSudoCmdGroup,
+			pkey:        "cn",
+			container:   "cn=sudocmdgroups,cn=sudo",
+			objectClass: []string{"ipaobject", "ipasudocmdgrp", "groupOfNames", "top"},
+			memberTypes: []string{typeSudoCmd},
+			searchAttrs: []string{"cn", "description"},
+		},
+		typeSudoRule: {
+			name:        typeSudoRule,
+			pkey:        "cn",
+			container:   "cn=sudorules,cn=sudo",
+			objectClass: []string{"ipaassociation", "ipasudorule"},
+			searchAttrs: []string{"cn", "description"},
+			ruleMembers: map[string]ruleMember{
+				"user": userMember,
+				"host": hostMember,
+				"allow_command": {
+					attr: "memberallowcmd", category: "cmdcategory", types: cmdTypes, label: "commands",
+				},
+				"deny_command": {attr: "memberdenycmd", types: cmdTypes, label: "commands"},
+				"runasuser": {
+					attr: "ipasudorunas", category: "ipasudorunasusercategory",
+					types: []string{typeUser, typeGroup}, label: "runAs users",
+				},
+				"runasgroup": {
+					attr: "ipasudorunasgroup", category: "ipasudorunasgroupcategory",
+					types: []string{typeGroup}, label: "runAs groups",
+				},
+			},
+		},
+	}
+}
+
+// seedRules как в свежем IPA: правило allow_all и стандартные сервисы
+func (d *directory) seedRules() {
+	for _, svc := range []string{"sshd", "login", "sudo", "sudo-i", "su", "su-l"} {
+		d.put(typeHBACSvc, map[string][]string{
+			"cn":          {svc},
+			"description": {svc},
+			"objectclass": slices.Clone(d.types[typeHBACSvc].objectClass),
+		})
+	}
+
+	d.put(typeHBACSvcGroup, map[string][]string{
+		"cn":             {"Sudo"},
+		"description":    {"Default group of Sudo related services"},
+		"member_hbacsvc": {"sudo", "sudo-i"},
+		"objectclass":    slices.Clone(d.types[typeHBACSvcGroup].objectClass),
+	})
+	d.put(typeHBACRule, map[string][]string{
+		"cn":              {"allow_all"},
+		"description":     {"Allow all users to access any host from any host"},
+		"accessruletype":  {"allow"},
+		"usercategory":    {"all"},
+		"hostcategory":    {"all"},
+		"servicecategory": {"all"},
+		"ipaenabledflag":  {"TRUE"},
+		"objectclass":     slices.Clone(d.types[typeHBACRule].objectClass),
+	})
+}
+
+// cmdRule команды, которые есть только у правил hbac/sudo. Последний результат - обработана ли команда.
+func cmdRule(
+	s *Server,
+	caller string,
+	typ *objectType,
+	op string,
+	args []any,
+	opts map[string]any,
+) (map[string]any, *rpcError, bool) {
+	if typ.ruleMembers == nil {
+		return nil, nil, false
+	}
+
+	switch op {
+	case "add":
+		if typ.name == typeHBACRule {
+			opts["accessruletype"] = "allow"
+		}
+
+		opts["ipaenabledflag"] = "TRUE"
+		result, rpcErr := cmdAdd(s, caller, typ, args, opts)
+
+		return result, rpcErr, true
+	case "mod":
+		result, rpcErr := cmdRuleMod(s, caller, typ, args, opts)
+		return result, rpcErr, true
+	case "enable", "disable":
+		result, rpcErr := cmdRuleToggle(s, caller, typ, args, op == "disable")
+		return result, rpcErr, true
+	case "add_option", "remove_option":
+		result, rpcErr := cmdRuleOption(s, caller, typ, args, opts, op == "remove_option")
+		return result, rpcErr, true
+	}
+
+	action, suffix, _ := strings.Cut(op, "_")
+	if member, ok := typ.ruleMembers[suffix]; ok && (action == "add" || action == "remove") {
+		result, rpcErr := cmdEditRuleMembers(s, caller, typ, member, args, opts, action == "remove")
+		return result, rpcErr, true
+	}
+
+	return nil, nil, false
+}
+
+// cmdRuleMod категорию all нельзя выставить, пока в правиле есть соответствующие участники
+func cmdRuleMod(
+	s *Server,
+	caller string,
+	typ *objectType,
+	args []any,
+	opts map[string]any,
+) (map[string]any, *rpcError) {
+	if e := s.dir.get(typ.name, firstArg(args)); e != nil {
+		for _, member := range typ.ruleMembers {
+			if member.category == "" || !strings.EqualFold(firstOpt(opts, member.category), "all") {
+				continue
+			}
+
+			for _, memberType := range member.types {
+				if len(e.attrs[member.attr+"_"+memberType]) > 0 {
+					return nil, newError(errCodeMutuallyExclusive, "MutuallyExclusiveError", fmt.Sprintf(
+						"%s cannot be set to 'all' while there are allowed %s", member.category, member.label,
+					))
+				}
+			}
+		}
+	}
+
+	return cmdMod(s, caller, typ, args, opts)
+}
+
+func cmdRuleToggle(s *Server, caller string, typ *objectType, args []any, isDisable bool) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("ipaenabledflag", e)
+	}
+
+	flag, action := "TRUE", "Enabled"
+	if isDisable {
+		flag, action = "FALSE", "Disabled"
+	}
+
+	if e.first("ipaenabledflag") == flag {
+		if isDisable {
+			return nil, newError(errCodeAlreadyInactive, "AlreadyInactive", "This entry is already disabled")
+		}
+
+		return nil, newError(errCodeAlreadyActive, "AlreadyActive", "This entry is already enabled")
+	}
+
+	e.attrs["ipaenabledflag"] = []string{flag}
+	s.dir.touch(e)
+
+	return map[string]any{
+		"result":  true,
+		"value":   e.pkey(),
+		"summary": fmt.Sprintf(`%s %s "%s"`, action, typ.name, e.pkey()),
+	}, nil
+}
+
+// cmdRuleOption sudorule_add_option/sudorule_remove_option (ipasudoopt)
+func cmdRuleOption(
+	s *Server,
+	caller string,
+	typ *objectType,
+	args []any,
+	opts map[string]any,
+	isRemove bool,
+) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr("ipasudoopt", e)
+	}
+
+	option := firstOpt(opts, "ipasudoopt")
+	if option == "" {
+		return nil, errRequired("sudooption")
+	}
+
+	has := slices.Contains(e.attrs["ipasudoopt"], option)
+
+	switch {
+	case !isRemove && has:
+		return nil, newError(errCodeDuplicateEntry, "DuplicateEntry", "This entry already exists")
+	case isRemove && !has:
+		return nil, newError(errCodeAttrValueNotFound, "AttrValueNotFound",
+			fmt.Sprintf("ipasudoopt does not contain '%s'", option))
+	case isRemove:
+		e.attrs["ipasudoopt"] = slices.DeleteFunc(e.attrs["ipasudoopt"], func(v string) bool { return v == option })
+	default:
+		e.attrs["ipasudoopt"] = append(e.attrs["ipasudoopt"], option)
+	}
+
+	s.dir.touch(e)
+
+	return map[string]any{
+		"result": s.dir.render(e, renderOptsFrom(opts)),
+		"value":  e.pkey(),
+	}, nil
+}
+
+// cmdEditRuleMembers hbacrule_add_user, sudorule_remove_allow_command, ...
+// Ответ как у *_add_member: failed по типам участников и completed.
+func cmdEditRuleMembers(
+	s *Server,
+	caller string,
+	typ *objectType,
+	member ruleMember,
+	args []any,
+	opts map[string]any,
+	isRemove bool,
+) (map[string]any, *rpcError) {
+	pkey := firstArg(args)
+
+	e := s.dir.get(typ.name, pkey)
+	if e == nil {
+		return nil, errNotFound(typ.name, pkey)
+	}
+	if !s.dir.isAdmin(caller) {
+		return nil, errACIAttr(member.attr, e)
+	}
+	if !isRemove && member.category != "" && strings.EqualFold(e.first(member.category), "all") {
+		return nil, newError(errCodeMutuallyExclusive, "MutuallyExclusiveError", fmt.Sprintf(
+			"%s cannot be added when %s='all'", member.label, member.category,
+		))
+	}
+
+	failed := map[string]any{}
+	completed := 0
+
+	for _, memberType := range member.types {
+		attr := member.attr + "_" + memberType
+		failedItems := []any{}
+
+		for _, name := range toStrings(opts[memberType]) {
+			isMember := slices.ContainsFunc(e.attrs[attr], func(v string) bool {
+				return strings.EqualFold(v, name)
+			})
+
+			switch {
+			case s.dir.get(memberType, name) == nil:
+				failedItems = append(failedItems, []any{name, "no such entry"})
+			case !isRemove && isMember:
+				failedItems = append(failedItems, []any{name, "This entry is already a member"})
+			case isRemove && !isMember:
+				failedItems = append(failedItems, []any{name, "This entry is not a member"})
+			case isRemove:
+				e.attrs[attr] = slices.DeleteFunc(e.attrs[attr], func(v string) bool {
+					return strings.EqualFold(v, name)
+				})
+				completed++
+			default:
+				e.attrs[attr] = append(e.attrs[attr], s.dir.get(memberType, name).pkey())
+				completed++
+			}
+		}
+
+		failed[memberType] = failedItems
+	}
+
+	if completed > 0 {
+		s.dir.touch(e)
+	}
+
+	return map[string]any{
+		"result":    s.dir.render(e, renderOptsFrom(opts)),
+		"failed":    map[string]any{member.attr: failed},
+		"completed": completed,
+	}, nil
+}
+
+// cmdHBACTest решение по включенным hbac-правилам (или только по rules) для user/targethost/service
+func cmdHBACTest(s *Server, caller string, opts map[string]any) (map[string]any, *rpcError) {
+	if !s.dir.isAdmin(caller) {
+		return nil, errACI("read", typeHBACRule)
+	}
+
+	uid, host, service := firstOpt(opts, "user"), firstOpt(opts, "targethost"), firstOpt(opts, "service")
+
+	switch {
+	case uid == "":
+		return nil, errRequired("user")
+	case host == "":
+		return nil, errRequired("targethost")
+	case service == "":
+		return nil, errRequired("service")
+	case s.dir.get(typeUser, uid) == nil:
+		return nil, errNotFound(typeUser, uid)
+	}
+
+	var (
+		matched, notMatched []any
+		onlyRules           = toStrings(opts["rules"])
+	)
+
+	for _, rule := range s.dir.list(typeHBACRule) {
+		if len(onlyRules) > 0 && !containsFold(onlyRules, rule.pkey()) {
+			continue
+		}
+		if len(onlyRules) == 0 && rule.first("ipaenabledflag") != "TRUE" {
+			continue
+		}
+
+		if s.dir.ruleMatches(rule, "user", uid) &&
+			s.dir.ruleMatches(rule, "host", host) &&
+			s.dir.ruleMatches(rule, "service", service) {
+			matched = append(matched, rule.pkey())
+		} else {
+			notMatched = append(notMatched, rule.pkey())
+		}
+	}
+
+	isGranted := len(matched) > 0
+	result := map[string]any{
+		"summary": fmt.Sprintf("Access granted: %s", map[bool]string{true: "True", false: "False"}[isGranted]),
+		"value":   isGranted,
+		"warning": nil,
+		"error":   nil,
+	}
+
+	if !isTrue(opts["nodetail"]) {
+		result["matched"] = matched
+		result["notmatched"] = notMatched
+	}
+
+	return result, nil
+}
+
+// ruleMatches подходит ли pkey под участников правила вида suffix: категория all, напрямую или через группы
+// (первый тип участника - сама запись, второй - ее группы: user/group, host/hostgroup, hbacsvc/hbacsvcgroup)
+func (d *directory) ruleMatches(rule *entry, suffix, pkey string) bool {
+	member := rule.typ.ruleMembers[suffix]
+	if strings.EqualFold(rule.first(member.category), "all") {
+		return true
+	}
+
+	memberType, groupType := member.types[0], member.types[1]
+	if containsFold(rule.attrs[member.attr+"_"+memberType], pkey) {
+		return true
+	}
+
+	return slices.ContainsFunc(d.containersOfIndirect(groupType, memberType, pkey), func(g string) bool {
+		return containsFold(rule.attrs[member.attr+"_"+groupType], g)
+	})
+}
+
+func containsFold(vals []string, v string) bool {
+	return slices.ContainsFunc(vals, func(item string) bool { return strings.EqualFold(item, v) })
+}
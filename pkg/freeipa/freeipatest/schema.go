@@ -0,0 +1,120 @@
+package freeipatest
+
+import (
+	"maps"
+	"slices"
+)
+
+// schemaCommand позиционные аргументы (первый обязателен, кроме *_find) и опции команды сверх общих
+type schemaCommand struct {
+	args    []string
+	options []string
+}
+
+var (
+	// schemaCommonOptions опции, которые есть у всех команд
+	schemaCommonOptions = []string{"version"}
+	// schemaEntryOptions опции команд, которые отдают записи
+	schemaEntryOptions = []string{"all", "raw", "no_members"}
+
+	userAttrs = []string{
+		"givenname", "sn", "cn", "displayname", "initials", "mail", "title", "telephonenumber", "mobile",
+		"ou", "o", "loginshell", "homedirectory", "uidnumber", "gidnumber", "krbpasswordexpiration",
+		"ipasshpubkey", "ipauserauthtype", "jpegphoto",
+	}
+	groupAttrs = []string{"description", "gidnumber"}
+
+	// schemaCommands фейк описывает только основные команды, в настоящем IPA их несколько сотен
+	schemaCommands = map[string]schemaCommand{
+		"ping":      {},
+		"user_show": {args: []string{"uid"}, options: slices.Concat(schemaEntryOptions, []string{"rights"})},
+		"user_find": {
+			args: []string{"criteria"},
+			options: slices.Concat(schemaEntryOptions, userAttrs, []string{
+				"uid", "preserved", "sizelimit", "timelimit", "pkey_only",
+				"in_group", "not_in_group", "in_role", "not_in_role",
+			}),
+		},
+		"user_add": {
+			args: []string{"uid"},
+			options: slices.Concat(schemaEntryOptions, userAttrs, []string{
+				"userpassword", "random", "noprivate", "setattr", "addattr",
+			}),
+		},
+		"user_mod": {
+			args: []string{"uid"},
+			options: slices.Concat(schemaEntryOptions, userAttrs, []string{
+				"userpassword", "random", "nsaccountlock", "setattr", "addattr", "delattr", "rights",
+			}),
+		},
+		"user_del":     {args: []string{"uid"}, options: []string{"preserve", "continue"}},
+		"user_enable":  {args: []string{"uid"}},
+		"user_disable": {args: []string{"uid"}},
+		"group_show":   {args: []string{"cn"}, options: slices.Concat(schemaEntryOptions, []string{"rights"})},
+		"group_find": {
+			args: []string{"criteria"},
+			options: slices.Concat(schemaEntryOptions, groupAttrs, []string{
+				"cn", "sizelimit", "timelimit", "pkey_only", "nonposix", "external",
+				"user", "no_user", "in_group", "not_in_group", "in_role", "not_in_role",
+			}),
+		},
+		"group_add": {
+			args:    []string{"cn"},
+			options: slices.Concat(schemaEntryOptions, groupAttrs, []string{"nonposix", "external", "setattr", "addattr"}),
+		},
+		"group_mod": {
+			args:    []string{"cn"},
+			options: slices.Concat(schemaEntryOptions, groupAttrs, []string{"setattr", "addattr", "delattr", "rights"}),
+		},
+		"group_del":           {args: []string{"cn"}, options: []string{"continue"}},
+		"group_add_member":    {args: []string{"cn"}, options: slices.Concat(schemaEntryOptions, []string{"user", "group"})},
+		"group_remove_member": {args: []string{"cn"}, options: slices.Concat(schemaEntryOptions, []string{"user", "group"})},
+		"role_show":           {args: []string{"cn"}, options: slices.Concat(schemaEntryOptions, []string{"rights"})},
+		"role_find": {
+			args:    []string{"criteria"},
+			options: slices.Concat(schemaEntryOptions, []string{"cn", "description", "sizelimit", "timelimit", "pkey_only"}),
+		},
+		"server_find": {
+			args:    []string{"criteria"},
+			options: slices.Concat(schemaEntryOptions, []string{"sizelimit", "timelimit", "pkey_only"}),
+		},
+	}
+)
+
+// cmdSchema описание команд в формате команды schema: params с positional/required
+func cmdSchema() (map[string]any, *rpcError) {
+	commands := make([]any, 0, len(schemaCommands))
+
+	for _, name := range slices.Sorted(maps.Keys(schemaCommands)) {
+		cmd := schemaCommands[name]
+		params := make([]any, 0, len(cmd.args)+len(cmd.options)+len(schemaCommonOptions))
+
+		for i, arg := range cmd.args {
+			params = append(params, map[string]any{
+				"name":       arg,
+				"type":       "str",
+				"positional": true,
+				"required":   i == 0 && arg != "criteria",
+			})
+		}
+
+		for _, opt := range slices.Concat(cmd.options, schemaCommonOptions) {
+			params = append(params, map[string]any{"name": opt, "type": "str"})
+		}
+
+		commands = append(commands, map[string]any{
+			"name":      name,
+			"full_name": name + "/1",
+			"version":   "1",
+			"params":    params,
+		})
+	}
+
+	return map[string]any{
+		"result": map[string]any{
+			"fingerprint": "fake-" + APIVersion,
+			"ttl":         3600, //nolint:mnd // как у IPA
+			"commands":    commands,
+		},
+	}, nil
+}
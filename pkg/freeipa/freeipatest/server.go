@@ -0,0 +1,367 @@
+// Package freeipatest поднимает фейковый IPA-сервер (httptest) с каталогом в памяти.
+// Он понимает /ipa/session/login_password, /ipa/session/change_password
+// и /ipa/session/json для команд, которыми пользуется freeipa.FreeIPA,
+// отдает настоящие коды ошибок IPA и кодировки __datetime__/__base64__,
+// поэтому на нем можно тестировать и сам клиент, и сервисы поверх него без живого IPA.
+package freeipatest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AdminUID      = "admin"
+	AdminsGroup   = "admins"
+	UsersGroup    = "ipausers"
+	Realm         = "EXAMPLE.TEST"
+	Domain        = "example.test"
+	BaseDN        = "dc=example,dc=test"
+	ServerVersion = "4.12.5"
+	APIVersion    = "2.254"
+	sessionCookie = "ipa_session"
+	timeLayout    = "20060102150405Z"
+)
+
+// searchRecordsLimit ipasearchrecordslimit по умолчанию: столько отдает *_find без sizelimit
+const searchRecordsLimit = 100
+
+// Server фейковый IPA. Все методы безопасны для конкурентного использования.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	dir      *directory
+	ca       *certAuthority
+	dns      map[string]*dnsZone // зона с точкой на конце -> зона
+	sessions map[string]string   // token -> uid
+	calls    map[string]int      // method -> кол-во вызовов (batch считается и сам, и по вложенным)
+	servers  []string            // реплики для server_find, пусто - только сам сервер
+	// sizeLimit жесткий лимит выборки *_find (как nsslapd-sizelimit), действует и при sizelimit=0; 0 - нет
+	sizeLimit int
+}
+
+// Scheme схема для freeipa.NewFreeIPA
+func (s *Server) Scheme() string {
+	u, _ := url.Parse(s.URL)
+	return u.Scheme
+}
+
+// Host хост (с портом) для freeipa.NewFreeIPA
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// ExpireSessions сбрасывает все сессии, как будто у них истек срок жизни
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.sessions)
+}
+
+// SetServers реплики топологии, которые отдает server_find как cn. IPA отдает FQDN без порта,
+// но для нескольких тестовых серверов на одном адресе можно передать хост с портом (как у Host).
+func (s *Server) SetServers(hosts ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.servers = slices.Clone(hosts)
+}
+
+// SetSizeLimit жесткий лимит выборки *_find, как у LDAP-сервера: результат больше n отдается с truncated
+// даже при sizelimit=0. 0 - без лимита (по умолчанию), тогда действует только sizelimit (без него - 100).
+func (s *Server) SetSizeLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sizeLimit = n
+}
+
+// Calls сколько раз вызывался jsonRPC-метод, вход по паролю считается как "login"
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method]
+}
+
+// AddUser заводит пользователя напрямую в каталоге (минуя права), attrs дополняют/перекрывают дефолтные.
+// Пароль сразу действующий, срок жизни - 90 дней.
+func (s *Server) AddUser(uid, givenName, sn, password string, attrs map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, rpcErr := s.dir.addUser(uid, givenName, sn, attrs); rpcErr != nil {
+		return rpcErr
+	}
+
+	s.dir.setPassword(uid, password, time.Now().AddDate(0, 0, defaultMaxPwdLife))
+
+	return nil
+}
+
+// SetPassword выставляет пароль и срок его действия (прошедшее время = просроченный пароль)
+func (s *Server) SetPassword(uid, password string, expiration time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir.get(typeUser, uid) == nil {
+		return fmt.Errorf("%s: user not found", uid)
+	}
+
+	s.dir.setPassword(uid, password, expiration)
+
+	return nil
+}
+
+// AddEntry заводит запись любого типа (host, hostgroup, hbacsvc, ...) напрямую в каталоге,
+// attrs - атрибуты в нижнем регистре, первичный ключ обязателен
+func (s *Server) AddEntry(objType string, attrs map[string][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	typ, ok := s.dir.types[objType]
+	if !ok {
+		return fmt.Errorf("unknown object type %s", objType)
+	}
+
+	pkey := ""
+	if v := attrs[typ.pkey]; len(v) > 0 {
+		pkey = v[0]
+	}
+
+	switch {
+	case pkey == "":
+		return fmt.Errorf("%s is required", typ.pkey)
+	case s.dir.get(objType, pkey) != nil:
+		return errDuplicate(objType, pkey)
+	}
+
+	attrs = maps.Clone(attrs)
+	if len(attrs["objectclass"]) == 0 {
+		attrs["objectclass"] = slices.Clone(typ.objectClass)
+	}
+
+	s.dir.put(objType, attrs)
+
+	return nil
+}
+
+// EnrollHost имитирует ipa-client-install: OTP расходуется, у хоста появляется keytab
+func (s *Server) EnrollHost(fqdn string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.dir.get(typeHost, fqdn)
+	if e == nil {
+		return fmt.Errorf("%s: host not found", fqdn)
+	}
+
+	e.attrs["has_keytab"] = []string{"TRUE"}
+	e.attrs["has_password"] = []string{"FALSE"}
+	delete(e.attrs, "userpassword")
+	s.dir.touch(e)
+
+	return nil
+}
+
+// Entry отдает атрибуты записи в том виде, как их вернет сервер на *_show (all=true)
+func (s *Server) Entry(objType, pkey string) (map[string]any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.dir.get(objType, pkey)
+	if e == nil {
+		return nil, false
+	}
+
+	return s.dir.render(e, renderOpts{all: true}), true
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uid, password := r.PostForm.Get("user"), r.PostForm.Get("password")
+
+	s.mu.Lock()
+	s.calls["login"]++
+	reason := s.dir.checkPassword(uid, password)
+	token := ""
+
+	if reason == "" {
+		token = newToken()
+		s.sessions[token] = uid
+	}
+	s.mu.Unlock()
+
+	if reason != "" {
+		w.Header().Set("X-IPA-Rejection-Reason", reason)
+		writeUnauthorized(w)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "MagBearerToken=" + token,
+		Path:     "/ipa",
+		HttpOnly: true,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleChangePassword смена пароля без сессии (в том числе просроченного), результат только в заголовках
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uid := r.PostForm.Get("user")
+	oldPassword, newPassword := r.PostForm.Get("old_password"), r.PostForm.Get("new_password")
+
+	s.mu.Lock()
+	s.calls["change_password"]++
+	result, policyErr := "ok", ""
+
+	e := s.dir.get(typeUser, uid)
+
+	switch {
+	case e == nil, e.isPreserved(), e.first("nsaccountlock") == "TRUE", !s.dir.isPasswordValid(uid, oldPassword):
+		result = "invalid-password"
+	case s.dir.checkPolicy(uid, newPassword) != "":
+		result, policyErr = "policy-error", s.dir.checkPolicy(uid, newPassword)
+	default:
+		s.dir.setPassword(uid, newPassword, s.dir.policyExpiration(uid))
+		s.dir.touch(e)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-IPA-Pwchange-Result", result)
+
+	if policyErr != "" {
+		w.Header().Set("X-IPA-Pwchange-Policy-Error", policyErr)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("<html><head><title>200 Success</title></head><body><h1>" + result + "</h1></body></html>"))
+}
+
+func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request) {
+	caller, ok := s.caller(r)
+	if !ok {
+		writeUnauthorized(w)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req rpcRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, rpcResponse{Error: &rpcError{Code: errCodeJSON, Name: "JSONError", Message: err.Error()}})
+		return
+	}
+
+	s.mu.Lock()
+	result, rpcErr := s.execute(caller, req.Method, req.Params)
+	s.mu.Unlock()
+
+	writeJSON(w, rpcResponse{
+		Result:    result,
+		Error:     rpcErr,
+		ID:        req.ID,
+		Principal: caller + "@" + Realm,
+		Version:   ServerVersion,
+	})
+}
+
+// caller пользователь по cookie сессии
+func (s *Server) caller(r *http.Request) (string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	const prefix = "MagBearerToken="
+
+	if len(c.Value) <= len(prefix) {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uid, ok := s.sessions[c.Value[len(prefix):]]
+
+	return uid, ok
+}
+
+// logoutUser закрывает все сессии пользователя
+func (s *Server) logoutUser(userID string) {
+	for token, uid := range s.sessions {
+		if strings.EqualFold(uid, userID) {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	_, _ = w.Write([]byte("<html><head><title>401 Unauthorized</title></head><body><h1>Unauthorized</h1></body></html>"))
+}
+
+func writeJSON(w http.ResponseWriter, resp rpcResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(resp) //nolint:errchkjson
+}
+
+func newToken() string {
+	b := make([]byte, 16) //nolint:mnd
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// NewServer запускает сервер с администратором AdminUID (группа admins) и паролем adminPassword.
+// Не забыть вызвать Close.
+func NewServer(adminPassword string) *Server {
+	s := &Server{
+		dir:      newDirectory(),
+		ca:       newCertAuthority(),
+		dns:      make(map[string]*dnsZone),
+		sessions: make(map[string]string),
+		calls:    make(map[string]int),
+	}
+
+	s.dir.seed(adminPassword)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ipa/session/login_password", s.handleLogin)
+	mux.HandleFunc("POST /ipa/session/change_password", s.handleChangePassword)
+	mux.HandleFunc("POST /ipa/session/json", s.handleJSON)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
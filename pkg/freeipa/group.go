@@ -0,0 +1,239 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// groups
+
+// GetGroups получение групп, пагинация такая же как у GetUsers.
+// Выборка, обрезанная сервером (лимит LDAP), - ошибка ErrSizeLimitExceeded.
+func (f *FreeIPA) GetGroups(ctx context.Context, limit, offset int32) (int, []Group, uint32, error) {
+	opts := map[string]any{
+		"pkey_only": true,
+		"sizelimit": 0, // без него IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	}
+
+	// список групп отдается в алфавитном порядке по cn
+	statusCode, resp, err := f.sendRPC(ctx, "group_find", "", opts)
+	if err != nil {
+		return statusCode, nil, 0, err
+	}
+	if resp.Result == nil {
+		return 0, nil, 0, errors.New(errMsgResponseResultIsNil)
+	}
+	if resp.Result.Truncated {
+		return 0, nil, 0, newTruncatedError("group_find", resp.Result.Count)
+	}
+
+	groups := make([]Group, 0)
+	total := resp.Result.Count
+
+	if resp.Result.Result != nil {
+		if groups, err = decodeList(resp.Result.Result, groupCodec); err != nil {
+			return 0, nil, 0, err
+		}
+	}
+
+	targetGroups := getRangeFromSlice(groups, limit, offset, limitDefault)
+	methods := make([]string, len(targetGroups))
+	opts = map[string]any{
+		"all": true,
+	}
+
+	for i, group := range targetGroups {
+		method, err := f.rpcReq("group_show", rpcArgs(group.CN), opts, false)
+		if err != nil {
+			return 0, nil, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (group_show): %s", err)
+		}
+
+		methods[i] = string(method)
+	}
+
+	statusCode, resp, err = f.sendRPC(ctx, "batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil)
+	if err != nil {
+		return statusCode, nil, 0, err
+	}
+	if resp.Result == nil {
+		return 0, nil, 0, errors.New(errMsgResponseResultIsNil)
+	}
+
+	groups = make([]Group, 0, len(resp.Result.Results))
+
+	for _, result := range resp.Result.Results {
+		if groupTmp, ok := result.Result.(map[string]any); ok {
+			group, err := decodeEntry(groupTmp, groupCodec)
+			if err != nil {
+				return 0, nil, 0, err
+			}
+
+			groups = append(groups, group)
+		}
+	}
+
+	return statusCode, groups, total, nil
+}
+
+func (f *FreeIPA) GetGroup(ctx context.Context, name string) (int, *Group, error) {
+	opts := map[string]any{
+		"all": true,
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "group_show", rpcArgs(name), opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	groupTmp, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	group, err := decodeEntry(groupTmp, groupCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &group, nil
+}
+
+func (f *FreeIPA) CreateGroup(ctx context.Context, reqGroup RequestGroup) (int, *Group, error) {
+	statusCode, resp, err := f.sendRPC(ctx, "group_add", rpcArgs(reqGroup.CN), reqGroup.toAddOpts())
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	groupTmp, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	group, err := decodeEntry(groupTmp, groupCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &group, nil
+}
+
+// UpdateGroup меняются только описание и gid, тип группы (posix/external) после создания не меняется
+func (f *FreeIPA) UpdateGroup(ctx context.Context, reqGroup RequestGroup) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "group_mod", rpcArgs(reqGroup.CN), reqGroup.toModOpts())
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// toAddOpts опции group_add
+func (r RequestGroup) toAddOpts() map[string]any {
+	opts := r.toModOpts()
+
+	if r.NonPosix != nil {
+		opts[keyOptNonPosix] = *r.NonPosix
+	}
+	if r.External != nil {
+		opts[keyOptExternal] = *r.External
+	}
+
+	return opts
+}
+
+// toModOpts опции group_mod
+func (r RequestGroup) toModOpts() map[string]any {
+	opts := map[string]any{}
+
+	if r.Description != nil {
+		opts[keyOptDescription] = *r.Description
+	}
+	if r.GIDNumber != nil {
+		opts[keyOptGIDNumber] = *r.GIDNumber
+	}
+
+	return opts
+}
+
+func (f *FreeIPA) DeleteGroup(ctx context.Context, name string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "group_del", rpcArgs(name), nil)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// AddGroupMembers добавляет в группу пользователей и/или вложенные группы
+func (f *FreeIPA) AddGroupMembers(ctx context.Context, name string, userIDs, groupNames []string) (int, error) {
+	return f.editGroupMembers(ctx, name, userIDs, groupNames, false)
+}
+
+// RemoveGroupMembers удаляет из группы пользователей и/или вложенные группы
+func (f *FreeIPA) RemoveGroupMembers(ctx context.Context, name string, userIDs, groupNames []string) (int, error) {
+	return f.editGroupMembers(ctx, name, userIDs, groupNames, true)
+}
+
+func (f *FreeIPA) editGroupMembers(
+	ctx context.Context,
+	name string,
+	userIDs, groupNames []string,
+	isRemove bool,
+) (int, error) {
+	members := map[string][]string{
+		keyOptUser:  userIDs,
+		keyOptGroup: groupNames,
+	}
+
+	return f.editMembers(ctx, "group", name, members, isRemove)
+}
+
+// editMembers <objType>_add_member/<objType>_remove_member, members: тип участника -> имена, пустые не передаются
+func (f *FreeIPA) editMembers(
+	ctx context.Context,
+	objType, name string,
+	members map[string][]string,
+	isRemove bool,
+) (int, error) {
+	method := objType + "_add_member"
+
+	if isRemove {
+		method = objType + "_remove_member"
+	}
+
+	return f.sendMembersRPC(ctx, method, name, members)
+}
+
+// sendMembersRPC команды, которые возвращают failed: *_add_member, role_add_privilege, privilege_add_permission, ...
+func (f *FreeIPA) sendMembersRPC(ctx context.Context, method, name string, members map[string][]string) (int, error) {
+	opts := map[string]any{}
+
+	for memberType, names := range members {
+		if len(names) > 0 {
+			opts[memberType] = names
+		}
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, method, rpcArgs(name), opts)
+	if err != nil {
+		return statusCode, err
+	}
+	if resp.Result == nil {
+		return 0, errors.New(errMsgResponseResultIsNil)
+	}
+
+	// сервер отвечает успехом, даже если часть участников не обработана
+	if err = failedMembersError(resp.Result.Failed); err != nil {
+		return 0, fmt.Errorf("failed to %s: %w", method, err)
+	}
+
+	return statusCode, nil
+}
@@ -0,0 +1,177 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+)
+
+// hbac rules
+
+// GetHBACRules все правила HBAC
+func (f *FreeIPA) GetHBACRules(ctx context.Context) (int, []HBACRule, error) {
+	statusCode, entries, err := f.findEntries(ctx, "hbacrule_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	rules, err := decodeEntries(entries, hbacRuleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, rules, nil
+}
+
+func (f *FreeIPA) GetHBACRule(ctx context.Context, name string) (int, *HBACRule, error) {
+	return f.sendHBACRuleRPC(ctx, "hbacrule_show", name, map[string]any{"all": true})
+}
+
+// CreateHBACRule создает включенное правило (allow)
+func (f *FreeIPA) CreateHBACRule(ctx context.Context, reqRule RequestHBACRule) (int, *HBACRule, error) {
+	return f.sendHBACRuleRPC(ctx, "hbacrule_add", reqRule.CN, reqRule.toOpts())
+}
+
+// UpdateHBACRule описание и категории. Категорию "all" нельзя выставить, пока есть участники (ErrMutuallyExclusive).
+func (f *FreeIPA) UpdateHBACRule(ctx context.Context, reqRule RequestHBACRule) (int, *HBACRule, error) {
+	return f.sendHBACRuleRPC(ctx, "hbacrule_mod", reqRule.CN, reqRule.toOpts())
+}
+
+func (f *FreeIPA) DeleteHBACRule(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "hbacrule_del", name)
+}
+
+func (f *FreeIPA) EnableHBACRule(ctx context.Context, name string) (int, error) {
+	return f.toggleRule(ctx, "hbacrule", name, false)
+}
+
+func (f *FreeIPA) DisableHBACRule(ctx context.Context, name string) (int, error) {
+	return f.toggleRule(ctx, "hbacrule", name, true)
+}
+
+// AddHBACRuleMembers добавляет пользователей/группы, хосты/группы хостов и сервисы/группы сервисов
+func (f *FreeIPA) AddHBACRuleMembers(ctx context.Context, name string, members RuleMembers) (int, error) {
+	return f.editRuleMembers(ctx, "hbacrule", name, members.hbacCalls(), false)
+}
+
+func (f *FreeIPA) RemoveHBACRuleMembers(ctx context.Context, name string, members RuleMembers) (int, error) {
+	return f.editRuleMembers(ctx, "hbacrule", name, members.hbacCalls(), true)
+}
+
+// HBACTest разрешит ли IPA пользователю доступ к сервису на хосте по включенным правилам
+func (f *FreeIPA) HBACTest(ctx context.Context, userID, host, service string) (int, *HBACTestResult, error) {
+	opts := map[string]any{
+		keyOptUser:   userID,
+		"targethost": host,
+		"service":    service,
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "hbactest", "", opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	isGranted, ok := resp.Result.Value.(bool)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	return statusCode, &HBACTestResult{
+		Granted:    isGranted,
+		Matched:    resp.Result.Matched,
+		NotMatched: resp.Result.NotMatched,
+	}, nil
+}
+
+func (f *FreeIPA) sendHBACRuleRPC(
+	ctx context.Context,
+	method, name string,
+	opts map[string]any,
+) (int, *HBACRule, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	rule, err := decodeEntry(entry, hbacRuleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &rule, nil
+}
+
+// hbac services
+
+func (f *FreeIPA) GetHBACServices(ctx context.Context) (int, []HBACService, error) {
+	statusCode, entries, err := f.findEntries(ctx, "hbacsvc_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	services, err := decodeEntries(entries, hbacServiceCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, services, nil
+}
+
+func (f *FreeIPA) GetHBACService(ctx context.Context, name string) (int, *HBACService, error) {
+	return f.sendHBACServiceRPC(ctx, "hbacsvc_show", name, map[string]any{"all": true})
+}
+
+// CreateHBACService имя сервиса - имя PAM-сервиса (sshd, login, ...)
+func (f *FreeIPA) CreateHBACService(ctx context.Context, name string, desc *string) (int, *HBACService, error) {
+	opts := map[string]any{}
+
+	if desc != nil {
+		opts[keyOptDescription] = *desc
+	}
+
+	return f.sendHBACServiceRPC(ctx, "hbacsvc_add", name, opts)
+}
+
+func (f *FreeIPA) UpdateHBACService(ctx context.Context, name, desc string) (int, *HBACService, error) {
+	opts := map[string]any{
+		keyOptDescription: desc,
+	}
+
+	return f.sendHBACServiceRPC(ctx, "hbacsvc_mod", name, opts)
+}
+
+func (f *FreeIPA) DeleteHBACService(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "hbacsvc_del", name)
+}
+
+func (f *FreeIPA) sendHBACServiceRPC(
+	ctx context.Context,
+	method, name string,
+	opts map[string]any,
+) (int, *HBACService, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	service, err := decodeEntry(entry, hbacServiceCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &service, nil
+}
+
+// toOpts опции hbacrule_add/hbacrule_mod
+func (r RequestHBACRule) toOpts() map[string]any {
+	opts := map[string]any{}
+
+	putOpt(opts, keyOptDescription, r.Description)
+	putOpt(opts, "usercategory", r.UserCategory)
+	putOpt(opts, "hostcategory", r.HostCategory)
+	putOpt(opts, "servicecategory", r.ServiceCategory)
+
+	return opts
+}
@@ -1,24 +1,15 @@
 package freeipa
 
 import (
+	"cmp"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"maps"
 	"slices"
+	"strings"
 )
 
-func isBool(v any) bool {
-	return reflect.TypeOf(v).Kind() == reflect.Bool
-}
-
-func isNotEmptySlice(v any) bool {
-	if reflect.TypeOf(v).Kind() == reflect.Slice {
-		if sl, ok := v.([]any); ok {
-			return len(sl) > 0
-		}
-	}
-	return false
-}
-
 func convertSliceAnyToSliceStr(vSrc []any) []string {
 	result := make([]string, len(vSrc))
 	for i, v := range vSrc {
@@ -50,3 +41,96 @@ func getRangeFromSlice[T any](s []T, limitSrc, offsetSrc, defaultLimit int32) []
 
 	return result
 }
+
+// rpcArgs формирует позиционные аргументы jsonRPC-запроса, значения экранируются маршалингом
+func rpcArgs(values ...string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(values) //nolint:errchkjson // срез строк маршалится всегда
+
+	return string(b)
+}
+
+// failedMembersError собирает ошибку по участникам, которых сервер не смог добавить/удалить.
+// IPA в этом случае отвечает 200 без error, а подробности кладет в result.failed:
+// {"member": {"user": [["uid", "no such entry"]], "group": []}}
+func failedMembersError(failed map[string]map[string][]any) error {
+	var errs []error
+
+	for _, attr := range slices.Sorted(maps.Keys(failed)) {
+		kinds := failed[attr]
+
+		for _, kind := range slices.Sorted(maps.Keys(kinds)) {
+			for _, item := range kinds[kind] {
+				name, reason := parseFailedMember(item)
+				errs = append(errs, fmt.Errorf("%s %s: %s", kind, name, reason))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// failedMemberReasons причины отказа по участникам вида kind (user, group, ...): имя в нижнем регистре -> причина
+func failedMemberReasons(failed map[string]map[string][]any, kind string) map[string]string {
+	reasons := map[string]string{}
+
+	for _, kinds := range failed {
+		for _, item := range kinds[kind] {
+			name, reason := parseFailedMember(item)
+			reasons[strings.ToLower(name)] = reason
+		}
+	}
+
+	return reasons
+}
+
+// parseFailedMember элемент failed приходит парой [имя, причина], но на всякий случай поддержим и строку
+func parseFailedMember(item any) (string, string) {
+	switch v := item.(type) {
+	case []any:
+		strSlice := convertSliceAnyToSliceStr(v)
+		switch len(strSlice) {
+		case 0:
+			return "", ""
+		case 1:
+			return strSlice[0], ""
+		default:
+			return strSlice[0], strSlice[1]
+		}
+	default:
+		return fmt.Sprint(v), ""
+	}
+}
+
+// sortUsers устойчивая сортировка, при равенстве поля порядок определяет uid
+func sortUsers(users []User, sortBy UserSortField, isDesc bool) {
+	field := func(u User) string {
+		switch sortBy {
+		case UserSortByGivenName:
+			return u.GivenName
+		case UserSortBySN:
+			return u.SN
+		case UserSortByMail:
+			return u.Mail
+		case UserSortByUID:
+			return u.UID
+		default:
+			return u.UID
+		}
+	}
+
+	slices.SortStableFunc(users, func(a, b User) int {
+		result := cmp.Or(
+			strings.Compare(strings.ToLower(field(a)), strings.ToLower(field(b))),
+			strings.Compare(a.UID, b.UID),
+		)
+		if isDesc {
+			return -result
+		}
+
+		return result
+	})
+}
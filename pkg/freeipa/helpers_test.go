@@ -95,3 +95,28 @@ func TestGetRangeFromSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestFailedMembersError(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, failedMembersError(nil))
+	require.NoError(t, failedMembersError(map[string]map[string][]any{
+		"member": {"user": {}, "group": {}},
+	}))
+
+	err := failedMembersError(map[string]map[string][]any{
+		"member": {
+			"user":  {[]any{"bob", "This entry is already a member"}},
+			"group": {[]any{"devs", "no such entry"}},
+		},
+	})
+	require.EqualError(t, err, "group devs: no such entry\nuser bob: This entry is already a member")
+}
+
+func TestRPCArgs(t *testing.T) {
+	t.Parallel()
+
+	require.Empty(t, rpcArgs())
+	require.JSONEq(t, `["admin"]`, rpcArgs("admin"))
+	require.JSONEq(t, `["a\"b"]`, rpcArgs(`a"b`))
+}
@@ -0,0 +1,173 @@
+package freeipa
+
+import (
+	"context"
+)
+
+// hosts
+
+// GetHosts хосты, criteria - подстрока для поиска по fqdn/описанию (пустая - все)
+func (f *FreeIPA) GetHosts(ctx context.Context, criteria string) (int, []Host, error) {
+	statusCode, entries, err := f.findEntries(ctx, "host_find", criteria)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	hosts, err := decodeEntries(entries, hostCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, hosts, nil
+}
+
+func (f *FreeIPA) GetHost(ctx context.Context, fqdn string) (int, *Host, error) {
+	return f.sendHostRPC(ctx, "host_show", fqdn, map[string]any{"all": true})
+}
+
+// CreateHost заводит хост под регистрацию. С Random (или OTP) в ответе будет Host.OTP,
+// который передается в ipa-client-install --password. Без Force или IPAddress хост должен резолвиться в DNS.
+func (f *FreeIPA) CreateHost(ctx context.Context, reqHost RequestHost) (int, *Host, error) {
+	return f.sendHostRPC(ctx, "host_add", reqHost.FQDN, reqHost.toOpts(true))
+}
+
+// UpdateHost с Random выдает новый одноразовый пароль (например, для повторной регистрации после DisableHost)
+func (f *FreeIPA) UpdateHost(ctx context.Context, reqHost RequestHost) (int, *Host, error) {
+	return f.sendHostRPC(ctx, "host_mod", reqHost.FQDN, reqHost.toOpts(false))
+}
+
+func (f *FreeIPA) DeleteHost(ctx context.Context, fqdn string) (int, error) {
+	return f.deleteEntry(ctx, "host_del", fqdn)
+}
+
+// DisableHost отзывает keytab и сертификаты хоста, запись остается
+func (f *FreeIPA) DisableHost(ctx context.Context, fqdn string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "host_disable", rpcArgs(fqdn), nil)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// toOpts опции для host_add/host_mod, isAdd - с опциями, которые есть только у host_add
+func (r RequestHost) toOpts(isAdd bool) map[string]any {
+	opts := map[string]any{}
+
+	putOpt(opts, keyOptDescription, r.Description)
+	putOpt(opts, "l", r.Locality)
+	putOpt(opts, "nshostlocation", r.Location)
+	putOpt(opts, "nshardwareplatform", r.Platform)
+	putOpt(opts, "nsosversion", r.OS)
+
+	if r.OTP != nil {
+		opts[keyOptUserPassword] = *r.OTP
+	} else if r.Random {
+		opts[keyOptRandom] = true
+	}
+
+	if isAdd {
+		if r.IPAddress != nil {
+			opts["ip_address"] = *r.IPAddress
+		}
+		if r.Force {
+			opts["force"] = true
+		}
+	}
+
+	return opts
+}
+
+func (f *FreeIPA) sendHostRPC(ctx context.Context, method, fqdn string, opts map[string]any) (int, *Host, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, fqdn, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	host, err := decodeEntry(entry, hostCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &host, nil
+}
+
+// host groups
+
+func (f *FreeIPA) GetHostGroups(ctx context.Context) (int, []HostGroup, error) {
+	statusCode, entries, err := f.findEntries(ctx, "hostgroup_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	groups, err := decodeEntries(entries, hostGroupCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, groups, nil
+}
+
+func (f *FreeIPA) GetHostGroup(ctx context.Context, name string) (int, *HostGroup, error) {
+	return f.sendHostGroupRPC(ctx, "hostgroup_show", name, map[string]any{"all": true})
+}
+
+func (f *FreeIPA) CreateHostGroup(ctx context.Context, name string, desc *string) (int, *HostGroup, error) {
+	opts := map[string]any{}
+
+	if desc != nil {
+		opts[keyOptDescription] = *desc
+	}
+
+	return f.sendHostGroupRPC(ctx, "hostgroup_add", name, opts)
+}
+
+func (f *FreeIPA) UpdateHostGroup(ctx context.Context, name, desc string) (int, *HostGroup, error) {
+	opts := map[string]any{
+		keyOptDescription: desc,
+	}
+
+	return f.sendHostGroupRPC(ctx, "hostgroup_mod", name, opts)
+}
+
+func (f *FreeIPA) DeleteHostGroup(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "hostgroup_del", name)
+}
+
+// AddHostGroupMembers добавляет в группу хосты и/или вложенные группы хостов
+func (f *FreeIPA) AddHostGroupMembers(ctx context.Context, name string, hosts, hostGroups []string) (int, error) {
+	members := map[string][]string{
+		keyOptHost:      hosts,
+		keyOptHostGroup: hostGroups,
+	}
+
+	return f.editMembers(ctx, "hostgroup", name, members, false)
+}
+
+// RemoveHostGroupMembers удаляет из группы хосты и/или вложенные группы хостов
+func (f *FreeIPA) RemoveHostGroupMembers(ctx context.Context, name string, hosts, hostGroups []string) (int, error) {
+	members := map[string][]string{
+		keyOptHost:      hosts,
+		keyOptHostGroup: hostGroups,
+	}
+
+	return f.editMembers(ctx, "hostgroup", name, members, true)
+}
+
+func (f *FreeIPA) sendHostGroupRPC(
+	ctx context.Context,
+	method, name string,
+	opts map[string]any,
+) (int, *HostGroup, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	group, err := decodeEntry(entry, hostGroupCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &group, nil
+}
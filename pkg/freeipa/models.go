@@ -1,6 +1,10 @@
 package freeipa
 
-import "time"
+import (
+	"crypto/x509"
+	"math/big"
+	"time"
+)
 
 type config struct {
 	Scheme   string `json:"scheme"`
@@ -18,10 +22,10 @@ type responseBasic struct {
 }
 
 type responseError struct {
-	Code    int               `json:"code"`
-	Message string            `json:"message"`
-	Data    map[string]string `json:"data"`
-	Name    string            `json:"name"`
+	Code    int            `json:"code"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data"`
+	Name    string         `json:"name"`
 }
 
 type responseResult struct {
@@ -31,6 +35,13 @@ type responseResult struct {
 	Count     uint32            `json:"count"`
 	Truncated bool              `json:"truncated"` // пусть будет на всякий случай
 	Summary   string            `json:"summary"`   // пусть будет на всякий случай
+	// Failed участники, которых не удалось добавить/удалить (*_add_member, *_remove_member)
+	Failed    map[string]map[string][]any `json:"failed"`
+	Completed int                         `json:"completed"`
+	// hbactest: решение и правила
+	Value      any      `json:"value"`
+	Matched    []string `json:"matched"`
+	NotMatched []string `json:"notmatched"`
 }
 
 type responseMessage struct {
@@ -48,41 +59,285 @@ type responseItem struct {
 	Value   string  `json:"value"` // uid
 	Summary *string `json:"summary"`
 	// Error   *responseError `json:"error"`
-	Error     string `json:"error"`
-	ErrorCode int32  `json:"error_code"`
-	ErrorName string `json:"error_name"`
-	ErrorKw   struct {
-		Reason string `json:"reason"`
-	} `json:"error_kw"`
+	Error     string         `json:"error"`
+	ErrorCode int32          `json:"error_code"`
+	ErrorName string         `json:"error_name"`
+	ErrorKw   map[string]any `json:"error_kw"`
+	// Failed участники, которых не удалось добавить/удалить (*_add_member, hbacrule_add_user, ...)
+	Failed map[string]map[string][]any `json:"failed"`
 }
 
 type Role struct {
-	CN          string
-	DN          string
-	Description string
-	ObjectClass []string
-	MemberUser  []string
+	CN              string
+	DN              string
+	Description     string
+	ObjectClass     []string
+	MemberUser      []string
+	MemberGroup     []string
+	MemberHost      []string
+	MemberHostGroup []string
+	MemberService   []string // principal-ы сервисов (HTTP/web.example.test@EXAMPLE.TEST)
+	// привилегии роли, права на объекты - через их разрешения (Privilege.Permissions)
+	Privileges []string
+}
+
+// RoleMembers участники роли, пустые списки не передаются
+type RoleMembers struct {
+	Users      []string
+	Groups     []string
+	Hosts      []string
+	HostGroups []string
+	Services   []string
 }
 
 type User struct {
-	UID                   string
-	GivenName             string // имя
-	SN                    string // фамилия
-	DN                    string
-	MemberOfGroup         []string
-	MemberOfRole          []string
+	UID           string
+	GivenName     string // имя
+	SN            string // фамилия
+	DN            string
+	MemberOfGroup []string
+	MemberOfRole  []string
+	// группы, в которые пользователь входит через вложенные группы
+	MemberOfIndirectGroup []string
+	MemberOfIndirectRole  []string // роли, выданные группам пользователя
 	Mail                  string
 	NsAccountLock         bool
 	KRBPasswordExpiration time.Time
-	CN                    string // ФИО
-	TelephoneNumber       string // рабочий телефон
-	Mobile                string // мобильный телефон
-	Title                 string // должность
-	Organization          string // компания
-	OrgUnit               string // отдел в компании
-	JPEGPhoto             string // аватарка
+	CN                    string   // ФИО
+	TelephoneNumber       string   // рабочий телефон
+	Mobile                string   // мобильный телефон
+	Title                 string   // должность
+	Organization          string   // компания
+	OrgUnit               string   // отдел в компании
+	JPEGPhoto             string   // аватарка
+	Preserved             bool     // удален с сохранением (см. WithPreserve)
+	Staged                bool     // stage-пользователь, еще не активирован
+	SSHPublicKeys         []string // в формате authorized_keys
+	// "SHA256:... comment (ssh-ed25519)", по одному на ключ
+	SSHKeyFingerprints []string
+	Certificates       [][]byte // сертификаты пользователя в DER
+	AuthTypes          []string // пусто - глобальные настройки IPA
+	// прочие атрибуты записи, в т.ч. заданные через AddAttr
+	Attrs map[string][]string
+}
+
+type Group struct {
+	CN                 string
+	DN                 string
+	Description        string
+	GIDNumber          int // 0 у non-posix и внешних групп
+	ObjectClass        []string
+	MemberUser         []string
+	MemberGroup        []string // вложенные группы
+	MemberOfGroup      []string // группы, в которые входит данная
+	MemberIndirectUser []string // пользователи из вложенных групп
+}
+
+type RequestGroup struct {
+	CN          string  // имя группы
+	Description *string // описание
+	GIDNumber   *int    // задать gid явно (только при создании/для posix)
+	NonPosix    *bool   // создать non-posix группу (только при создании)
+	External    *bool   // группа для внешних (AD) участников (только при создании)
+}
+
+// PasswordPolicy политика паролей: глобальная (Group == GlobalPasswordPolicy) или на группу
+type PasswordPolicy struct {
+	Group           string // группа, к которой применяется политика
+	MaxLife         int    // максимальный срок жизни пароля, в днях
+	MinLife         int    // минимальный срок жизни пароля, в часах
+	MinLength       int    // минимальная длина пароля
+	MinClasses      int    // минимальное кол-во классов символов
+	History         int    // сколько прошлых паролей нельзя повторять
+	MaxFail         int    // кол-во неудачных попыток до блокировки
+	FailureInterval int    // период сброса счетчика неудачных попыток, в секундах
+	LockoutTime     int    // длительность блокировки, в секундах
+	// приоритет (меньше - важнее), у глобальной политики отсутствует
+	Priority *int
+}
+
+// RequestPasswordPolicy nil поля не меняются. Пустой Group - глобальная политика (только изменение).
+type RequestPasswordPolicy struct {
+	Group           string
+	MaxLife         *int
+	MinLife         *int
+	MinLength       *int
+	MinClasses      *int
+	History         *int
+	MaxFail         *int
+	FailureInterval *int
+	LockoutTime     *int
+	Priority        *int // обязателен при создании групповой политики
+}
+
+// HBACRule правило доступа к хостам. Категория "all" означает всех (пользователей, хосты, сервисы),
+// при ней соответствующие участники не задаются.
+type HBACRule struct {
+	CN                 string
+	Description        string
+	Enabled            bool
+	UserCategory       string
+	HostCategory       string
+	ServiceCategory    string
+	MemberUser         []string
+	MemberGroup        []string
+	MemberHost         []string
+	MemberHostGroup    []string
+	MemberService      []string // hbacsvc
+	MemberServiceGroup []string // hbacsvcgroup
+}
+
+// RequestHBACRule nil поля не меняются, пустая категория сбрасывает "all"
+type RequestHBACRule struct {
+	CN              string
+	Description     *string
+	UserCategory    *string
+	HostCategory    *string
+	ServiceCategory *string
+}
+
+// HBACService сервис (sshd, login, ...), на который выдается доступ правилом HBAC
+type HBACService struct {
+	CN            string
+	Description   string
+	MemberOfGroup []string // hbacsvcgroup
+}
+
+// HBACTestResult результат hbactest: разрешен ли доступ и какие из правил сработали
+type HBACTestResult struct {
+	Granted    bool
+	Matched    []string
+	NotMatched []string
+}
+
+// SudoRule правило sudo, категории как у HBACRule
+type SudoRule struct {
+	CN                 string
+	Description        string
+	Enabled            bool
+	Order              int // 0 если не задан
+	UserCategory       string
+	HostCategory       string
+	CmdCategory        string
+	RunAsUserCategory  string
+	RunAsGroupCategory string
+	MemberUser         []string
+	MemberGroup        []string
+	MemberHost         []string
+	MemberHostGroup    []string
+	AllowCommand       []string
+	AllowCommandGroup  []string
+	DenyCommand        []string
+	DenyCommandGroup   []string
+	RunAsUser          []string
+	RunAsUserGroup     []string // группы, от пользователей которых можно выполнять
+	RunAsGroup         []string
+	Options            []string // например "!authenticate"
+}
+
+// RequestSudoRule nil поля не меняются, пустая категория сбрасывает "all"
+type RequestSudoRule struct {
+	CN                 string
+	Description        *string
+	Order              *int
+	UserCategory       *string
+	HostCategory       *string
+	CmdCategory        *string
+	RunAsUserCategory  *string
+	RunAsGroupCategory *string
+}
+
+// SudoCommand команда, которую можно разрешить или запретить в правиле sudo
+type SudoCommand struct {
+	Command       string
+	Description   string
+	MemberOfGroup []string // sudocmdgroup
+}
+
+// RuleMembers участники правил HBAC и sudo, пустые поля пропускаются
+type RuleMembers struct {
+	Users              []string
+	Groups             []string
+	Hosts              []string
+	HostGroups         []string
+	Services           []string // только HBAC
+	ServiceGroups      []string // только HBAC
+	AllowCommands      []string // только sudo
+	AllowCommandGroups []string // только sudo
+	DenyCommands       []string // только sudo
+	DenyCommandGroups  []string // только sudo
+	RunAsUsers         []string // только sudo
+	RunAsUserGroups    []string // только sudo
+	RunAsGroups        []string // только sudo
+}
+
+// Host зарегистрированная (или заведенная под регистрацию) машина
+type Host struct {
+	FQDN              string
+	Description       string
+	Locality          string
+	Location          string
+	Platform          string
+	OS                string
+	HasKeytab         bool     // хост зарегистрирован (ipa-client-install выполнен)
+	HasPassword       bool     // выдан одноразовый пароль, но еще не использован
+	ManagedBy         []string // хосты, которые могут управлять этим (managedby_host)
+	MemberOfHostGroup []string
+	// одноразовый пароль регистрации, только в ответе на создание/изменение с Random
+	OTP string
 }
 
+// RequestHost nil поля не меняются, пустая строка очищает поле
+type RequestHost struct {
+	FQDN        string
+	Description *string
+	Locality    *string
+	Location    *string
+	Platform    *string
+	OS          *string
+	IPAddress   *string // заодно завести A/AAAA-запись в DNS (только при создании)
+	Force       bool    // не проверять наличие хоста в DNS (только при создании)
+	Random      bool    // сгенерировать одноразовый пароль для ipa-client-install
+	OTP         *string // задать одноразовый пароль явно
+}
+
+type HostGroup struct {
+	CN                string
+	Description       string
+	MemberHost        []string
+	MemberHostGroup   []string // вложенные группы хостов
+	MemberOfHostGroup []string // группы хостов, в которые входит данная
+}
+
+type UserSortField string
+
+const (
+	UserSortByUID       UserSortField = "uid"
+	UserSortByGivenName UserSortField = "givenname"
+	UserSortBySN        UserSortField = "sn"
+	UserSortByMail      UserSortField = "mail"
+)
+
+// UserQuery фильтр для FindUsers, пустые поля не участвуют в поиске
+type UserQuery struct {
+	Criteria   string        // свободный текст (ищется по uid, имени, фамилии, почте)
+	UID        *string       // точное совпадение
+	Mail       *string       // точное совпадение
+	GivenName  *string       // точное совпадение
+	SN         *string       // точное совпадение
+	InGroup    []string      // входит во все группы (с учетом вложенности)
+	NotInGroup []string      // не входит ни в одну из групп
+	InRole     []string      // имеет роли
+	Disabled   *bool         // заблокирован ли аккаунт
+	Preserved  *bool         // true - искать только среди удаленных с сохранением
+	SizeLimit  int           // ограничение выборки на сервере (0 - без ограничения)
+	SortBy     UserSortField // по умолчанию uid
+	SortDesc   bool
+}
+
+// RequestUser nil-поля не меняются, указатель на пустую строку при обновлении очищает атрибут.
+// Операции над атрибутами в формате "attr=value": SetAttr заменяет все значения атрибута,
+// AddAttr добавляет значение, DelAttr удаляет (только при обновлении).
 type RequestUser struct {
 	UID                   string     // id
 	GivenName             string     // имя
@@ -97,4 +352,390 @@ type RequestUser struct {
 	Title                 *string    // должность
 	OU                    *string    // отдел (orgunit)
 	AddAttr               []string   // доп. аттрибуты (компания, аватарка)
+	SetAttr               []string
+	DelAttr               []string
+	ClearAttr             []string // имена атрибутов, которые нужно очистить (setattr "attr=")
+}
+
+// Privilege набор разрешений, который выдается ролям
+type Privilege struct {
+	CN          string
+	Description string
+	Permissions []string
+	Roles       []string // роли, у которых есть привилегия
+}
+
+// Permission право на операции с объектами каталога
+type Permission struct {
+	CN     string
+	Rights []string // read, search, compare, write, add, delete, all
+	Type   string   // тип объекта: user, group, host, ...
+	Attrs  []string // атрибуты, на которые действует право
+	// permission (через привилегии), all (любой аутентифицированный), anonymous
+	BindType     string
+	TargetFilter []string // дополнительные LDAP-фильтры
+	Privileges   []string
+	Roles        []string // роли, получившие разрешение через привилегии (memberindirect_role)
+}
+
+// RequestPermission nil-поля не меняются
+type RequestPermission struct {
+	CN           string
+	Rights       []string
+	Type         *string
+	Attrs        []string
+	BindType     *string
+	TargetFilter []string
+}
+
+// EffectiveAccess действующие права пользователя с учетом вложенных групп
+type EffectiveAccess struct {
+	UID         string
+	Roles       []string
+	Privileges  []string
+	Permissions []string
+}
+
+// Certificate сертификат из cert_find/cert_show
+type Certificate struct {
+	SerialNumber     *big.Int
+	Subject          string
+	Issuer           string
+	Status           string // VALID, REVOKED, ...
+	Revoked          bool
+	RevocationReason *RevocationReason // только у отозванных
+	Owners           []string          // владельцы: uid, fqdn хоста или principal сервиса
+	X509             *x509.Certificate
+}
+
+// RevocationReason причина отзыва по RFC 5280
+type RevocationReason int
+
+const (
+	RevocationUnspecified          RevocationReason = 0
+	RevocationKeyCompromise        RevocationReason = 1
+	RevocationCACompromise         RevocationReason = 2
+	RevocationAffiliationChanged   RevocationReason = 3
+	RevocationSuperseded           RevocationReason = 4
+	RevocationCessationOfOperation RevocationReason = 5
+	RevocationCertificateHold      RevocationReason = 6
+	RevocationPrivilegeWithdrawn   RevocationReason = 9
+	RevocationAACompromise         RevocationReason = 10
+)
+
+// CertificateFilter фильтр cert_find, пустые поля не учитываются
+type CertificateFilter struct {
+	Subject          string   // подстрока CN
+	Users            []string // владельцы-пользователи
+	Hosts            []string // владельцы-хосты (fqdn)
+	Services         []string // владельцы-сервисы (principal)
+	RevocationReason *RevocationReason
+	ExpiresBefore    *time.Time // срок действия заканчивается не позже
+}
+
+// DNSZone зона DNS, имя абсолютное (с точкой на конце)
+type DNSZone struct {
+	Name           string
+	Active         bool
+	SOAMName       string // первичный NS
+	SOARName       string // почта администратора в формате DNS (hostmaster.example.test.)
+	SOASerial      int
+	SOARefresh     int
+	SOARetry       int
+	SOAExpire      int
+	SOAMinimum     int
+	TTL            int // 0 - по умолчанию
+	NameServers    []string
+	AllowDynUpdate bool
+}
+
+// RequestDNSZone nil-поля не меняются
+type RequestDNSZone struct {
+	Name           string
+	SOAMName       *string
+	SOARName       *string
+	SOARefresh     *int
+	SOARetry       *int
+	SOAExpire      *int
+	SOAMinimum     *int
+	TTL            *int
+	AllowDynUpdate *bool
+	Force          bool // только при создании: не проверять, что SOAMName резолвится
+}
+
+// DNSRecord записи одного имени в зоне, Name относительное ("www", "_ldap._tcp", "@" - вершина зоны).
+// Для AddDNSRecord/RemoveDNSRecord поля - добавляемые/удаляемые значения.
+type DNSRecord struct {
+	Name  string
+	TTL   int // 0 - TTL зоны
+	A     []string
+	AAAA  []string
+	CNAME []string // не больше одного значения и без других записей
+	PTR   []string
+	SRV   []SRVRecord
+	TXT   []string
+}
+
+// SRVRecord "priority weight port target"
+type SRVRecord struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// OTPTokenType тип OTP-токена
+type OTPTokenType string
+
+const (
+	OTPTokenTOTP OTPTokenType = "totp" // по времени (Google Authenticator, FreeOTP)
+	OTPTokenHOTP OTPTokenType = "hotp" // по счетчику
+)
+
+// OTPToken токен второго фактора. URI (otpauth://...) заполняется только при создании.
+type OTPToken struct {
+	ID          string
+	Type        OTPTokenType
+	Owner       string
+	Description string
+	Vendor      string
+	Algorithm   string // sha1, sha256, sha384, sha512
+	Digits      int    // 6 или 8
+	TimeStep    int    // период TOTP, в секундах
+	Disabled    bool
+	URI         string // для QR-кода, больше нигде IPA его не отдает
+}
+
+// RequestOTPToken пустой ID сгенерирует IPA, пустой Owner - вызывающий пользователь
+type RequestOTPToken struct {
+	ID          string
+	Type        OTPTokenType // по умолчанию TOTP
+	Owner       string
+	Description *string
+	Vendor      *string
+	Algorithm   *string
+	Digits      *int
+	TimeStep    *int
+}
+
+// UserAuthType способ аутентификации пользователя (ipauserauthtype)
+type UserAuthType string
+
+const (
+	UserAuthPassword UserAuthType = "password"
+	UserAuthOTP      UserAuthType = "otp" // пароль + OTP
+	UserAuthRADIUS   UserAuthType = "radius"
+	UserAuthPKINIT   UserAuthType = "pkinit"
+	UserAuthHardened UserAuthType = "hardened"
+	UserAuthIdP      UserAuthType = "idp"
+)
+
+// Schema команды сервера и их параметры (команда schema), см. FreeIPA.Schema
+type Schema struct {
+	Fingerprint string
+	Commands    map[string]SchemaCommand // имя команды -> описание
+}
+
+type SchemaCommand struct {
+	Name    string
+	Args    []SchemaParam // позиционные аргументы по порядку
+	Options []SchemaParam
+}
+
+type SchemaParam struct {
+	Name       string
+	Type       string // str, int, bool, datetime, ...
+	Required   bool
+	Multivalue bool
+}
+
+// DesiredState желаемое состояние каталога, см. FreeIPA.Reconcile
+type DesiredState struct {
+	Users  []RequestUser  // пароль задается только при создании
+	Groups []DesiredGroup // группы, которых нет в списке, не трогаются
+	// роль -> uid прямых участников-пользователей, лишние удаляются. Роли должны существовать.
+	Roles map[string][]string
+	// отключить активных пользователей, которых нет в Users (кроме Protected)
+	DisableMissing bool
+	Protected      []string // uid, которые никогда не отключаются (admin, сервисные учетки)
+}
+
+// DesiredGroup группа и ее прямые участники-пользователи, nil Users - состав не меняется
+type DesiredGroup struct {
+	RequestGroup
+	Users []string
+}
+
+// ReconcileActionKind тип шага плана
+type ReconcileActionKind string
+
+const (
+	ReconcileCreateUser         ReconcileActionKind = "create_user"
+	ReconcileUpdateUser         ReconcileActionKind = "update_user"
+	ReconcileDisableUser        ReconcileActionKind = "disable_user"
+	ReconcileCreateGroup        ReconcileActionKind = "create_group"
+	ReconcileUpdateGroup        ReconcileActionKind = "update_group"
+	ReconcileAddGroupMembers    ReconcileActionKind = "add_group_members"
+	ReconcileRemoveGroupMembers ReconcileActionKind = "remove_group_members"
+	ReconcileAddRoleMembers     ReconcileActionKind = "add_role_members"
+	ReconcileRemoveRoleMembers  ReconcileActionKind = "remove_role_members"
+	ReconcileCreateRole         ReconcileActionKind = "create_role" // только при загрузке ролей (ImportRoles)
+	ReconcileUpdateRole         ReconcileActionKind = "update_role"
+)
+
+// ReconcileAction шаг плана: одна команда IPA
+type ReconcileAction struct {
+	Kind    ReconcileActionKind
+	Target  string   // uid, группа или роль
+	Members []string // пользователи для *_members
+	Fields  []string // изменяемые опции для create/update, по алфавиту
+	method  string
+	opts    map[string]any
+}
+
+// ReconcilePlan шаги в порядке выполнения: сначала создание, затем все остальное
+type ReconcilePlan struct {
+	Actions []ReconcileAction
+}
+
+// ReconcileResult результат шага, Err - ошибка элемента batch-а или не обработанные участники
+type ReconcileResult struct {
+	Action ReconcileAction
+	Err    error
+}
+
+// ReconcileOptions BatchSize <= 0 - reconcileBatchSizeDefault
+type ReconcileOptions struct {
+	DryRun    bool // только план, без изменений
+	BatchSize int  // кол-во команд в одном batch-е
+}
+
+// MemberOutcome итог изменения членства для одного участника
+type MemberOutcome string
+
+const (
+	MemberAdded     MemberOutcome = "added"
+	MemberRemoved   MemberOutcome = "removed"
+	MemberUnchanged MemberOutcome = "unchanged" // уже был (или уже не был) участником
+	MemberFailed    MemberOutcome = "failed"
+)
+
+// RoleMemberResult итог по паре роль - пользователь, Err заполнен только у MemberFailed
+type RoleMemberResult struct {
+	Role    string
+	User    string
+	Outcome MemberOutcome
+	Err     error
+}
+
+// ExportFormat формат выгрузки и загрузки пользователей и ролей
+type ExportFormat string
+
+const (
+	FormatLDIF ExportFormat = "ldif"
+	FormatCSV  ExportFormat = "csv"  // с заголовком, списки через ";"
+	FormatJSON ExportFormat = "json" // массив объектов
+)
+
+// UserRecord пользователь в выгрузке. Groups и Roles при загрузке не используются,
+// участники ролей загружаются вместе с ролями (RoleRecord.Users).
+type UserRecord struct {
+	UID             string   `json:"uid"`
+	DN              string   `json:"-"` // только для LDIF
+	GivenName       string   `json:"givenname"`
+	SN              string   `json:"sn"`
+	CN              string   `json:"cn,omitempty"`
+	Mail            string   `json:"mail,omitempty"`
+	TelephoneNumber string   `json:"telephonenumber,omitempty"`
+	Mobile          string   `json:"mobile,omitempty"`
+	Title           string   `json:"title,omitempty"`
+	OrgUnit         string   `json:"ou,omitempty"`
+	Disabled        *bool    `json:"disabled,omitempty"` // nil - не указан, при загрузке не меняется
+	Groups          []string `json:"groups,omitempty"`
+	Roles           []string `json:"roles,omitempty"`
+}
+
+// RoleRecord роль в выгрузке, Privileges при загрузке не используются
+type RoleRecord struct {
+	Name        string   `json:"name"`
+	DN          string   `json:"-"` // только для LDIF
+	Description string   `json:"description,omitempty"`
+	Users       []string `json:"users,omitempty"`
+	Privileges  []string `json:"privileges,omitempty"`
+}
+
+// ImportReport итог загрузки: план, результаты его шагов (пусто при DryRun) и записи, которые пропущены
+type ImportReport struct {
+	Plan    *ReconcilePlan
+	Results []ReconcileResult
+	Errors  []ImportError
+}
+
+// ImportError ошибка записи файла, такая запись не загружается
+type ImportError struct {
+	Record int    // номер записи, с 1
+	Key    string // uid или имя роли, если есть
+	Err    error
+}
+
+// ChangeEventKind тип изменения, см. Watcher
+type ChangeEventKind string
+
+const (
+	EventUserCreated            ChangeEventKind = "user_created"
+	EventUserUpdated            ChangeEventKind = "user_updated"
+	EventUserDisabled           ChangeEventKind = "user_disabled"
+	EventUserEnabled            ChangeEventKind = "user_enabled"
+	EventUserDeleted            ChangeEventKind = "user_deleted"
+	EventRoleMembershipChanged  ChangeEventKind = "role_membership_changed"
+	EventGroupMembershipChanged ChangeEventKind = "group_membership_changed"
+)
+
+// ChangeEvent изменение, найденное между двумя опросами
+type ChangeEvent struct {
+	Kind    ChangeEventKind
+	Name    string    // uid, роль или группа
+	Fields  []string  // EventUserUpdated: измененные атрибуты, по алфавиту
+	Added   []string  // *MembershipChanged: добавленные пользователи
+	Removed []string  // *MembershipChanged: удаленные пользователи
+	At      time.Time // modifytimestamp пользователя, если есть, иначе время опроса
+}
+
+// WatchState снимок, с которым Watcher сравнивает следующий опрос.
+// Его можно сохранить (json) и передать в NewWatcher, чтобы после перезапуска получить пропущенные изменения.
+type WatchState struct {
+	Users    map[string]WatchedUser `json:"users"`  // uid в нижнем регистре -> пользователь
+	Roles    map[string][]string    `json:"roles"`  // роль -> участники-пользователи
+	Groups   map[string][]string    `json:"groups"` // группа -> участники-пользователи
+	PolledAt time.Time              `json:"polled_at"`
+}
+
+// WatchedUser пользователь в снимке: значения атрибутов хранятся хешами
+type WatchedUser struct {
+	UID             string            `json:"uid"`
+	Disabled        bool              `json:"disabled"`
+	ModifyTimestamp time.Time         `json:"modify_timestamp"`
+	Attrs           map[string]string `json:"attrs"` // атрибут -> хеш значений
+}
+
+// ServerStatus состояние реплики, см. HealthCheck
+type ServerStatus struct {
+	Host      string
+	Healthy   bool
+	Current   bool          // запросы идут на нее
+	Latency   time.Duration // время последнего запроса или проверки
+	Err       error         // ошибка последнего запроса или проверки
+	CheckedAt time.Time
+}
+
+// RPCCall один JSON-RPC запрос к IPA, см. RPCObserver
+type RPCCall struct {
+	Method      string // для batch - "batch"
+	Host        string // реплика, только у проверок HealthCheck (обычные запросы идут на текущую, см. Servers)
+	BatchSize   int    // число команд в batch, 0 - не batch
+	BatchErrors int    // число команд batch-а, завершившихся ошибкой
+	Duration    time.Duration
+	StatusCode  int   // http-статус, 0 - ответа нет
+	ErrorCode   int   // код ошибки IPA из ответа (4001 - нет записи, ...), 0 - без ошибки
+	Err         error // ошибка отправки (нет соединения, таймаут, ...), ответа при этом нет
 }
@@ -0,0 +1,270 @@
+package freeipa
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// RPCObserver получает каждый JSON-RPC запрос клиента (в т.ч. повтор после перелогина), см. SetObservers.
+// Вызывается синхронно после ответа, поэтому не должен блокироваться.
+type RPCObserver interface {
+	ObserveRPC(ctx context.Context, call RPCCall)
+}
+
+// SetObservers задает наблюдателей за JSON-RPC запросами и проверками реплик (HealthCheck), без аргументов - отключает.
+// Вход по паролю и смена пароля не JSON-RPC и не наблюдаются.
+func (f *FreeIPA) SetObservers(observers ...RPCObserver) {
+	if len(observers) == 0 {
+		f.observers.Store(nil)
+		return
+	}
+
+	observers = slices.Clone(observers)
+	f.observers.Store(&observers)
+}
+
+// observeRPC разбирает запрос и ответ для наблюдателей; без наблюдателей ничего не разбирается
+func (f *FreeIPA) observeRPC(
+	ctx context.Context,
+	reqBytes []byte,
+	statusCode int,
+	bodyBytes []byte,
+	duration time.Duration,
+	err error,
+) {
+	observers := f.observers.Load()
+	if observers == nil {
+		return
+	}
+
+	call := RPCCall{
+		Duration:   duration,
+		StatusCode: statusCode,
+		Err:        err,
+	}
+
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+
+	if json.Unmarshal(reqBytes, &req) == nil {
+		call.Method = req.Method
+
+		var commands []json.RawMessage
+		if req.Method == "batch" && len(req.Params) > 0 && json.Unmarshal(req.Params[0], &commands) == nil {
+			call.BatchSize = len(commands)
+		}
+	}
+
+	var resp struct {
+		Result *struct {
+			Results []struct {
+				ErrorCode int `json:"error_code"`
+			} `json:"results"`
+		} `json:"result"`
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+
+	if len(bodyBytes) > 0 && json.Unmarshal(bodyBytes, &resp) == nil {
+		if resp.Error != nil {
+			call.ErrorCode = resp.Error.Code
+		}
+		if resp.Result != nil && call.BatchSize > 0 {
+			for _, item := range resp.Result.Results {
+				// EmptyModlist - не ошибка, см. handleResponse
+				if item.ErrorCode != 0 && item.ErrorCode != ErrCodeEmptyModlist {
+					call.BatchErrors++
+				}
+			}
+		}
+	}
+
+	f.notifyObservers(ctx, call)
+}
+
+// notifyObservers передает наблюдателям уже разобранный вызов
+func (f *FreeIPA) notifyObservers(ctx context.Context, call RPCCall) {
+	observers := f.observers.Load()
+	if observers == nil {
+		return
+	}
+
+	for _, observer := range *observers {
+		observer.ObserveRPC(ctx, call)
+	}
+}
+
+// SlogObserver пишет каждый запрос в лог: обычные - на уровне Debug, без ответа или с 5xx - Warn.
+// Запись пишется с контекстом запроса, так что trace_id добавляет обработчик из pkg/logger.
+type SlogObserver struct {
+	logger *slog.Logger
+}
+
+// NewSlogObserver l - логгер, nil - slog.Default()
+func NewSlogObserver(l *slog.Logger) *SlogObserver {
+	return &SlogObserver{logger: l}
+}
+
+func (o *SlogObserver) ObserveRPC(ctx context.Context, call RPCCall) {
+	l := o.logger
+	if l == nil {
+		l = slog.Default()
+	}
+
+	level := slog.LevelDebug
+	if call.Err != nil || call.StatusCode >= http.StatusInternalServerError {
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", call.Method),
+		slog.Duration("duration", call.Duration),
+		slog.Int("status_code", call.StatusCode),
+	}
+
+	if call.Host != "" {
+		attrs = append(attrs, slog.String("host", call.Host))
+	}
+	if call.BatchSize > 0 {
+		attrs = append(attrs, slog.Int("batch_size", call.BatchSize), slog.Int("batch_errors", call.BatchErrors))
+	}
+	if call.ErrorCode != 0 {
+		attrs = append(attrs, slog.Int("error_code", call.ErrorCode))
+	}
+	if call.Err != nil {
+		attrs = append(attrs, slog.String("error", call.Err.Error()))
+	}
+
+	l.LogAttrs(ctx, level, "freeipa rpc", attrs...)
+}
+
+// RPCMetrics счетчики запросов для Prometheus: WritePrometheus отдает их в текстовом формате,
+// а сам RPCMetrics - http.Handler для /metrics
+type RPCMetrics struct {
+	mu        sync.Mutex
+	requests  map[rpcMetricKey]uint64 // method, http-статус
+	errors    map[rpcMetricKey]uint64 // method, код ошибки IPA или "transport"
+	durations map[string]rpcDuration  // method
+	batchCmds uint64
+	batchErrs uint64
+}
+
+type rpcMetricKey struct {
+	method string
+	label  string
+}
+
+type rpcDuration struct {
+	sum   time.Duration
+	count uint64
+}
+
+func NewRPCMetrics() *RPCMetrics {
+	return &RPCMetrics{
+		requests:  map[rpcMetricKey]uint64{},
+		errors:    map[rpcMetricKey]uint64{},
+		durations: map[string]rpcDuration{},
+	}
+}
+
+func (m *RPCMetrics) ObserveRPC(_ context.Context, call RPCCall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[rpcMetricKey{method: call.Method, label: strconv.Itoa(call.StatusCode)}]++
+
+	switch {
+	case call.Err != nil:
+		m.errors[rpcMetricKey{method: call.Method, label: "transport"}]++
+	case call.ErrorCode != 0 && call.ErrorCode != ErrCodeEmptyModlist: // менять нечего - не ошибка
+		m.errors[rpcMetricKey{method: call.Method, label: strconv.Itoa(call.ErrorCode)}]++
+	}
+
+	d := m.durations[call.Method]
+	d.sum += call.Duration
+	d.count++
+	m.durations[call.Method] = d
+
+	m.batchCmds += uint64(call.BatchSize)   //nolint:gosec // размер batch-а не отрицательный
+	m.batchErrs += uint64(call.BatchErrors) //nolint:gosec // число ошибок не отрицательное
+}
+
+// WritePrometheus счетчики в текстовом формате Prometheus (text/plain; version=0.0.4)
+func (m *RPCMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeMetricHeader(&b, "freeipa_rpc_requests_total", "counter", "JSON-RPC requests to FreeIPA by HTTP status.")
+	for _, key := range sortedMetricKeys(m.requests) {
+		fmt.Fprintf(&b, `freeipa_rpc_requests_total{method="%s",status="%s"} %d`+"\n",
+			escapeLabel(key.method), key.label, m.requests[key])
+	}
+
+	writeMetricHeader(&b, "freeipa_rpc_errors_total", "counter",
+		"Failed JSON-RPC requests to FreeIPA by IPA error code or transport.")
+	for _, key := range sortedMetricKeys(m.errors) {
+		fmt.Fprintf(&b, `freeipa_rpc_errors_total{method="%s",code="%s"} %d`+"\n",
+			escapeLabel(key.method), key.label, m.errors[key])
+	}
+
+	writeMetricHeader(&b, "freeipa_rpc_duration_seconds", "summary", "Duration of JSON-RPC requests to FreeIPA.")
+	for _, method := range slices.Sorted(maps.Keys(m.durations)) {
+		d := m.durations[method]
+		fmt.Fprintf(&b, `freeipa_rpc_duration_seconds_sum{method="%s"} %s`+"\n",
+			escapeLabel(method), strconv.FormatFloat(d.sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(&b, `freeipa_rpc_duration_seconds_count{method="%s"} %d`+"\n", escapeLabel(method), d.count)
+	}
+
+	writeMetricHeader(&b, "freeipa_rpc_batch_commands_total", "counter", "Commands sent in FreeIPA batch requests.")
+	fmt.Fprintf(&b, "freeipa_rpc_batch_commands_total %d\n", m.batchCmds)
+
+	writeMetricHeader(&b, "freeipa_rpc_batch_errors_total", "counter", "Failed commands in FreeIPA batch requests.")
+	fmt.Fprintf(&b, "freeipa_rpc_batch_errors_total %d\n", m.batchErrs)
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+
+	return nil
+}
+
+func (m *RPCMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := m.WritePrometheus(w); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write freeipa metrics", slog.String("error", err.Error()))
+	}
+}
+
+func writeMetricHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func sortedMetricKeys(m map[rpcMetricKey]uint64) []rpcMetricKey {
+	return slices.SortedFunc(maps.Keys(m), func(a, b rpcMetricKey) int {
+		return cmp.Or(strings.Compare(a.method, b.method), strings.Compare(a.label, b.label))
+	})
+}
+
+// escapeLabel экранирование значения метки по формату Prometheus
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,106 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+const (
+	headerRejectionReason    = "X-IPA-Rejection-Reason"
+	headerPwchangeResult     = "X-IPA-Pwchange-Result"
+	headerPwchangePolicyErr  = "X-IPA-Pwchange-Policy-Error"
+	pwchangeResultOK         = "ok"
+	pwchangeResultInvalid    = "invalid-password"
+	pwchangeResultPolicyFail = "policy-error"
+)
+
+// passwords
+
+// ChangePassword самостоятельная смена пароля пользователем (ipa/session/change_password).
+// Сессия не нужна, поэтому так меняется и просроченный пароль (Login отдал ErrPasswordExpired).
+// otp указывается, если у пользователя включена двухфакторка, иначе пустая строка.
+// Неверный старый пароль - ErrInvalidPassword, несоответствие политике - ErrPasswordPolicy.
+func (f *FreeIPA) ChangePassword(ctx context.Context, userID, oldPassword, newPassword, otp string) (int, error) {
+	values := url.Values{
+		"user":         []string{userID},
+		"old_password": []string{oldPassword},
+		"new_password": []string{newPassword},
+	}
+	if otp != "" {
+		values.Set("otp", otp)
+	}
+
+	_, statusCode, header, _, err := f.formRequest(ctx, "ipa/session/change_password", values)
+	if err != nil {
+		return 0, fmt.Errorf(errMsgFailedToHTTPRequest+": %w", err)
+	}
+
+	// IPA отвечает 200 и html-страницей, сам результат только в заголовках
+	switch result := header.Get(headerPwchangeResult); result {
+	case pwchangeResultOK:
+		return statusCode, nil
+	case pwchangeResultInvalid:
+		return 0, fmt.Errorf("failed to change password: %w", &Error{
+			Code:    ErrInvalidPassword.Code,
+			Name:    ErrInvalidPassword.Name,
+			Message: "invalid current password",
+		})
+	case pwchangeResultPolicyFail:
+		return 0, fmt.Errorf("failed to change password: %w", &Error{
+			Code:    ErrPasswordPolicy.Code,
+			Name:    ErrPasswordPolicy.Name,
+			Message: header.Get(headerPwchangePolicyErr),
+		})
+	default:
+		return statusCode, fmt.Errorf("original http-statusCode %d, unexpected %s %q",
+			statusCode, headerPwchangeResult, result)
+	}
+}
+
+// ResetPassword смена пароля пользователю администратором.
+// Если password == nil, то IPA сгенерирует случайный (user_mod random=true), иначе выставляется указанный (passwd).
+// Отдается выставленный пароль. Пароль, заданный администратором, IPA сразу помечает просроченным,
+// поэтому при входе пользователь получит ErrPasswordExpired и должен будет сменить его через ChangePassword.
+func (f *FreeIPA) ResetPassword(ctx context.Context, userID string, password *string) (int, string, error) {
+	if password != nil {
+		statusCode, _, err := f.sendRPC(ctx, "passwd", rpcArgs(userID, *password), nil)
+		if err != nil {
+			return statusCode, "", err
+		}
+
+		return statusCode, *password, nil
+	}
+
+	opts := map[string]any{
+		keyOptRandom: true,
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "user_mod", rpcArgs(userID), opts)
+	if err != nil {
+		return statusCode, "", err
+	}
+	if resp.Result == nil {
+		return 0, "", errors.New(errMsgResponseResultIsNil)
+	}
+
+	userTmp, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, "", errors.New(errMsgFailedToParseResponse)
+	}
+
+	// в зависимости от версии IPA значение строкой или списком
+	switch v := userTmp[keyOptRandomPassword].(type) {
+	case string:
+		return statusCode, v, nil
+	case []any:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return statusCode, s, nil
+			}
+		}
+	}
+
+	return 0, "", errors.New(errMsgFailedToParseResponse)
+}
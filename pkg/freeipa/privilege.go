@@ -0,0 +1,148 @@
+package freeipa
+
+import (
+	"context"
+)
+
+const (
+	keyOptPrivilege  = "privilege"
+	keyOptPermission = "permission"
+)
+
+// privileges
+
+func (f *FreeIPA) GetPrivileges(ctx context.Context) (int, []Privilege, error) {
+	statusCode, entries, err := f.findEntries(ctx, "privilege_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	privileges, err := decodeEntries(entries, privilegeCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, privileges, nil
+}
+
+func (f *FreeIPA) GetPrivilege(ctx context.Context, name string) (int, *Privilege, error) {
+	return f.sendPrivilegeRPC(ctx, "privilege_show", name, map[string]any{"all": true})
+}
+
+func (f *FreeIPA) CreatePrivilege(ctx context.Context, name string, desc *string) (int, *Privilege, error) {
+	opts := map[string]any{}
+
+	if desc != nil {
+		opts[keyOptDescription] = *desc
+	}
+
+	return f.sendPrivilegeRPC(ctx, "privilege_add", name, opts)
+}
+
+func (f *FreeIPA) UpdatePrivilege(ctx context.Context, name, desc string) (int, *Privilege, error) {
+	opts := map[string]any{
+		keyOptDescription: desc,
+	}
+
+	return f.sendPrivilegeRPC(ctx, "privilege_mod", name, opts)
+}
+
+func (f *FreeIPA) DeletePrivilege(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "privilege_del", name)
+}
+
+// AddPrivilegePermissions включает разрешения в привилегию
+func (f *FreeIPA) AddPrivilegePermissions(ctx context.Context, name string, permissions []string) (int, error) {
+	members := map[string][]string{keyOptPermission: permissions}
+
+	return f.sendMembersRPC(ctx, "privilege_add_permission", name, members)
+}
+
+func (f *FreeIPA) RemovePrivilegePermissions(ctx context.Context, name string, permissions []string) (int, error) {
+	members := map[string][]string{keyOptPermission: permissions}
+
+	return f.sendMembersRPC(ctx, "privilege_remove_permission", name, members)
+}
+
+func (f *FreeIPA) sendPrivilegeRPC(
+	ctx context.Context,
+	method, name string,
+	opts map[string]any,
+) (int, *Privilege, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	privilege, err := decodeEntry(entry, privilegeCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &privilege, nil
+}
+
+// permissions
+
+// GetPermissions разрешения, criteria - подстрока для поиска по имени (пустая - все)
+func (f *FreeIPA) GetPermissions(ctx context.Context, criteria string) (int, []Permission, error) {
+	statusCode, entries, err := f.findEntries(ctx, "permission_find", criteria)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	permissions, err := decodeEntries(entries, permissionCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, permissions, nil
+}
+
+func (f *FreeIPA) GetPermission(ctx context.Context, name string) (int, *Permission, error) {
+	return f.sendPermissionRPC(ctx, "permission_show", name, map[string]any{"all": true})
+}
+
+// CreatePermission права (Rights) обязательны
+func (f *FreeIPA) CreatePermission(ctx context.Context, reqPermission RequestPermission) (int, *Permission, error) {
+	return f.sendPermissionRPC(ctx, "permission_add", reqPermission.CN, reqPermission.toOpts())
+}
+
+func (f *FreeIPA) UpdatePermission(ctx context.Context, reqPermission RequestPermission) (int, *Permission, error) {
+	return f.sendPermissionRPC(ctx, "permission_mod", reqPermission.CN, reqPermission.toOpts())
+}
+
+func (f *FreeIPA) DeletePermission(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "permission_del", name)
+}
+
+func (f *FreeIPA) sendPermissionRPC(
+	ctx context.Context,
+	method, name string,
+	opts map[string]any,
+) (int, *Permission, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	permission, err := decodeEntry(entry, permissionCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &permission, nil
+}
+
+// toOpts опции permission_add/permission_mod, пустой не nil срез очищает атрибут
+func (r RequestPermission) toOpts() map[string]any {
+	opts := map[string]any{}
+
+	putListOpt(opts, "ipapermright", r.Rights)
+	putOpt(opts, "type", r.Type)
+	putListOpt(opts, "attrs", r.Attrs)
+	putOpt(opts, "ipapermbindruletype", r.BindType)
+	putListOpt(opts, "extratargetfilter", r.TargetFilter)
+
+	return opts
+}
@@ -0,0 +1,130 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+)
+
+// GlobalPasswordPolicy имя глобальной политики паролей
+const GlobalPasswordPolicy = "global_policy"
+
+// password policies
+
+// GetPasswordPolicies все политики паролей: глобальная и групповые
+func (f *FreeIPA) GetPasswordPolicies(ctx context.Context) (int, []PasswordPolicy, error) {
+	opts := map[string]any{
+		"all": true,
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "pwpolicy_find", "", opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	policies := make([]PasswordPolicy, 0)
+
+	if resp.Result.Result != nil {
+		if policies, err = decodeList(resp.Result.Result, passwordPolicyCodec); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return statusCode, policies, nil
+}
+
+// GetPasswordPolicy политика группы, пустой group - глобальная политика
+func (f *FreeIPA) GetPasswordPolicy(ctx context.Context, group string) (int, *PasswordPolicy, error) {
+	return f.sendPWPolicyRPC(ctx, "pwpolicy_show", group, map[string]any{"all": true})
+}
+
+// GetUserPasswordPolicy политика, которая действует для пользователя (с учетом приоритетов групповых)
+func (f *FreeIPA) GetUserPasswordPolicy(ctx context.Context, userID string) (int, *PasswordPolicy, error) {
+	opts := map[string]any{
+		"all":      true,
+		keyOptUser: userID,
+	}
+
+	return f.sendPWPolicyRPC(ctx, "pwpolicy_show", "", opts)
+}
+
+// CreatePasswordPolicy политика для группы, Priority обязателен
+func (f *FreeIPA) CreatePasswordPolicy(
+	ctx context.Context,
+	reqPolicy RequestPasswordPolicy,
+) (int, *PasswordPolicy, error) {
+	if reqPolicy.Group == "" {
+		return 0, nil, errors.New("group is required")
+	}
+
+	return f.sendPWPolicyRPC(ctx, "pwpolicy_add", reqPolicy.Group, reqPolicy.toOpts())
+}
+
+// UpdatePasswordPolicy меняет заданные поля, пустой Group - глобальная политика
+func (f *FreeIPA) UpdatePasswordPolicy(
+	ctx context.Context,
+	reqPolicy RequestPasswordPolicy,
+) (int, *PasswordPolicy, error) {
+	return f.sendPWPolicyRPC(ctx, "pwpolicy_mod", reqPolicy.Group, reqPolicy.toOpts())
+}
+
+// DeletePasswordPolicy удаляет политику группы, глобальную удалить нельзя
+func (f *FreeIPA) DeletePasswordPolicy(ctx context.Context, group string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "pwpolicy_del", rpcArgs(group), nil)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// sendPWPolicyRPC команда, в ответе которой одна политика. Пустой group не передается (глобальная политика).
+func (f *FreeIPA) sendPWPolicyRPC(
+	ctx context.Context,
+	method, group string,
+	opts map[string]any,
+) (int, *PasswordPolicy, error) {
+	args := ""
+	if group != "" {
+		args = rpcArgs(group)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, method, args, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	policyTmp, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	policy, err := decodeEntry(policyTmp, passwordPolicyCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &policy, nil
+}
+
+// toOpts опции pwpolicy_add/pwpolicy_mod
+func (r RequestPasswordPolicy) toOpts() map[string]any {
+	opts := map[string]any{}
+
+	putOpt(opts, "krbmaxpwdlife", r.MaxLife)
+	putOpt(opts, "krbminpwdlife", r.MinLife)
+	putOpt(opts, "krbpwdminlength", r.MinLength)
+	putOpt(opts, "krbpwdmindiffchars", r.MinClasses)
+	putOpt(opts, "krbpwdhistorylength", r.History)
+	putOpt(opts, "krbpwdmaxfailure", r.MaxFail)
+	putOpt(opts, "krbpwdfailurecountinterval", r.FailureInterval)
+	putOpt(opts, "krbpwdlockoutduration", r.LockoutTime)
+	putOpt(opts, "cospriority", r.Priority)
+
+	return opts
+}
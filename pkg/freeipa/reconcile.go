@@ -0,0 +1,352 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const reconcileBatchSizeDefault = 50
+
+// Reconcile приводит каталог к состоянию desired: строит план по текущим записям и, если не DryRun,
+// выполняет его batch-ами. Ошибки отдельных шагов - в результатах, ошибка функции - только если план
+// не построить или batch не отправить (результаты уже выполненных шагов при этом тоже отдаются).
+func (f *FreeIPA) Reconcile(
+	ctx context.Context,
+	desired DesiredState,
+	opts ReconcileOptions,
+) (int, *ReconcilePlan, []ReconcileResult, error) {
+	statusCode, plan, err := f.PlanReconcile(ctx, desired)
+	if err != nil {
+		return statusCode, nil, nil, err
+	}
+	if opts.DryRun {
+		return statusCode, plan, nil, nil
+	}
+
+	statusCode, results, err := f.ApplyPlan(ctx, plan, opts.BatchSize)
+	if err != nil {
+		return statusCode, plan, results, err
+	}
+
+	return statusCode, plan, results, nil
+}
+
+// PlanReconcile план приведения каталога к состоянию desired, сам каталог не меняется
+func (f *FreeIPA) PlanReconcile(ctx context.Context, desired DesiredState) (int, *ReconcilePlan, error) {
+	statusCode, userEntries, err := f.findEntries(ctx, "user_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	statusCode, groupEntries, err := f.findEntries(ctx, "group_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	statusCode, roleEntries, err := f.showEntries(ctx, "role_show", slices.Sorted(maps.Keys(desired.Roles)), false)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	userCreates, userOthers, err := planUsers(userEntries, desired)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	groupCreates, groupOthers, err := planGroups(groupEntries, desired.Groups)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	roleOthers, err := planRoles(roleEntries, desired.Roles)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// сначала создание: участники добавляются уже в созданные группы
+	actions := slices.Concat(userCreates, groupCreates, userOthers, groupOthers, roleOthers)
+
+	return statusCode, &ReconcilePlan{Actions: actions}, nil
+}
+
+// ApplyPlan выполняет шаги плана batch-ами по batchSize (<= 0 - reconcileBatchSizeDefault).
+// Batch-и и команды внутри них выполняются по порядку, поэтому участники добавляются уже в созданные записи.
+func (f *FreeIPA) ApplyPlan(ctx context.Context, plan *ReconcilePlan, batchSize int) (int, []ReconcileResult, error) {
+	if batchSize <= 0 {
+		batchSize = reconcileBatchSizeDefault
+	}
+
+	statusCode := http.StatusOK
+	results := make([]ReconcileResult, 0, len(plan.Actions))
+
+	for chunk := range slices.Chunk(plan.Actions, batchSize) {
+		newStatusCode, chunkResults, err := f.sendReconcileBatch(ctx, chunk)
+		if err != nil {
+			return newStatusCode, results, err
+		}
+
+		statusCode = newStatusCode
+		results = append(results, chunkResults...)
+	}
+
+	return statusCode, results, nil
+}
+
+// String план в читаемом виде, по шагу на строку (вывод dry-run)
+func (p *ReconcilePlan) String() string {
+	if p == nil {
+		return ""
+	}
+
+	lines := make([]string, len(p.Actions))
+
+	for i, action := range p.Actions {
+		lines[i] = action.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (a ReconcileAction) String() string {
+	switch {
+	case len(a.Members) > 0:
+		return fmt.Sprintf("%s %s: %s", a.Kind, a.Target, strings.Join(a.Members, ", "))
+	case len(a.Fields) > 0:
+		return fmt.Sprintf("%s %s: %s", a.Kind, a.Target, strings.Join(a.Fields, ", "))
+	default:
+		return fmt.Sprintf("%s %s", a.Kind, a.Target)
+	}
+}
+
+func (f *FreeIPA) sendReconcileBatch(ctx context.Context, actions []ReconcileAction) (int, []ReconcileResult, error) {
+	methods := make([]string, len(actions))
+
+	for i, action := range actions {
+		req, err := f.rpcReq(action.method, rpcArgs(action.Target), action.opts, false)
+		if err != nil {
+			return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (%s): %s", action.method, err)
+		}
+
+		methods[i] = string(req)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+	if len(resp.Result.Results) != len(actions) {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	results := make([]ReconcileResult, len(actions))
+
+	for i, item := range resp.Result.Results {
+		err := item.err()
+		if errors.Is(err, ErrEmptyModlist) { // как и в handleResponse: менять было нечего
+			err = nil
+		}
+		if err == nil {
+			err = failedMembersError(item.Failed)
+		}
+
+		results[i] = ReconcileResult{Action: actions[i], Err: err}
+	}
+
+	return statusCode, results, nil
+}
+
+// planUsers создание и изменение пользователей из desired, отключение лишних при DisableMissing
+func planUsers(entries []map[string]any, desired DesiredState) ([]ReconcileAction, []ReconcileAction, error) {
+	var creates, others []ReconcileAction
+
+	current := make(map[string]map[string]any, len(entries))
+	users := make([]User, 0, len(entries))
+
+	for _, entry := range entries {
+		user, err := decodeEntry(entry, userCodec)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		current[strings.ToLower(user.UID)] = entry
+		users = append(users, user)
+	}
+
+	keep := make(map[string]bool, len(desired.Users)+len(desired.Protected))
+
+	for _, uid := range desired.Protected {
+		keep[strings.ToLower(uid)] = true
+	}
+
+	for _, reqUser := range desired.Users {
+		keep[strings.ToLower(reqUser.UID)] = true
+
+		entry, ok := current[strings.ToLower(reqUser.UID)]
+		if !ok {
+			opts, err := reqUser.toAddOpts()
+			if err != nil {
+				return nil, nil, fmt.Errorf("user %s: %w", reqUser.UID, err)
+			}
+
+			creates = append(creates, newReconcileAction(ReconcileCreateUser, reqUser.UID, "user_add", opts))
+
+			continue
+		}
+
+		diff, err := diffUser(entry, reqUser)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		diff.UserPassword = nil // пароль сравнить нельзя, иначе он менялся бы при каждом запуске
+
+		if opts := diff.toModOpts(); len(opts) > 0 {
+			others = append(others, newReconcileAction(ReconcileUpdateUser, reqUser.UID, "user_mod", opts))
+		}
+	}
+
+	if desired.DisableMissing {
+		for _, user := range users {
+			if !keep[strings.ToLower(user.UID)] && !user.NsAccountLock {
+				others = append(others, newReconcileAction(ReconcileDisableUser, user.UID, "user_disable", nil))
+			}
+		}
+	}
+
+	return creates, others, nil
+}
+
+// planGroups создание групп, изменение описания/gid и состава пользователей
+func planGroups(entries []map[string]any, desired []DesiredGroup) ([]ReconcileAction, []ReconcileAction, error) {
+	var creates, others []ReconcileAction
+
+	current, err := decodeEntries(entries, groupCodec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups := make(map[string]Group, len(current))
+
+	for _, group := range current {
+		groups[strings.ToLower(group.CN)] = group
+	}
+
+	for _, reqGroup := range desired {
+		group, ok := groups[strings.ToLower(reqGroup.CN)]
+		if !ok {
+			creates = append(creates,
+				newReconcileAction(ReconcileCreateGroup, reqGroup.CN, "group_add", reqGroup.toAddOpts()))
+			others = append(others, planMembers("group", reqGroup.CN, reqGroup.Users, nil)...)
+
+			continue
+		}
+
+		diff := RequestGroup{CN: reqGroup.CN}
+
+		if reqGroup.Description != nil && *reqGroup.Description != group.Description {
+			diff.Description = reqGroup.Description
+		}
+		if reqGroup.GIDNumber != nil && *reqGroup.GIDNumber != group.GIDNumber {
+			diff.GIDNumber = reqGroup.GIDNumber
+		}
+		if opts := diff.toModOpts(); len(opts) > 0 {
+			others = append(others, newReconcileAction(ReconcileUpdateGroup, reqGroup.CN, "group_mod", opts))
+		}
+
+		if reqGroup.Users != nil {
+			others = append(others, planMembers("group", reqGroup.CN, reqGroup.Users, group.MemberUser)...)
+		}
+	}
+
+	return creates, others, nil
+}
+
+// planRoles состав пользователей ролей
+func planRoles(entries []map[string]any, desired map[string][]string) ([]ReconcileAction, error) {
+	var others []ReconcileAction
+
+	roles, err := decodeEntries(entries, roleCodec)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range roles {
+		for name, users := range desired {
+			if strings.EqualFold(name, role.CN) {
+				others = append(others, planMembers("role", role.CN, users, role.MemberUser)...)
+			}
+		}
+	}
+
+	return others, nil
+}
+
+// planMembers добавление недостающих и удаление лишних пользователей группы или роли, uid без учета регистра
+func planMembers(objType, name string, desired, current []string) []ReconcileAction {
+	var (
+		actions     []ReconcileAction
+		add, remove []string
+	)
+
+	for _, uid := range desired {
+		if !containsFold(current, uid) && !containsFold(add, uid) {
+			add = append(add, uid)
+		}
+	}
+
+	for _, uid := range current {
+		if !containsFold(desired, uid) {
+			remove = append(remove, uid)
+		}
+	}
+
+	addKind, removeKind := ReconcileAddGroupMembers, ReconcileRemoveGroupMembers
+	if objType == "role" {
+		addKind, removeKind = ReconcileAddRoleMembers, ReconcileRemoveRoleMembers
+	}
+
+	if len(add) > 0 {
+		actions = append(actions, ReconcileAction{
+			Kind:    addKind,
+			Target:  name,
+			Members: add,
+			method:  objType + "_add_member",
+			opts:    map[string]any{keyOptUser: add},
+		})
+	}
+	if len(remove) > 0 {
+		actions = append(actions, ReconcileAction{
+			Kind:    removeKind,
+			Target:  name,
+			Members: remove,
+			method:  objType + "_remove_member",
+			opts:    map[string]any{keyOptUser: remove},
+		})
+	}
+
+	return actions
+}
+
+func newReconcileAction(kind ReconcileActionKind, target, method string, opts map[string]any) ReconcileAction {
+	return ReconcileAction{
+		Kind:   kind,
+		Target: target,
+		Fields: slices.Sorted(maps.Keys(opts)),
+		method: method,
+		opts:   opts,
+	}
+}
+
+func containsFold(items []string, s string) bool {
+	return slices.ContainsFunc(items, func(v string) bool {
+		return strings.EqualFold(v, s)
+	})
+}
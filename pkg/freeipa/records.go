@@ -0,0 +1,665 @@
+package freeipa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	csvListSep     = ";"
+	dnAccountsPart = "cn=accounts,"
+)
+
+// recordCodec описание записи выгрузки: DN в LDIF и поля
+type recordCodec[T any] struct {
+	rdn       string // атрибут RDN записи в LDIF
+	container string // контейнер записи в LDIF, без суффикса
+	key       func(*T) *string
+	dn        func(*T) *string
+	fields    []recordField[T]
+}
+
+// recordField поле записи: колонка CSV и атрибут LDIF.
+// У ссылок (rdn != "") значение в LDIF - DN объекта из container, в записи - его имя.
+type recordField[T any] struct {
+	name      string
+	ldap      string
+	rdn       string
+	container string
+	get       func(*T) []string
+	set       func(*T, []string) error
+}
+
+var userRecordCodec = recordCodec[UserRecord]{
+	rdn:       "uid",
+	container: "cn=users,cn=accounts",
+	key:       func(r *UserRecord) *string { return &r.UID },
+	dn:        func(r *UserRecord) *string { return &r.DN },
+	fields: []recordField[UserRecord]{
+		stringField("uid", "uid", func(r *UserRecord) *string { return &r.UID }),
+		stringField("givenname", "givenName", func(r *UserRecord) *string { return &r.GivenName }),
+		stringField("sn", "sn", func(r *UserRecord) *string { return &r.SN }),
+		stringField("cn", "cn", func(r *UserRecord) *string { return &r.CN }),
+		stringField("mail", "mail", func(r *UserRecord) *string { return &r.Mail }),
+		stringField("telephonenumber", "telephoneNumber", func(r *UserRecord) *string { return &r.TelephoneNumber }),
+		stringField("mobile", "mobile", func(r *UserRecord) *string { return &r.Mobile }),
+		stringField("title", "title", func(r *UserRecord) *string { return &r.Title }),
+		stringField("ou", "ou", func(r *UserRecord) *string { return &r.OrgUnit }),
+		boolField("disabled", "nsAccountLock", func(r *UserRecord) **bool { return &r.Disabled }),
+		refsField("groups", "memberOf", "cn", "cn=groups,cn=accounts", func(r *UserRecord) *[]string {
+			return &r.Groups
+		}),
+		refsField("roles", "memberOf", "cn", "cn=roles,cn=accounts", func(r *UserRecord) *[]string {
+			return &r.Roles
+		}),
+	},
+}
+
+var roleRecordCodec = recordCodec[RoleRecord]{
+	rdn:       "cn",
+	container: "cn=roles,cn=accounts",
+	key:       func(r *RoleRecord) *string { return &r.Name },
+	dn:        func(r *RoleRecord) *string { return &r.DN },
+	fields: []recordField[RoleRecord]{
+		stringField("name", "cn", func(r *RoleRecord) *string { return &r.Name }),
+		stringField("description", "description", func(r *RoleRecord) *string { return &r.Description }),
+		refsField("users", "member", "uid", "cn=users,cn=accounts", func(r *RoleRecord) *[]string {
+			return &r.Users
+		}),
+		refsField("privileges", "memberOf", "cn", "cn=privileges,cn=pbac", func(r *RoleRecord) *[]string {
+			return &r.Privileges
+		}),
+	},
+}
+
+func stringField[T any](name, ldap string, ptr func(*T) *string) recordField[T] {
+	return recordField[T]{
+		name: name,
+		ldap: ldap,
+		get: func(r *T) []string {
+			if v := *ptr(r); v != "" {
+				return []string{v}
+			}
+
+			return nil
+		},
+		set: func(r *T, values []string) error {
+			if len(values) > 1 {
+				return fmt.Errorf("%s: multiple values", name)
+			}
+
+			*ptr(r) = strings.Join(values, "")
+
+			return nil
+		},
+	}
+}
+
+// boolField пустое значение (или отсутствие атрибута в LDIF) - nil, а не false
+func boolField[T any](name, ldap string, ptr func(*T) **bool) recordField[T] {
+	return recordField[T]{
+		name: name,
+		ldap: ldap,
+		get: func(r *T) []string {
+			if v := *ptr(r); v != nil {
+				return []string{strings.ToUpper(strconv.FormatBool(*v))}
+			}
+
+			return nil
+		},
+		set: func(r *T, values []string) error {
+			value := strings.Join(values, "")
+			if value == "" {
+				*ptr(r) = nil
+
+				return nil
+			}
+
+			b, err := strconv.ParseBool(strings.ToLower(value))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+
+			*ptr(r) = &b
+
+			return nil
+		},
+	}
+}
+
+func refsField[T any](name, ldap, rdn, container string, ptr func(*T) *[]string) recordField[T] {
+	return recordField[T]{
+		name:      name,
+		ldap:      ldap,
+		rdn:       rdn,
+		container: container,
+		get:       func(r *T) []string { return *ptr(r) },
+		set: func(r *T, values []string) error {
+			*ptr(r) = append(*ptr(r), values...)
+
+			return nil
+		},
+	}
+}
+
+// recordWriter пишет записи потоком, Close дописывает окончание формата
+type recordWriter[T any] interface {
+	Write(rec *T) error
+	Close() error
+}
+
+func newRecordWriter[T any](w io.Writer, format ExportFormat, codec recordCodec[T]) (recordWriter[T], error) {
+	switch format {
+	case FormatCSV:
+		return &csvRecordWriter[T]{w: csv.NewWriter(w), codec: codec}, nil
+	case FormatJSON:
+		return &jsonRecordWriter[T]{w: w}, nil
+	case FormatLDIF:
+		return &ldifRecordWriter[T]{w: w, codec: codec}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// importRecord запись файла и ее номер (с 1)
+type importRecord[T any] struct {
+	n   int
+	rec T
+}
+
+// readRecords записи из r, Key у ImportError заполняется по мере возможности
+func readRecords[T any](
+	r io.Reader,
+	format ExportFormat,
+	codec recordCodec[T],
+) ([]importRecord[T], []ImportError, error) {
+	switch format {
+	case FormatCSV:
+		return readCSVRecords(r, codec)
+	case FormatJSON:
+		return readJSONRecords[T](r)
+	case FormatLDIF:
+		return readLDIFRecords(r, codec)
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// csv
+
+type csvRecordWriter[T any] struct {
+	w        *csv.Writer
+	codec    recordCodec[T]
+	isHeader bool
+}
+
+func (c *csvRecordWriter[T]) Write(rec *T) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	row := make([]string, len(c.codec.fields))
+
+	for i, field := range c.codec.fields {
+		row[i] = strings.Join(field.get(rec), csvListSep)
+	}
+
+	return c.w.Write(row)
+}
+
+func (c *csvRecordWriter[T]) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+func (c *csvRecordWriter[T]) writeHeader() error {
+	if c.isHeader {
+		return nil
+	}
+
+	c.isHeader = true
+	header := make([]string, len(c.codec.fields))
+
+	for i, field := range c.codec.fields {
+		header[i] = field.name
+	}
+
+	return c.w.Write(header)
+}
+
+func readCSVRecords[T any](r io.Reader, codec recordCodec[T]) ([]importRecord[T], []ImportError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make([]*recordField[T], len(header))
+
+	for i, name := range header {
+		for j := range codec.fields {
+			if strings.EqualFold(strings.TrimSpace(name), codec.fields[j].name) {
+				columns[i] = &codec.fields[j]
+			}
+		}
+	}
+
+	var (
+		records []importRecord[T]
+		errs    []ImportError
+	)
+
+	for n := 1; ; n++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+
+		var (
+			rec    T
+			recErr error
+		)
+
+		for i, value := range row {
+			if i >= len(columns) || columns[i] == nil || value == "" {
+				continue
+			}
+
+			values := []string{value}
+			if columns[i].rdn != "" {
+				values = strings.Split(value, csvListSep)
+			}
+
+			recErr = errors.Join(recErr, columns[i].set(&rec, values))
+		}
+
+		if recErr != nil {
+			errs = append(errs, ImportError{Record: n, Key: *codec.key(&rec), Err: recErr})
+
+			continue
+		}
+
+		records = append(records, importRecord[T]{n: n, rec: rec})
+	}
+
+	return records, errs, nil
+}
+
+// json
+
+type jsonRecordWriter[T any] struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonRecordWriter[T]) Write(rec *T) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if j.count == 0 {
+		sep = "[\n"
+	}
+
+	j.count++
+
+	_, err = fmt.Fprintf(j.w, "%s%s", sep, data)
+
+	return err
+}
+
+func (j *jsonRecordWriter[T]) Close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(j.w, end)
+
+	return err
+}
+
+func readJSONRecords[T any](r io.Reader) ([]importRecord[T], []ImportError, error) {
+	var raw []json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to read json: %w", err)
+	}
+
+	var (
+		records []importRecord[T]
+		errs    []ImportError
+	)
+
+	for i, item := range raw {
+		var rec T
+
+		if err := json.Unmarshal(item, &rec); err != nil {
+			errs = append(errs, ImportError{Record: i + 1, Err: err})
+
+			continue
+		}
+
+		records = append(records, importRecord[T]{n: i + 1, rec: rec})
+	}
+
+	return records, errs, nil
+}
+
+// ldif
+
+type ldifRecordWriter[T any] struct {
+	w         io.Writer
+	codec     recordCodec[T]
+	isVersion bool
+}
+
+func (l *ldifRecordWriter[T]) Write(rec *T) error {
+	var buf bytes.Buffer
+
+	if !l.isVersion {
+		l.isVersion = true
+		buf.WriteString("version: 1\n\n")
+	}
+
+	dn := *l.codec.dn(rec)
+	suffix := dnSuffix(dn)
+
+	if dn == "" {
+		dn = joinDN(l.codec.rdn, *l.codec.key(rec), l.codec.container, suffix)
+	}
+
+	writeLDIFLine(&buf, "dn", dn)
+
+	for _, field := range l.codec.fields {
+		for _, value := range field.get(rec) {
+			if field.rdn != "" {
+				value = joinDN(field.rdn, value, field.container, suffix)
+			}
+
+			writeLDIFLine(&buf, field.ldap, value)
+		}
+	}
+
+	buf.WriteString("\n")
+
+	_, err := l.w.Write(buf.Bytes())
+
+	return err
+}
+
+func (l *ldifRecordWriter[T]) Close() error {
+	if l.isVersion {
+		return nil
+	}
+
+	_, err := io.WriteString(l.w, "version: 1\n")
+
+	return err
+}
+
+// writeLDIFLine значения не из безопасного подмножества (RFC 2849) пишутся в base64
+func writeLDIFLine(buf *bytes.Buffer, attr, value string) {
+	if isLDIFSafe(value) {
+		fmt.Fprintf(buf, "%s: %s\n", attr, value)
+
+		return
+	}
+
+	fmt.Fprintf(buf, "%s:: %s\n", attr, base64.StdEncoding.EncodeToString([]byte(value)))
+}
+
+func isLDIFSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.ContainsAny(value[:1], " :<") || strings.HasSuffix(value, " ") {
+		return false
+	}
+
+	for i := range len(value) {
+		if c := value[i]; c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func readLDIFRecords[T any](r io.Reader, codec recordCodec[T]) ([]importRecord[T], []ImportError, error) {
+	entries, err := parseLDIF(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		records []importRecord[T]
+		errs    []ImportError
+	)
+
+	for i, entry := range entries {
+		var (
+			rec    T
+			recErr error
+		)
+
+		for _, attr := range entry {
+			if strings.EqualFold(attr.name, "dn") {
+				*codec.dn(&rec) = attr.value
+
+				continue
+			}
+
+			for _, field := range codec.fields {
+				if !strings.EqualFold(attr.name, field.ldap) {
+					continue
+				}
+
+				value := attr.value
+
+				if field.rdn != "" {
+					name, container, ok := splitDN(value)
+					if !ok || !strings.EqualFold(name.attr, field.rdn) ||
+						!strings.HasPrefix(strings.ToLower(container), field.container) {
+						continue
+					}
+
+					value = name.value
+				}
+
+				recErr = errors.Join(recErr, field.set(&rec, []string{value}))
+			}
+		}
+
+		// cn/uid есть и в DN, запись без атрибута ключа берет его оттуда
+		if key := codec.key(&rec); *key == "" {
+			if name, _, ok := splitDN(*codec.dn(&rec)); ok && strings.EqualFold(name.attr, codec.rdn) {
+				*key = name.value
+			}
+		}
+
+		if recErr != nil {
+			errs = append(errs, ImportError{Record: i + 1, Key: *codec.key(&rec), Err: recErr})
+
+			continue
+		}
+
+		records = append(records, importRecord[T]{n: i + 1, rec: rec})
+	}
+
+	return records, errs, nil
+}
+
+type ldifAttr struct {
+	name  string
+	value string
+}
+
+// parseLDIF записи в порядке атрибутов: продолжения строк склеиваются, комментарии и version пропускаются
+func parseLDIF(r io.Reader) ([][]ldifAttr, error) {
+	var (
+		entries [][]ldifAttr
+		entry   []ldifAttr
+		lines   []string
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20) //nolint:mnd // длинные значения (сертификаты, фото) в base64
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if strings.HasPrefix(line, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ldif: %w", err)
+	}
+
+	for n, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "#"):
+			continue
+		case line == "":
+			if len(entry) > 0 {
+				entries = append(entries, entry)
+				entry = nil
+			}
+
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("ldif line %d: missing ':'", n+1)
+		}
+
+		switch {
+		case strings.HasPrefix(value, ":"):
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("ldif line %d: %w", n+1, err)
+			}
+
+			value = string(decoded)
+		case strings.HasPrefix(value, "<"):
+			return nil, fmt.Errorf("ldif line %d: url values are not supported", n+1)
+		default:
+			value = strings.TrimLeft(value, " ")
+		}
+
+		if len(entry) == 0 && strings.EqualFold(name, "version") {
+			continue
+		}
+
+		entry = append(entry, ldifAttr{name: name, value: value})
+	}
+
+	if len(entry) > 0 {
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// dn
+
+type rdnPair struct {
+	attr  string
+	value string
+}
+
+// dnSuffix суффикс каталога (dc=example,dc=test) из DN записи IPA
+func dnSuffix(dn string) string {
+	if i := strings.Index(strings.ToLower(dn), dnAccountsPart); i >= 0 {
+		return dn[i+len(dnAccountsPart):]
+	}
+
+	return ""
+}
+
+func joinDN(attr, value, container, suffix string) string {
+	dn := attr + "=" + escapeDNValue(value) + "," + container
+	if suffix != "" {
+		dn += "," + suffix
+	}
+
+	return dn
+}
+
+// splitDN первый RDN и остаток DN
+func splitDN(dn string) (rdnPair, string, bool) {
+	attr, rest, ok := strings.Cut(dn, "=")
+	if !ok {
+		return rdnPair{}, "", false
+	}
+
+	var value strings.Builder
+
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c == '\\' && i+2 < len(rest) && isHex(rest[i+1]) && isHex(rest[i+2]):
+			b, _ := strconv.ParseUint(rest[i+1:i+3], 16, 8)
+			value.WriteByte(byte(b))
+			i += 2
+		case c == '\\' && i+1 < len(rest):
+			value.WriteByte(rest[i+1])
+			i++
+		case c == ',':
+			return rdnPair{attr: strings.TrimSpace(attr), value: value.String()}, rest[i+1:], true
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return rdnPair{attr: strings.TrimSpace(attr), value: value.String()}, "", true
+}
+
+// escapeDNValue экранирование значения RDN (RFC 4514)
+func escapeDNValue(value string) string {
+	var b strings.Builder
+
+	for i := range len(value) {
+		c := value[i]
+
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,52 @@
+package freeipa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/volodya-nrg/tools/pkg/funcs"
+)
+
+func TestReadLDIFRecords(t *testing.T) {
+	t.Parallel()
+
+	// комментарии, перенос строки, base64, экранирование в DN и uid только в DN
+	data := strings.Join([]string{
+		"version: 1",
+		"# snapshot",
+		"dn: uid=alice,cn=users,cn=accounts,dc=example,dc=test",
+		"givenName:: 0JDQu9C40YHQsA==",
+		"sn: Do",
+		" e",
+		"nsAccountLock: TRUE",
+		"memberOf: cn=ipausers,cn=groups,cn=accounts,dc=example,dc=test",
+		"memberOf: cn=aud\\2Cx,cn=roles,cn=accounts,dc=example,dc=test",
+		"memberOf: cn=other,cn=pbac,dc=example,dc=test",
+		"",
+		"dn: uid=bob,cn=users,cn=accounts,dc=example,dc=test",
+		"nsAccountLock: maybe",
+		"",
+	}, "\n")
+
+	records, errs, err := readRecords(strings.NewReader(data), FormatLDIF, userRecordCodec)
+	require.NoError(t, err)
+	require.Equal(t, []importRecord[UserRecord]{{n: 1, rec: UserRecord{
+		UID:       "alice",
+		DN:        "uid=alice,cn=users,cn=accounts,dc=example,dc=test",
+		GivenName: "Алиса",
+		SN:        "Doe",
+		Disabled:  funcs.Pointer(true),
+		Groups:    []string{"ipausers"},
+		Roles:     []string{"aud,x"},
+	}}}, records)
+	require.Len(t, errs, 1)
+	require.Equal(t, 2, errs[0].Record)
+	require.Equal(t, "bob", errs[0].Key)
+
+	_, _, err = readRecords(strings.NewReader("dn: uid=a\nmail:< file:///etc/passwd\n"), FormatLDIF, userRecordCodec)
+	require.ErrorContains(t, err, "url values are not supported")
+
+	require.Equal(t, `cn=a\,b\+c,cn=roles,cn=accounts`, joinDN("cn", "a,b+c", "cn=roles,cn=accounts", ""))
+	require.Equal(t, "dc=example,dc=test", dnSuffix("uid=a,cn=users,cn=accounts,dc=example,dc=test"))
+}
@@ -0,0 +1,225 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errUnknownUser пользователя нет в IPA, см. Authorize
+var errUnknownUser = errors.New("unknown user")
+
+// Resolver вычисляет действующие права пользователя: роли (в т.ч. выданные его группам, с учетом вложенности),
+// привилегии этих ролей и разрешения привилегий. Результат кешируется на ttl.
+// Одновременные запросы одного пользователя без кеша ходят в IPA один раз.
+type Resolver struct {
+	ipa      *FreeIPA
+	ttl      time.Duration
+	mu       sync.Mutex
+	cache    map[string]resolvedAccess // lower(uid) -> права
+	inflight map[string]*resolveCall   // lower(uid) -> текущее вычисление
+	gen      uint64                    // растет при сбросе кеша, устаревшее вычисление в кеш не попадает
+}
+
+type resolvedAccess struct {
+	access    EffectiveAccess
+	expiresAt time.Time
+}
+
+// resolveCall вычисление прав, которого ждут все одновременные Resolve пользователя
+type resolveCall struct {
+	done   chan struct{}
+	access *EffectiveAccess
+	err    error
+}
+
+// NewResolver ttl <= 0 - без кеша
+func NewResolver(ipa *FreeIPA, ttl time.Duration) *Resolver {
+	return &Resolver{
+		ipa:      ipa,
+		ttl:      ttl,
+		cache:    make(map[string]resolvedAccess),
+		inflight: make(map[string]*resolveCall),
+	}
+}
+
+// Resolve действующие права. У отключенного или удаленного с сохранением пользователя прав нет.
+// Роли и привилегии, удаленные во время вычисления, пропускаются.
+func (r *Resolver) Resolve(ctx context.Context, uid string) (*EffectiveAccess, error) {
+	key := strings.ToLower(uid)
+
+	r.mu.Lock()
+
+	if cached, ok := r.cache[key]; ok && time.Now().Before(cached.expiresAt) {
+		r.mu.Unlock()
+		return cached.access.clone(), nil
+	}
+
+	if call, ok := r.inflight[key]; ok {
+		r.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if call.err != nil {
+			return nil, call.err
+		}
+
+		return call.access.clone(), nil
+	}
+
+	call := &resolveCall{done: make(chan struct{})}
+	r.inflight[key] = call
+	gen := r.gen
+	r.mu.Unlock()
+
+	call.access, call.err = r.resolve(ctx, uid)
+
+	r.mu.Lock()
+	if r.inflight[key] == call {
+		delete(r.inflight, key)
+	}
+	if call.err == nil && r.ttl > 0 && gen == r.gen {
+		r.cache[key] = resolvedAccess{access: *call.access, expiresAt: time.Now().Add(r.ttl)}
+	}
+	r.mu.Unlock()
+
+	close(call.done)
+
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	return call.access.clone(), nil
+}
+
+// Authorize есть ли у пользователя привилегия (имя без учета регистра). Неизвестный пользователь - false без ошибки.
+func (r *Resolver) Authorize(ctx context.Context, uid, privilege string) (bool, error) {
+	access, err := r.Resolve(ctx, uid)
+	if err != nil {
+		if errors.Is(err, errUnknownUser) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return slices.ContainsFunc(access.Privileges, func(v string) bool {
+		return strings.EqualFold(v, privilege)
+	}), nil
+}
+
+// Invalidate сбрасывает кеш пользователя, например после изменения его ролей или групп
+func (r *Resolver) Invalidate(uid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cache, strings.ToLower(uid))
+	delete(r.inflight, strings.ToLower(uid))
+	r.gen++
+}
+
+// InvalidateAll сбрасывает весь кеш, например после изменения ролей или привилегий
+func (r *Resolver) InvalidateAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clear(r.cache)
+	clear(r.inflight)
+	r.gen++
+}
+
+func (r *Resolver) resolve(ctx context.Context, uid string) (*EffectiveAccess, error) {
+	_, user, err := r.ipa.GetUser(ctx, uid)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to get user: %w: %w", errUnknownUser, err)
+		}
+
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	access := &EffectiveAccess{
+		UID:         user.UID,
+		Roles:       []string{},
+		Privileges:  []string{},
+		Permissions: []string{},
+	}
+
+	if user.NsAccountLock || user.Preserved {
+		return access, nil
+	}
+
+	access.Roles = uniqueSortedFold(slices.Concat(user.MemberOfRole, user.MemberOfIndirectRole))
+
+	_, roleEntries, err := r.ipa.showEntries(ctx, "role_show", access.Roles, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	roles, err := decodeEntries(roleEntries, roleCodec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	access.Roles = make([]string, 0, len(roles)) // без удаленных
+
+	for _, role := range roles {
+		access.Roles = append(access.Roles, role.CN)
+		access.Privileges = append(access.Privileges, role.Privileges...)
+	}
+
+	access.Roles = uniqueSortedFold(access.Roles)
+	access.Privileges = uniqueSortedFold(access.Privileges)
+
+	_, privilegeEntries, err := r.ipa.showEntries(ctx, "privilege_show", access.Privileges, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privileges: %w", err)
+	}
+
+	privileges, err := decodeEntries(privilegeEntries, privilegeCodec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privileges: %w", err)
+	}
+
+	for _, privilege := range privileges {
+		access.Permissions = append(access.Permissions, privilege.Permissions...)
+	}
+
+	access.Permissions = uniqueSortedFold(access.Permissions)
+
+	return access, nil
+}
+
+func (a EffectiveAccess) clone() *EffectiveAccess {
+	return &EffectiveAccess{
+		UID:         a.UID,
+		Roles:       slices.Clone(a.Roles),
+		Privileges:  slices.Clone(a.Privileges),
+		Permissions: slices.Clone(a.Permissions),
+	}
+}
+
+// uniqueSortedFold сортирует и убирает повторы без учета регистра, пустой результат - не nil
+func uniqueSortedFold(vals []string) []string {
+	result := make([]string, 0, len(vals))
+
+	for _, v := range vals {
+		if !slices.ContainsFunc(result, func(r string) bool { return strings.EqualFold(r, v) }) {
+			result = append(result, v)
+		}
+	}
+
+	slices.SortFunc(result, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+
+	return result
+}
@@ -0,0 +1,166 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// причины из failed, при которых состояние уже такое, как нужно
+const (
+	failedReasonAlreadyMember = "This entry is already a member"
+	failedReasonNotMember     = "This entry is not a member"
+)
+
+// roleMemberCall role_add_member/role_remove_member сразу для нескольких пользователей
+type roleMemberCall struct {
+	role     string
+	users    []string
+	isRemove bool
+}
+
+// AssignRoles выдает пользователю роли одним batch-ем, уже выданные - MemberUnchanged.
+// Ошибка - если хоть одна роль не выдана, итоги по ролям отдаются и в этом случае.
+func (f *FreeIPA) AssignRoles(ctx context.Context, uid string, roles ...string) (int, []RoleMemberResult, error) {
+	return f.editUserRoles(ctx, uid, roles, false)
+}
+
+// RevokeRoles забирает у пользователя роли одним batch-ем, не выданные - MemberUnchanged
+func (f *FreeIPA) RevokeRoles(ctx context.Context, uid string, roles ...string) (int, []RoleMemberResult, error) {
+	return f.editUserRoles(ctx, uid, roles, true)
+}
+
+// SetRoleMembers делает users единственными прямыми участниками-пользователями роли: недостающие добавляются,
+// лишние удаляются, по одной команде на всех. Группы, хосты и сервисы роли не меняются.
+func (f *FreeIPA) SetRoleMembers(ctx context.Context, role string, users ...string) (int, []RoleMemberResult, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, "role_show", role, map[string]any{"all": true})
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	current, err := decodeEntry(entry, roleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var (
+		calls     []roleMemberCall
+		unchanged []RoleMemberResult
+	)
+
+	for _, action := range planMembers("role", current.CN, users, current.MemberUser) {
+		calls = append(calls, roleMemberCall{
+			role:     current.CN,
+			users:    action.Members,
+			isRemove: action.Kind == ReconcileRemoveRoleMembers,
+		})
+	}
+
+	for _, uid := range users {
+		if containsFold(current.MemberUser, uid) {
+			unchanged = append(unchanged, RoleMemberResult{Role: current.CN, User: uid, Outcome: MemberUnchanged})
+		}
+	}
+
+	if len(calls) == 0 {
+		return statusCode, unchanged, nil
+	}
+
+	statusCode, results, err := f.sendRoleMemberCalls(ctx, calls)
+
+	return statusCode, append(results, unchanged...), err
+}
+
+func (f *FreeIPA) editUserRoles(
+	ctx context.Context,
+	uid string,
+	roles []string,
+	isRemove bool,
+) (int, []RoleMemberResult, error) {
+	if len(roles) == 0 {
+		return http.StatusOK, []RoleMemberResult{}, nil
+	}
+
+	calls := make([]roleMemberCall, len(roles))
+
+	for i, role := range roles {
+		calls[i] = roleMemberCall{role: role, users: []string{uid}, isRemove: isRemove}
+	}
+
+	return f.sendRoleMemberCalls(ctx, calls)
+}
+
+// sendRoleMemberCalls выполняет команды одним batch-ем и раскладывает ответ по участникам: ошибка команды
+// (например, нет роли) относится ко всем ее участникам, остальные причины берутся из failed
+func (f *FreeIPA) sendRoleMemberCalls(ctx context.Context, calls []roleMemberCall) (int, []RoleMemberResult, error) {
+	methods := make([]string, len(calls))
+
+	for i, call := range calls {
+		method := "role_add_member"
+		if call.isRemove {
+			method = "role_remove_member"
+		}
+
+		req, err := f.rpcReq(method, rpcArgs(call.role), map[string]any{keyOptUser: call.users}, false)
+		if err != nil {
+			return 0, nil, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (%s): %s", method, err)
+		}
+
+		methods[i] = string(req)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+	if len(resp.Result.Results) != len(calls) {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	var (
+		results []RoleMemberResult
+		errs    []error
+	)
+
+	for i, item := range resp.Result.Results {
+		call := calls[i]
+		itemErr := item.err()
+		reasons := failedMemberReasons(item.Failed, keyOptUser)
+
+		for _, uid := range call.users {
+			result := RoleMemberResult{Role: call.role, User: uid, Outcome: MemberAdded}
+			if call.isRemove {
+				result.Outcome = MemberRemoved
+			}
+
+			reason, isFailed := reasons[strings.ToLower(uid)]
+
+			switch {
+			case itemErr != nil:
+				result.Outcome, result.Err = MemberFailed, itemErr
+			case !isFailed:
+			case reason == failedReasonAlreadyMember, reason == failedReasonNotMember:
+				result.Outcome = MemberUnchanged
+			default:
+				result.Outcome, result.Err = MemberFailed, errors.New(reason)
+			}
+
+			if result.Err != nil {
+				errs = append(errs, fmt.Errorf("role %s, user %s: %w", call.role, uid, result.Err))
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	if len(errs) > 0 {
+		return 0, results, errors.Join(errs...)
+	}
+
+	return statusCode, results, nil
+}
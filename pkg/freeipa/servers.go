@@ -0,0 +1,356 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/volodya-nrg/tools/pkg/funcs"
+)
+
+// server реплика со своим http-клиентом: куки (сессия) у каждой реплики свои
+type server struct {
+	host      string
+	client    *http.Client
+	healthy   bool
+	latency   time.Duration
+	err       error
+	checkedAt time.Time
+	// sessionGen увеличивается при каждом успешном логине на эту реплику: сессии у реплик свои,
+	// поэтому 401 одной реплики не должен перелогинивать запросы к другим
+	sessionGen atomic.Uint64
+}
+
+// sessionRef реплика, ответившая на запрос, и поколение ее сессии на момент отправки
+type sessionRef struct {
+	server *server
+	gen    uint64
+}
+
+// serverPool реплики и текущая, на которую идут запросы
+type serverPool struct {
+	mu        sync.Mutex
+	transport *http.Transport
+	timeout   time.Duration
+	servers   []*server
+	current   int
+}
+
+func newServerPool(hosts []string, transport *http.Transport, timeout time.Duration) *serverPool {
+	p := &serverPool{
+		transport: transport,
+		timeout:   timeout,
+	}
+
+	p.add(hosts...)
+
+	return p
+}
+
+// HealthCheck проверяет все реплики командой ping. Живой считается реплика, которая ответила http-ответом
+// (в т.ч. 401 без сессии), кроме 5xx. Если текущая реплика недоступна, запросы переключаются на живую.
+// Каждая проверка передается наблюдателям (см. SetObservers) как ping с Host реплики.
+func (f *FreeIPA) HealthCheck(ctx context.Context) []ServerStatus {
+	req, err := f.rpcReq("ping", "", nil, true)
+	if err != nil { // не бывает: опций нет
+		return f.Servers()
+	}
+
+	var wg sync.WaitGroup
+
+	for _, s := range f.servers.candidates() {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			u := url.URL{
+				Scheme: f.scheme,
+				Host:   s.host,
+				Path:   "ipa/session/json",
+			}
+
+			start := time.Now()
+
+			statusCode, _, sendErr := funcs.HTTPRequest(ctx, s.client, http.MethodPost, u, req, f.serverHeaders(s))
+			duration := time.Since(start)
+
+			checkErr := sendErr
+			if checkErr == nil && statusCode >= http.StatusInternalServerError {
+				checkErr = fmt.Errorf("http-statusCode %d", statusCode)
+			}
+
+			f.servers.report(s, duration, checkErr)
+			f.notifyObservers(ctx, RPCCall{
+				Method:     "ping",
+				Host:       s.host,
+				Duration:   duration,
+				StatusCode: statusCode,
+				Err:        sendErr,
+			})
+		}()
+	}
+
+	wg.Wait()
+
+	return f.Servers()
+}
+
+// RunHealthChecks проверяет реплики сразу и затем раз в interval до отмены ctx (отмена - не ошибка).
+// Результаты проверок получают наблюдатели (см. SetObservers), например SlogObserver пишет недоступные в лог.
+func (f *FreeIPA) RunHealthChecks(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid health check interval %s", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		f.HealthCheck(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Servers состояние реплик по результатам последних запросов и проверок
+func (f *FreeIPA) Servers() []ServerStatus {
+	return f.servers.statuses()
+}
+
+// DiscoverServers добавляет реплики топологии (server_find), которых еще нет в списке, и отдает добавленные.
+// IPA отдает имена реплик без порта, поэтому к ним добавляется порт текущей реплики (если он указан),
+// scheme у всех реплик общая.
+func (f *FreeIPA) DiscoverServers(ctx context.Context) (int, []string, error) {
+	statusCode, entries, err := f.findEntries(ctx, "server_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	port := ""
+	if _, p, splitErr := net.SplitHostPort(f.host()); splitErr == nil {
+		port = p
+	}
+
+	hosts := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		cn, ok := entry["cn"]
+		if !ok {
+			continue
+		}
+
+		host, err := parseString(attrValues(cn)[0])
+		if err != nil {
+			return 0, nil, fmt.Errorf(errMsgFailedToParseResponse+": %w (cn)", err)
+		}
+
+		if _, _, splitErr := net.SplitHostPort(host); splitErr != nil && port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return statusCode, f.servers.add(hosts...), nil
+}
+
+// requestWithFailover отправляет запрос на текущую реплику, а если к ней не подключиться - на следующие
+// (сначала живые). На другую реплику уходят только ошибки до получения соединения (отказ в подключении,
+// таймаут подключения к недоступному хосту, в т.ч. по Client.Timeout): запрос, который мог дойти до сервера,
+// не повторяется, чтобы не выполнить изменение дважды. Ответившая реплика становится текущей,
+// если текущая недоступна.
+func (f *FreeIPA) requestWithFailover(
+	ctx context.Context,
+	method string,
+	u url.URL,
+	body []byte,
+	headers map[string]string,
+) (sessionRef, int, http.Header, []byte, error) {
+	candidates := f.servers.candidates()
+	if len(candidates) == 0 {
+		return sessionRef{}, 0, nil, nil, errors.New(errMsgNoServers)
+	}
+
+	errs := make([]error, 0, len(candidates))
+
+	for _, s := range candidates {
+		reqHeaders := maps.Clone(headers)
+		if _, ok := reqHeaders["Referer"]; ok {
+			reqHeaders["Referer"] = fmt.Sprintf("%s://%s/ipa", f.scheme, s.host)
+		}
+
+		u.Host = s.host
+		ref := sessionRef{server: s, gen: s.sessionGen.Load()}
+		start := time.Now()
+
+		// Client.Timeout при подключении не оборачивает *net.OpError, поэтому смотрим, было ли соединение
+		var isConnected atomic.Bool
+
+		traceCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(httptrace.GotConnInfo) { isConnected.Store(true) },
+		})
+
+		statusCode, header, bodyBytes, err := funcs.HTTPRequestWithHeader(traceCtx, s.client, method, u, body, reqHeaders)
+		if err == nil {
+			f.servers.report(s, time.Since(start), nil)
+			return ref, statusCode, header, bodyBytes, nil
+		}
+		if ctx.Err() != nil {
+			return sessionRef{}, 0, nil, nil, err
+		}
+
+		f.servers.report(s, time.Since(start), err)
+		errs = append(errs, fmt.Errorf("%s: %w", s.host, err))
+
+		if isConnected.Load() {
+			break
+		}
+	}
+
+	if len(errs) == 1 {
+		return sessionRef{}, 0, nil, nil, errors.Unwrap(errs[0])
+	}
+
+	return sessionRef{}, 0, nil, nil, errors.Join(errs...)
+}
+
+func (f *FreeIPA) serverHeaders(s *server) map[string]string {
+	headers := f.headers()
+	headers["Referer"] = fmt.Sprintf("%s://%s/ipa", f.scheme, s.host)
+
+	return headers
+}
+
+// host текущая реплика
+func (f *FreeIPA) host() string {
+	f.servers.mu.Lock()
+	defer f.servers.mu.Unlock()
+
+	if len(f.servers.servers) == 0 {
+		return ""
+	}
+
+	return f.servers.servers[f.servers.current].host
+}
+
+// add добавляет реплики, которых еще нет (без учета регистра), и отдает добавленные
+func (p *serverPool) add(hosts ...string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	added := make([]string, 0, len(hosts))
+
+	for _, host := range hosts {
+		if host == "" || p.indexOf(host) >= 0 {
+			continue
+		}
+
+		jar, _ := cookiejar.New(nil)
+
+		p.servers = append(p.servers, &server{
+			host: host,
+			client: &http.Client{
+				Transport: p.transport,
+				Timeout:   p.timeout,
+				Jar:       jar, // куки фиксируются автоматически
+			},
+			healthy: true, // пока не доказано обратное
+		})
+		added = append(added, host)
+	}
+
+	return added
+}
+
+// candidates порядок попыток: текущая, затем живые, затем недоступные
+func (p *serverPool) candidates() []*server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.servers) == 0 {
+		return nil
+	}
+
+	result := make([]*server, 0, len(p.servers))
+	result = append(result, p.servers[p.current])
+
+	for _, healthy := range []bool{true, false} {
+		for i, s := range p.servers {
+			if i != p.current && s.healthy == healthy {
+				result = append(result, s)
+			}
+		}
+	}
+
+	return result
+}
+
+// report запоминает итог запроса или проверки реплики. Живая реплика становится текущей, если текущая недоступна.
+func (p *serverPool) report(s *server, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s.healthy = err == nil
+	s.latency = latency
+	s.err = err
+	s.checkedAt = time.Now()
+
+	if s.healthy && !p.servers[p.current].healthy {
+		p.current = p.indexOf(s.host)
+	}
+}
+
+func (p *serverPool) statuses() []ServerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]ServerStatus, len(p.servers))
+
+	for i, s := range p.servers {
+		result[i] = ServerStatus{
+			Host:      s.host,
+			Healthy:   s.healthy,
+			Current:   i == p.current,
+			Latency:   s.latency,
+			Err:       s.err,
+			CheckedAt: s.checkedAt,
+		}
+	}
+
+	return result
+}
+
+func (p *serverPool) closeIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.servers {
+		s.client.CloseIdleConnections()
+	}
+}
+
+// indexOf без блокировки, вызывающий должен держать mu
+func (p *serverPool) indexOf(host string) int {
+	for i, s := range p.servers {
+		if strings.EqualFold(s.host, host) {
+			return i
+		}
+	}
+
+	return -1
+}
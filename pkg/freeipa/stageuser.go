@@ -0,0 +1,141 @@
+package freeipa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// часть dn stage-пользователей: uid=...,cn=staged users,cn=accounts,cn=provisioning,dc=...
+const stagedUsersContainer = "cn=staged users"
+
+// afterDecode отдельного признака у stageuser_* нет, различаем по контейнеру в dn
+func (u *User) afterDecode(map[string]any) error {
+	u.Staged = strings.Contains(strings.ToLower(u.DN), stagedUsersContainer)
+	return nil
+}
+
+// stage users
+
+// GetStageUsers получение stage-пользователей, пагинация такая же как у GetUsers.
+// Выборка, обрезанная сервером (лимит LDAP), - ошибка ErrSizeLimitExceeded.
+func (f *FreeIPA) GetStageUsers(ctx context.Context, limit, offset int32) (int, []User, uint32, error) {
+	opts := map[string]any{
+		"pkey_only": true,
+		"sizelimit": 0, // без него IPA отдает не больше ipasearchrecordslimit (по умолчанию 100)
+	}
+
+	statusCode, resp, err := f.sendRPC(ctx, "stageuser_find", "", opts)
+	if err != nil {
+		return statusCode, nil, 0, err
+	}
+	if resp.Result == nil {
+		return 0, nil, 0, errors.New(errMsgResponseResultIsNil)
+	}
+	if resp.Result.Truncated {
+		return 0, nil, 0, newTruncatedError("stageuser_find", resp.Result.Count)
+	}
+
+	users := make([]User, 0)
+	total := resp.Result.Count
+
+	if resp.Result.Result != nil {
+		if users, err = decodeList(resp.Result.Result, userCodec); err != nil {
+			return 0, nil, 0, err
+		}
+	}
+
+	targetUsers := getRangeFromSlice(users, limit, offset, limitDefault)
+	methods := make([]string, len(targetUsers))
+	opts = map[string]any{
+		"all": true,
+	}
+
+	for i, user := range targetUsers {
+		method, err := f.rpcReq("stageuser_show", rpcArgs(user.UID), opts, false)
+		if err != nil {
+			return 0, nil, 0, fmt.Errorf(errMsgFailedToCreateJSONRPCRequest+" (stageuser_show): %s", err)
+		}
+
+		methods[i] = string(method)
+	}
+
+	statusCode, resp, err = f.sendRPC(ctx, "batch", fmt.Sprintf(`[%s]`, strings.Join(methods, ",")), nil)
+	if err != nil {
+		return statusCode, nil, 0, err
+	}
+	if resp.Result == nil {
+		return 0, nil, 0, errors.New(errMsgResponseResultIsNil)
+	}
+
+	users = make([]User, 0, len(resp.Result.Results))
+
+	for _, result := range resp.Result.Results {
+		if userTmp, ok := result.Result.(map[string]any); ok {
+			user, err := decodeEntry(userTmp, userCodec)
+			if err != nil {
+				return 0, nil, 0, err
+			}
+
+			users = append(users, user)
+		}
+	}
+
+	return statusCode, users, total, nil
+}
+
+func (f *FreeIPA) GetStageUser(ctx context.Context, userID string) (int, *User, error) {
+	opts := map[string]any{
+		"all": true,
+	}
+
+	return f.sendUserRPC(ctx, "stageuser_show", userID, opts)
+}
+
+// CreateStageUser заводит пользователя в stage-зоне (stageuser_add), войти он сможет только после активации
+func (f *FreeIPA) CreateStageUser(ctx context.Context, reqUser RequestUser) (int, *User, error) {
+	opts, err := reqUser.toAddOpts()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return f.sendUserRPC(ctx, "stageuser_add", reqUser.UID, opts)
+}
+
+// ActivateStageUser переводит stage-пользователя в активные (stageuser_activate), отдается уже активный пользователь
+func (f *FreeIPA) ActivateStageUser(ctx context.Context, userID string) (int, *User, error) {
+	return f.sendUserRPC(ctx, "stageuser_activate", userID, nil)
+}
+
+func (f *FreeIPA) DeleteStageUser(ctx context.Context, userID string) (int, error) {
+	statusCode, _, err := f.sendRPC(ctx, "stageuser_del", rpcArgs(userID), nil)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// sendUserRPC команда, в ответе которой одна запись пользователя
+func (f *FreeIPA) sendUserRPC(ctx context.Context, method, userID string, opts map[string]any) (int, *User, error) {
+	statusCode, resp, err := f.sendRPC(ctx, method, rpcArgs(userID), opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+	if resp.Result == nil {
+		return 0, nil, errors.New(errMsgResponseResultIsNil)
+	}
+
+	userTmp, ok := resp.Result.Result.(map[string]any)
+	if !ok {
+		return 0, nil, errors.New(errMsgFailedToParseResponse)
+	}
+
+	user, err := decodeEntry(userTmp, userCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &user, nil
+}
@@ -0,0 +1,154 @@
+package freeipa
+
+import (
+	"context"
+)
+
+// sudo rules
+
+// GetSudoRules все правила sudo
+func (f *FreeIPA) GetSudoRules(ctx context.Context) (int, []SudoRule, error) {
+	statusCode, entries, err := f.findEntries(ctx, "sudorule_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	rules, err := decodeEntries(entries, sudoRuleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, rules, nil
+}
+
+func (f *FreeIPA) GetSudoRule(ctx context.Context, name string) (int, *SudoRule, error) {
+	return f.sendSudoRuleRPC(ctx, "sudorule_show", name, map[string]any{"all": true})
+}
+
+// CreateSudoRule создает включенное правило
+func (f *FreeIPA) CreateSudoRule(ctx context.Context, reqRule RequestSudoRule) (int, *SudoRule, error) {
+	return f.sendSudoRuleRPC(ctx, "sudorule_add", reqRule.CN, reqRule.toOpts())
+}
+
+// UpdateSudoRule описание, порядок и категории. Категорию "all" нельзя выставить, пока есть участники.
+func (f *FreeIPA) UpdateSudoRule(ctx context.Context, reqRule RequestSudoRule) (int, *SudoRule, error) {
+	return f.sendSudoRuleRPC(ctx, "sudorule_mod", reqRule.CN, reqRule.toOpts())
+}
+
+func (f *FreeIPA) DeleteSudoRule(ctx context.Context, name string) (int, error) {
+	return f.deleteEntry(ctx, "sudorule_del", name)
+}
+
+func (f *FreeIPA) EnableSudoRule(ctx context.Context, name string) (int, error) {
+	return f.toggleRule(ctx, "sudorule", name, false)
+}
+
+func (f *FreeIPA) DisableSudoRule(ctx context.Context, name string) (int, error) {
+	return f.toggleRule(ctx, "sudorule", name, true)
+}
+
+// AddSudoRuleMembers добавляет пользователей/группы, хосты/группы хостов, разрешенные и запрещенные команды,
+// а также от чьего имени (RunAs*) можно выполнять
+func (f *FreeIPA) AddSudoRuleMembers(ctx context.Context, name string, members RuleMembers) (int, error) {
+	return f.editRuleMembers(ctx, "sudorule", name, members.sudoCalls(), false)
+}
+
+func (f *FreeIPA) RemoveSudoRuleMembers(ctx context.Context, name string, members RuleMembers) (int, error) {
+	return f.editRuleMembers(ctx, "sudorule", name, members.sudoCalls(), true)
+}
+
+// AddSudoRuleOption опция sudoers, например "!authenticate"
+func (f *FreeIPA) AddSudoRuleOption(ctx context.Context, name, option string) (int, error) {
+	return f.editSudoRuleOption(ctx, "sudorule_add_option", name, option)
+}
+
+func (f *FreeIPA) RemoveSudoRuleOption(ctx context.Context, name, option string) (int, error) {
+	return f.editSudoRuleOption(ctx, "sudorule_remove_option", name, option)
+}
+
+func (f *FreeIPA) editSudoRuleOption(ctx context.Context, method, name, option string) (int, error) {
+	opts := map[string]any{
+		keySudoOpt: option,
+	}
+
+	statusCode, _, err := f.sendRPC(ctx, method, rpcArgs(name), opts)
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+func (f *FreeIPA) sendSudoRuleRPC(
+	ctx context.Context,
+	method, name string,
+	opts map[string]any,
+) (int, *SudoRule, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, method, name, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	rule, err := decodeEntry(entry, sudoRuleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &rule, nil
+}
+
+// sudo commands
+
+func (f *FreeIPA) GetSudoCommands(ctx context.Context) (int, []SudoCommand, error) {
+	statusCode, entries, err := f.findEntries(ctx, "sudocmd_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	commands, err := decodeEntries(entries, sudoCommandCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, commands, nil
+}
+
+// CreateSudoCommand command - полный путь, например /usr/bin/systemctl
+func (f *FreeIPA) CreateSudoCommand(ctx context.Context, command string, desc *string) (int, *SudoCommand, error) {
+	opts := map[string]any{}
+
+	if desc != nil {
+		opts[keyOptDescription] = *desc
+	}
+
+	statusCode, entry, err := f.sendEntryRPC(ctx, "sudocmd_add", command, opts)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	sudoCmd, err := decodeEntry(entry, sudoCommandCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return statusCode, &sudoCmd, nil
+}
+
+func (f *FreeIPA) DeleteSudoCommand(ctx context.Context, command string) (int, error) {
+	return f.deleteEntry(ctx, "sudocmd_del", command)
+}
+
+// toOpts опции sudorule_add/sudorule_mod
+func (r RequestSudoRule) toOpts() map[string]any {
+	opts := map[string]any{}
+
+	putOpt(opts, keyOptDescription, r.Description)
+	putOpt(opts, "sudoorder", r.Order)
+	putOpt(opts, "usercategory", r.UserCategory)
+	putOpt(opts, "hostcategory", r.HostCategory)
+	putOpt(opts, "cmdcategory", r.CmdCategory)
+	putOpt(opts, "ipasudorunasusercategory", r.RunAsUserCategory)
+	putOpt(opts, "ipasudorunasgroupcategory", r.RunAsGroupCategory)
+
+	return opts
+}
@@ -0,0 +1,167 @@
+package freeipa
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ApplyUser приводит пользователя к желаемому состоянию: desired сравнивается с текущей записью
+// и в user_mod уходят только отличающиеся поля и операции над атрибутами. nil-поля не сравниваются,
+// пароль сравнить нельзя - он применяется всегда. Второе значение - было ли что-то изменено.
+func (f *FreeIPA) ApplyUser(ctx context.Context, desired RequestUser) (int, bool, error) {
+	statusCode, entry, err := f.sendEntryRPC(ctx, "user_show", desired.UID, map[string]any{"all": true})
+	if err != nil {
+		return statusCode, false, err
+	}
+
+	diff, err := diffUser(entry, desired)
+	if err != nil {
+		return 0, false, err
+	}
+
+	opts := diff.toModOpts()
+	if len(opts) == 0 {
+		return statusCode, false, nil
+	}
+
+	statusCode, err = f.updateUser(ctx, diff.UID, opts)
+	if err != nil {
+		return statusCode, false, err
+	}
+
+	return statusCode, true, nil
+}
+
+// allAttrsCodec все атрибуты записи строками, двоичные - в base64
+var allAttrsCodec = entryCodec[map[string][]string]{
+	remain: func(attrs *map[string][]string) *map[string][]string { return attrs },
+}
+
+// diffUser изменения, которые переводят запись пользователя entry (user_show --all) в состояние desired
+func diffUser(entry map[string]any, desired RequestUser) (RequestUser, error) {
+	current, err := decodeEntry(entry, userCodec)
+	if err != nil {
+		return RequestUser{}, err
+	}
+
+	// все атрибуты записи строками, для сравнения с операциями "attr=value"
+	attrs, err := decodeEntry(entry, allAttrsCodec)
+	if err != nil {
+		return RequestUser{}, err
+	}
+
+	diff := RequestUser{
+		UID:             desired.UID,
+		UserPassword:    desired.UserPassword,
+		Mail:            diffString(desired.Mail, current.Mail),
+		CN:              diffString(desired.CN, current.CN),
+		TelephoneNumber: diffString(desired.TelephoneNumber, current.TelephoneNumber),
+		Mobile:          diffString(desired.Mobile, current.Mobile),
+		Title:           diffString(desired.Title, current.Title),
+		OU:              diffString(desired.OU, current.OrgUnit),
+	}
+
+	if desired.GivenName != current.GivenName {
+		diff.GivenName = desired.GivenName
+	}
+	if desired.SN != current.SN {
+		diff.SN = desired.SN
+	}
+	if desired.NsAccountLock != nil && *desired.NsAccountLock != current.NsAccountLock {
+		diff.NsAccountLock = desired.NsAccountLock
+	}
+	// IPA хранит время с точностью до секунды
+	if desired.KRBPasswordExpiration != nil &&
+		!desired.KRBPasswordExpiration.Truncate(time.Second).Equal(current.KRBPasswordExpiration) {
+		diff.KRBPasswordExpiration = desired.KRBPasswordExpiration
+	}
+
+	// бинарные атрибуты сравниваются по содержимому, а не по записи base64 (переносы строк и т.п.)
+	opValue := func(attr, value string) string {
+		return attrOpValue(entry, attr, value)
+	}
+
+	diff.AddAttr = filterAttrOps(desired.AddAttr, func(attr, value string) bool {
+		return !slices.Contains(attrs[attr], opValue(attr, value))
+	})
+	diff.DelAttr = filterAttrOps(desired.DelAttr, func(attr, value string) bool {
+		return slices.Contains(attrs[attr], opValue(attr, value))
+	})
+	diff.SetAttr = diffSetAttr(desired.SetAttr, attrs, opValue)
+
+	for _, attr := range desired.ClearAttr {
+		if len(attrs[strings.ToLower(attr)]) > 0 {
+			diff.ClearAttr = append(diff.ClearAttr, attr)
+		}
+	}
+
+	return diff, nil
+}
+
+func diffString(desired *string, current string) *string {
+	if desired == nil || *desired == current {
+		return nil
+	}
+
+	return desired
+}
+
+// filterAttrOps операции "attr=value", для которых isNeeded(attr, value), имя атрибута в нижнем регистре
+func filterAttrOps(items []string, isNeeded func(attr, value string) bool) []string {
+	var result []string
+
+	for _, item := range items {
+		attr, value, _ := strings.Cut(item, "=")
+		if isNeeded(strings.ToLower(attr), value) {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// diffSetAttr setattr заменяет все значения атрибута, поэтому сравнивается весь набор
+func diffSetAttr(items []string, attrs map[string][]string, opValue func(attr, value string) string) []string {
+	desired := map[string][]string{}
+
+	for _, item := range items {
+		attr, value, _ := strings.Cut(item, "=")
+		attr = strings.ToLower(attr)
+
+		if value != "" { // "attr=" очищает атрибут
+			desired[attr] = append(desired[attr], opValue(attr, value))
+		} else if _, ok := desired[attr]; !ok {
+			desired[attr] = nil
+		}
+	}
+
+	return filterAttrOps(items, func(attr, _ string) bool {
+		return !sameValues(desired[attr], attrs[attr])
+	})
+}
+
+// attrOpValue значение из операции "attr=value" в том виде, как оно лежит в Attrs: бинарные атрибуты
+// (в entry они {"__base64__": ...}) там в base64 без переносов, поэтому значение раскодируется и кодируется заново
+func attrOpValue(entry map[string]any, attr, value string) string {
+	values, _ := entry[attr].([]any)
+	if len(values) == 0 {
+		return value
+	}
+	if wrapped, ok := values[0].(map[string]any); !ok || wrapped["__base64__"] == nil {
+		return value
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil { // не base64 - IPA его все равно не примет, сравниваем как есть
+		return value
+	}
+
+	return base64.StdEncoding.EncodeToString(decoded)
+}
+
+func sameValues(a, b []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+}
@@ -0,0 +1,77 @@
+package freeipa
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+)
+
+const (
+	keySSHPubKey       = "ipasshpubkey"
+	keyUserCertificate = "usercertificate"
+)
+
+// ssh keys
+
+// AddUserSSHKeys добавляет ключи в формате authorized_keys ("ssh-ed25519 AAAA... comment"),
+// отпечатки IPA считает сам (User.SSHKeyFingerprints). Пользователь может менять свои ключи сам.
+func (f *FreeIPA) AddUserSSHKeys(ctx context.Context, userID string, keys []string) (int, error) {
+	return f.editUserAttrValues(ctx, userID, keyOptAddAttr, keySSHPubKey, keys)
+}
+
+// RemoveUserSSHKeys ключ указывается так же, как он хранится (User.SSHPublicKeys)
+func (f *FreeIPA) RemoveUserSSHKeys(ctx context.Context, userID string, keys []string) (int, error) {
+	return f.editUserAttrValues(ctx, userID, keyOptDelAttr, keySSHPubKey, keys)
+}
+
+func (f *FreeIPA) editUserAttrValues(ctx context.Context, userID, action, attr string, values []string) (int, error) {
+	if len(values) == 0 {
+		return 0, errors.New("values are empty")
+	}
+
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = attr + "=" + v
+	}
+
+	statusCode, _, err := f.sendRPC(ctx, "user_mod", rpcArgs(userID), map[string]any{action: items})
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
+
+// certificates
+
+// GetUserCertificates сертификаты пользователя, в т.ч. выпущенные не IPA CA
+func (f *FreeIPA) GetUserCertificates(ctx context.Context, userID string) (int, []Certificate, error) {
+	return f.FindCertificates(ctx, CertificateFilter{Users: []string{userID}})
+}
+
+// AddUserCertificates привязывает к пользователю сертификаты в DER
+func (f *FreeIPA) AddUserCertificates(ctx context.Context, userID string, ders [][]byte) (int, error) {
+	return f.editUserCertificates(ctx, "user_add_cert", userID, ders)
+}
+
+func (f *FreeIPA) RemoveUserCertificates(ctx context.Context, userID string, ders [][]byte) (int, error) {
+	return f.editUserCertificates(ctx, "user_remove_cert", userID, ders)
+}
+
+func (f *FreeIPA) editUserCertificates(ctx context.Context, method, userID string, ders [][]byte) (int, error) {
+	if len(ders) == 0 {
+		return 0, errors.New("certificates are empty")
+	}
+
+	certs := make([]any, len(ders))
+	for i, der := range ders {
+		certs[i] = map[string]any{"__base64__": base64.StdEncoding.EncodeToString(der)}
+	}
+
+	statusCode, _, err := f.sendRPC(ctx, method, rpcArgs(userID), map[string]any{keyUserCertificate: certs})
+	if err != nil {
+		return statusCode, err
+	}
+
+	return statusCode, nil
+}
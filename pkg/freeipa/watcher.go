@@ -0,0 +1,351 @@
+package freeipa
+
+import (
+	"context"
+	"encoding/hex"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchIntervalDefault интервал опроса, если передан не положительный
+const watchIntervalDefault = time.Minute
+
+// атрибуты, изменения которых не считаются изменением пользователя: служебные и членство (оно идет
+// отдельными событиями ролей и групп)
+var watchIgnoredAttrs = []string{
+	"krblastsuccessfulauth",
+	"krblastfailedauth",
+	"krbloginfailedcount",
+	"memberof",
+}
+
+// Watcher опрашивает IPA раз в interval и отдает изменения пользователей, ролей и групп событиями.
+// IPA не умеет отдавать изменения с момента, поэтому каждый опрос - полный снимок (user_find, role_find,
+// group_find со всеми атрибутами), который сравнивается с предыдущим.
+type Watcher struct {
+	ipa      *FreeIPA
+	interval time.Duration
+	mu       sync.Mutex
+	state    *WatchState // nil - первый опрос только запоминает снимок
+}
+
+// watchUserEntry то, что нужно от записи пользователя для снимка
+type watchUserEntry struct {
+	UID             string
+	NsAccountLock   bool
+	ModifyTimestamp time.Time
+	Attrs           map[string][]string
+}
+
+var watchUserEntryCodec = entryCodec[watchUserEntry]{
+	fields: []entryField[watchUserEntry]{
+		scalarAttr("uid", func(e *watchUserEntry) *string { return &e.UID }, parseString),
+		scalarAttr("nsaccountlock", func(e *watchUserEntry) *bool { return &e.NsAccountLock }, parseBool),
+		scalarAttr("modifytimestamp", func(e *watchUserEntry) *time.Time { return &e.ModifyTimestamp }, parseTime),
+	},
+	remain: func(e *watchUserEntry) *map[string][]string { return &e.Attrs },
+}
+
+// NewWatcher state - сохраненный ранее снимок (см. Watcher.State), nil - начать с текущего состояния.
+// interval <= 0 - опрос раз в watchIntervalDefault (минуту).
+func NewWatcher(ipa *FreeIPA, interval time.Duration, state *WatchState) *Watcher {
+	if interval <= 0 {
+		interval = watchIntervalDefault
+	}
+
+	return &Watcher{
+		ipa:      ipa,
+		interval: interval,
+		state:    state.clone(),
+	}
+}
+
+// State копия последнего снимка для сохранения, nil - опросов еще не было
+func (w *Watcher) State() *WatchState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.state.clone()
+}
+
+// Poll один опрос: изменения относительно предыдущего снимка, снимок заменяется новым.
+// При ошибке снимок не меняется, изменения будут найдены следующим опросом. Выборка, обрезанная сервером,
+// тоже ошибка (ErrSizeLimitExceeded): по неполному снимку пропавшие из него записи выглядели бы удаленными.
+func (w *Watcher) Poll(ctx context.Context) (int, []ChangeEvent, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	statusCode, state, err := w.snapshot(ctx)
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	var events []ChangeEvent
+
+	if w.state != nil {
+		events = slices.Concat(
+			diffWatchedUsers(w.state.Users, state.Users, state.PolledAt),
+			diffMemberships(EventGroupMembershipChanged, w.state.Groups, state.Groups, state.PolledAt),
+			diffMemberships(EventRoleMembershipChanged, w.state.Roles, state.Roles, state.PolledAt),
+		)
+	}
+
+	w.state = state
+
+	return statusCode, events, nil
+}
+
+// Run опрашивает сразу и затем раз в interval до отмены ctx, события передаются в handler по порядку.
+// Ошибки опроса пишутся в лог, опрос продолжается.
+func (w *Watcher) Run(ctx context.Context, handler func(ChangeEvent)) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		_, events, err := w.Poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "failed to poll freeipa changes", slog.String("error", err.Error()))
+		}
+
+		for _, event := range events {
+			handler(event)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Events то же, что Run, но события отдаются в канал. Канал закрывается после отмены ctx.
+func (w *Watcher) Events(ctx context.Context, buffer int) <-chan ChangeEvent {
+	ch := make(chan ChangeEvent, buffer)
+
+	go func() {
+		defer close(ch)
+
+		w.Run(ctx, func(event ChangeEvent) {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	return ch
+}
+
+func (w *Watcher) snapshot(ctx context.Context) (int, *WatchState, error) {
+	state := &WatchState{
+		Users:    map[string]WatchedUser{},
+		Roles:    map[string][]string{},
+		Groups:   map[string][]string{},
+		PolledAt: time.Now().UTC(),
+	}
+
+	statusCode, userEntries, err := w.ipa.findEntries(ctx, "user_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	users, err := decodeEntries(userEntries, watchUserEntryCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, user := range users {
+		state.Users[strings.ToLower(user.UID)] = user.toWatched()
+	}
+
+	statusCode, groupEntries, err := w.ipa.findEntries(ctx, "group_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	groups, err := decodeEntries(groupEntries, groupCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, group := range groups {
+		state.Groups[group.CN] = sortedLower(group.MemberUser)
+	}
+
+	statusCode, roleEntries, err := w.ipa.findEntries(ctx, "role_find", "")
+	if err != nil {
+		return statusCode, nil, err
+	}
+
+	roles, err := decodeEntries(roleEntries, roleCodec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, role := range roles {
+		state.Roles[role.CN] = sortedLower(role.MemberUser)
+	}
+
+	return statusCode, state, nil
+}
+
+func (e watchUserEntry) toWatched() WatchedUser {
+	user := WatchedUser{
+		UID:             e.UID,
+		Disabled:        e.NsAccountLock,
+		ModifyTimestamp: e.ModifyTimestamp,
+		Attrs:           make(map[string]string, len(e.Attrs)),
+	}
+
+	for attr, values := range e.Attrs {
+		if slices.ContainsFunc(watchIgnoredAttrs, func(prefix string) bool {
+			return strings.HasPrefix(attr, prefix)
+		}) {
+			continue
+		}
+
+		h := fnv.New64a()
+		for _, value := range slices.Sorted(slices.Values(values)) {
+			_, _ = h.Write([]byte(value))
+			_, _ = h.Write([]byte{0})
+		}
+
+		user.Attrs[attr] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return user
+}
+
+func diffWatchedUsers(prev, curr map[string]WatchedUser, polledAt time.Time) []ChangeEvent {
+	var events []ChangeEvent
+
+	for _, key := range slices.Sorted(maps.Keys(curr)) {
+		user := curr[key]
+		at := polledAt
+
+		if !user.ModifyTimestamp.IsZero() {
+			at = user.ModifyTimestamp
+		}
+
+		old, ok := prev[key]
+		if !ok {
+			events = append(events, ChangeEvent{Kind: EventUserCreated, Name: user.UID, At: at})
+
+			continue
+		}
+
+		var fields []string
+
+		for attr := range maps.Keys(user.Attrs) {
+			if old.Attrs[attr] != user.Attrs[attr] {
+				fields = append(fields, attr)
+			}
+		}
+
+		for attr := range maps.Keys(old.Attrs) {
+			if _, ok := user.Attrs[attr]; !ok {
+				fields = append(fields, attr)
+			}
+		}
+
+		if len(fields) > 0 {
+			slices.Sort(fields)
+			events = append(events, ChangeEvent{Kind: EventUserUpdated, Name: user.UID, Fields: fields, At: at})
+		}
+
+		switch {
+		case user.Disabled && !old.Disabled:
+			events = append(events, ChangeEvent{Kind: EventUserDisabled, Name: user.UID, At: at})
+		case !user.Disabled && old.Disabled:
+			events = append(events, ChangeEvent{Kind: EventUserEnabled, Name: user.UID, At: at})
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(prev)) {
+		if _, ok := curr[key]; !ok {
+			events = append(events, ChangeEvent{Kind: EventUserDeleted, Name: prev[key].UID, At: polledAt})
+		}
+	}
+
+	return events
+}
+
+// diffMemberships изменения состава ролей или групп, созданная/удаленная запись - изменение с/до пустого
+func diffMemberships(kind ChangeEventKind, prev, curr map[string][]string, polledAt time.Time) []ChangeEvent {
+	var events []ChangeEvent
+
+	names := slices.Sorted(maps.Keys(curr))
+	for name := range maps.Keys(prev) {
+		if _, ok := curr[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		var added, removed []string
+
+		for _, uid := range curr[name] {
+			if !slices.Contains(prev[name], uid) {
+				added = append(added, uid)
+			}
+		}
+
+		for _, uid := range prev[name] {
+			if !slices.Contains(curr[name], uid) {
+				removed = append(removed, uid)
+			}
+		}
+
+		if len(added) > 0 || len(removed) > 0 {
+			events = append(events, ChangeEvent{Kind: kind, Name: name, Added: added, Removed: removed, At: polledAt})
+		}
+	}
+
+	return events
+}
+
+func (s *WatchState) clone() *WatchState {
+	if s == nil {
+		return nil
+	}
+
+	c := &WatchState{
+		Users:    make(map[string]WatchedUser, len(s.Users)),
+		Roles:    make(map[string][]string, len(s.Roles)),
+		Groups:   make(map[string][]string, len(s.Groups)),
+		PolledAt: s.PolledAt,
+	}
+
+	for key, user := range s.Users {
+		user.Attrs = maps.Clone(user.Attrs)
+		c.Users[key] = user
+	}
+
+	for name, members := range s.Roles {
+		c.Roles[name] = slices.Clone(members)
+	}
+
+	for name, members := range s.Groups {
+		c.Groups[name] = slices.Clone(members)
+	}
+
+	return c
+}
+
+func sortedLower(items []string) []string {
+	result := make([]string, len(items))
+
+	for i, item := range items {
+		result[i] = strings.ToLower(item)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
@@ -39,9 +39,22 @@ func HTTPRequest(
 	body []byte,
 	headers map[string]string,
 ) (int, []byte, error) {
+	statusCode, _, bodyBytes, err := HTTPRequestWithHeader(ctx, client, method, u, body, headers)
+	return statusCode, bodyBytes, err
+}
+
+// HTTPRequestWithHeader то же что HTTPRequest, но дополнительно отдает заголовки ответа
+func HTTPRequestWithHeader(
+	ctx context.Context,
+	client *http.Client,
+	method string,
+	u url.URL,
+	body []byte,
+	headers map[string]string,
+) (int, http.Header, []byte, error) {
 	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to create request: %s", err)
+		return 0, nil, nil, fmt.Errorf("failed to create request: %s", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded") // default
@@ -52,7 +65,7 @@ func HTTPRequest(
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to execute request: %s", err)
+		return 0, nil, nil, fmt.Errorf("failed to execute request: %w", err)
 	}
 
 	defer func() {
@@ -63,10 +76,10 @@ func HTTPRequest(
 
 	bodyBytes, err := io.ReadAll(resp.Body) // cut data (once)
 	if err != nil {
-		return 0, nil, fmt.Errorf("failed to read response body: %s", err)
+		return 0, nil, nil, fmt.Errorf("failed to read response body: %s", err)
 	}
 
-	return resp.StatusCode, bodyBytes, nil // отдаем данные как есть, принимающая сторона распределится ими
+	return resp.StatusCode, resp.Header, bodyBytes, nil // отдаем данные как есть, принимающая сторона распределится ими
 }
 
 func RandStrLimit(n int) string {